@@ -0,0 +1,576 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// File holding the API keys; only hashes of the keys are stored
+const apiKeysFile = "data/apikeys.json"
+
+// Scopes an API key can be given. A session started with a key has the
+// same scopes as the key.
+const (
+	ScopeOCR   = "ocr"   // submit images: /upload, /api/v1/recognize, jobs, gRPC
+	ScopeRead  = "read"  // browse, search and export documents
+	ScopeWrite = "write" // edit, delete and re-process documents and collections
+	ScopeAdmin = "admin" // manage API keys; implies every other scope
+)
+
+var validScopes = []string{ScopeOCR, ScopeRead, ScopeWrite, ScopeAdmin}
+
+// APIKey is a client credential with its scopes, quotas and usage
+type APIKey struct {
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	Prefix       string     `json:"prefix"` // first characters of the key, to recognise it
+	Hash         string     `json:"hash,omitempty"`
+	Scopes       []string   `json:"scopes"`
+	DailyQuota   int        `json:"daily_quota"`   // pages per UTC day, 0 = unlimited
+	MonthlyQuota int        `json:"monthly_quota"` // pages per UTC month, 0 = unlimited
+	Usage        KeyUsage   `json:"usage"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastUsedAt   *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+
+	expiresAt time.Time // for callers authenticated with a JWT
+}
+
+// KeyUsage counts recognised pages; the day and month counters restart when
+// Day or Month no longer match the current date
+type KeyUsage struct {
+	Day        string `json:"day"`
+	DayPages   int    `json:"day_pages"`
+	Month      string `json:"month"`
+	MonthPages int    `json:"month_pages"`
+	TotalPages int    `json:"total_pages"`
+	Requests   int    `json:"requests"`
+}
+
+// HasScope reports whether the key grants scope
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// public returns a copy without the hash, for listings
+func (k *APIKey) public() *APIKey {
+	c := *k
+	c.Hash = ""
+	return &c
+}
+
+// current returns the usage with the day and month counters of now
+func (u KeyUsage) current(now time.Time) KeyUsage {
+	if day := now.Format("2006-01-02"); u.Day != day {
+		u.Day, u.DayPages = day, 0
+	}
+	if month := now.Format("2006-01"); u.Month != month {
+		u.Month, u.MonthPages = month, 0
+	}
+	return u
+}
+
+// How often counted pages are written to apiKeysFile; usage is kept in
+// memory in between so requests do not rewrite the file
+const apiKeyUsageFlushInterval = 10 * time.Second
+
+// APIKeyStore keeps the API keys in memory and in apiKeysFile. The file is
+// re-read when it changes, so keys created with `ocr-simple apikey` take
+// effect without a restart.
+type APIKeyStore struct {
+	path   string
+	mu     sync.Mutex
+	keys   map[string]*APIKey // by ID
+	byHash map[string]*APIKey
+	file   os.FileInfo // of the last read or write, to notice changes
+	dirty  bool        // usage changed since the last write
+}
+
+var apiKeys *APIKeyStore
+
+func newAPIKeyStore(path string) (*APIKeyStore, error) {
+	s := &APIKeyStore{path: path}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// loadLocked reads the key file if it changed since the last read
+func (s *APIKeyStore) loadLocked() error {
+	info, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		if s.keys == nil {
+			s.keys, s.byHash = map[string]*APIKey{}, map[string]*APIKey{}
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// Every save renames a new file into place, so a different inode tells a
+	// change even when the modification time did not tick
+	if s.keys != nil && s.file != nil && os.SameFile(info, s.file) &&
+		info.ModTime().Equal(s.file.ModTime()) && info.Size() == s.file.Size() {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var list []*APIKey
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("gagal membaca %s: %v", s.path, err)
+	}
+	keys, byHash := map[string]*APIKey{}, map[string]*APIKey{}
+	for _, k := range list {
+		// Pages are only counted by the server, so its counters are newer
+		// than the file's, which may predate the last flush
+		if old, ok := s.keys[k.ID]; ok {
+			k.Usage, k.LastUsedAt = old.Usage, old.LastUsedAt
+		}
+		keys[k.ID] = k
+		byHash[k.Hash] = k
+	}
+	s.keys, s.byHash = keys, byHash
+	s.file = info
+	return nil
+}
+
+// saveLocked writes the key file atomically, readable by the owner only
+func (s *APIKeyStore) saveLocked() error {
+	list := make([]*APIKey, 0, len(s.keys))
+	for _, k := range s.keys {
+		list = append(list, k)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	if info, err := os.Stat(s.path); err == nil {
+		s.file = info
+	}
+	s.dirty = false
+	return nil
+}
+
+// Flush writes usage counted since the last write to the key file
+func (s *APIKeyStore) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.dirty {
+		return
+	}
+	// Pick up keys written by `ocr-simple apikey` first, or they would be lost
+	if err := s.loadLocked(); err != nil {
+		slog.Warn("saving API key usage failed", "err", err)
+		return
+	}
+	if err := s.saveLocked(); err != nil {
+		slog.Warn("saving API key usage failed", "err", err)
+	}
+}
+
+// flushEvery writes the usage to the key file every interval
+func (s *APIKeyStore) flushEvery(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			s.Flush()
+		}
+	}()
+}
+
+// Enabled reports whether authentication is enforced, which is the case as
+// soon as a key has been created. Revoked keys count, so revoking every key
+// locks the server rather than opening it.
+func (s *APIKeyStore) Enabled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		// Fail closed: a broken key file must not disable authentication
+		return true
+	}
+	return len(s.keys) > 0
+}
+
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create adds a key and returns it with its secret, which is not stored
+func (s *APIKeyStore) Create(name string, scopes []string, daily, monthly int) (*APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", invalidField("name", "name is required")
+	}
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return nil, "", err
+	}
+	if daily < 0 || monthly < 0 {
+		return nil, "", invalidField("daily_quota", "quotas must not be negative")
+	}
+
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	secret := "ocr_" + hex.EncodeToString(b)
+	// The ID shows up in listings and error messages, so it is drawn
+	// separately rather than cut from the secret
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return nil, "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		return nil, "", err
+	}
+
+	k := &APIKey{
+		ID:           hex.EncodeToString(id),
+		Name:         name,
+		Prefix:       secret[:12],
+		Hash:         hashAPIKey(secret),
+		Scopes:       scopes,
+		DailyQuota:   daily,
+		MonthlyQuota: monthly,
+		CreatedAt:    time.Now().UTC(),
+	}
+	if _, exists := s.keys[k.ID]; exists {
+		return nil, "", newAPIError(CodeConflict, "Key ID %s already exists, try again", k.ID)
+	}
+	s.keys[k.ID] = k
+	s.byHash[k.Hash] = k
+	if err := s.saveLocked(); err != nil {
+		delete(s.keys, k.ID)
+		delete(s.byHash, k.Hash)
+		return nil, "", err
+	}
+	return k.public(), secret, nil
+}
+
+func normalizeScopes(scopes []string) ([]string, error) {
+	seen := map[string]bool{}
+	var out []string
+	for _, scope := range scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if scope == "" || seen[scope] {
+			continue
+		}
+		valid := false
+		for _, v := range validScopes {
+			valid = valid || v == scope
+		}
+		if !valid {
+			return nil, invalidField("scopes", "unknown scope %q, expected one of %s", scope, strings.Join(validScopes, ", "))
+		}
+		seen[scope] = true
+		out = append(out, scope)
+	}
+	if len(out) == 0 {
+		return nil, invalidField("scopes", "at least one scope is required")
+	}
+	return out, nil
+}
+
+// Authenticate returns the active key matching secret
+func (s *APIKeyStore) Authenticate(secret string) (*APIKey, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		return nil, false
+	}
+	k, ok := s.byHash[hashAPIKey(secret)]
+	if !ok || k.RevokedAt != nil {
+		return nil, false
+	}
+	return k.public(), true
+}
+
+// Get returns the key with id, if it exists and is not revoked
+func (s *APIKeyStore) Get(id string) (*APIKey, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		return nil, false
+	}
+	k, ok := s.keys[id]
+	if !ok || k.RevokedAt != nil {
+		return nil, false
+	}
+	return k.public(), true
+}
+
+// List returns all keys, oldest first, without their hashes
+func (s *APIKeyStore) List() []*APIKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loadLocked()
+
+	now := time.Now().UTC()
+	list := make([]*APIKey, 0, len(s.keys))
+	for _, k := range s.keys {
+		c := k.public()
+		c.Usage = c.Usage.current(now)
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// Revoke disables a key; it stays listed with its usage
+func (s *APIKeyStore) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		return err
+	}
+	k, ok := s.keys[id]
+	if !ok {
+		return newAPIError(CodeNotFound, "API key %q not found", id)
+	}
+	if k.RevokedAt == nil {
+		now := time.Now().UTC()
+		k.RevokedAt = &now
+	}
+	return s.saveLocked()
+}
+
+// CheckQuota fails with quota_exceeded when the key has used up its daily
+// or monthly pages. Requests without a key are not limited.
+func (s *APIKeyStore) CheckQuota(id string) *APIError {
+	return s.reserve(id, 0)
+}
+
+// ReservePages takes pages from the key's quota before a recognition runs,
+// failing with quota_exceeded when they are not left. Checking and counting
+// in one step keeps concurrent requests from overshooting the quota; the
+// reservation is corrected with SettleUsage once the result is known.
+func (s *APIKeyStore) ReservePages(id string, pages int) *APIError {
+	return s.reserve(id, pages)
+}
+
+func (s *APIKeyStore) reserve(id string, pages int) *APIError {
+	if id == "" {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loadLocked()
+
+	k, ok := s.keys[id]
+	if !ok {
+		return nil
+	}
+	now := time.Now().UTC()
+	usage := k.Usage.current(now)
+	// Without pages this is a check whether any page is left
+	need := max(pages, 1)
+	switch {
+	case k.DailyQuota > 0 && usage.DayPages+need > k.DailyQuota:
+		tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+		err := newAPIError(CodeQuotaExceeded, "Daily quota of %d pages used up, resets at %s", k.DailyQuota, tomorrow.Format(time.RFC3339))
+		err.retryAfter = tomorrow.Sub(now)
+		return err
+	case k.MonthlyQuota > 0 && usage.MonthPages+need > k.MonthlyQuota:
+		nextMonth := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		err := newAPIError(CodeQuotaExceeded, "Monthly quota of %d pages used up, resets at %s", k.MonthlyQuota, nextMonth.Format(time.RFC3339))
+		err.retryAfter = nextMonth.Sub(now)
+		return err
+	}
+	if pages > 0 {
+		usage.DayPages += pages
+		usage.MonthPages += pages
+		k.Usage = usage
+		s.dirty = true
+	}
+	return nil
+}
+
+// SettleUsage replaces a reservation of ReservePages with the pages the
+// recognition actually used; 0 refunds it, e.g. when OCR failed
+func (s *APIKeyStore) SettleUsage(id string, reserved, used int) {
+	if id == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loadLocked()
+
+	k, ok := s.keys[id]
+	if !ok {
+		return
+	}
+	now := time.Now().UTC()
+	// A reservation from before midnight was counted on the previous day;
+	// the counters restart at 0 and are not pushed below it
+	k.Usage = k.Usage.current(now)
+	k.Usage.DayPages = max(0, k.Usage.DayPages+used-reserved)
+	k.Usage.MonthPages = max(0, k.Usage.MonthPages+used-reserved)
+	if used > 0 {
+		k.Usage.TotalPages += used
+		k.Usage.Requests++
+		k.LastUsedAt = &now
+	}
+	s.dirty = true
+}
+
+// pageCount is the number of pages a result is billed as
+func pageCount(words []OCRWord) int {
+	pages := 1
+	for _, w := range words {
+		pages = max(pages, w.Page)
+	}
+	return pages
+}
+
+// createAPIKeyRequest is the body of POST /api/keys
+type createAPIKeyRequest struct {
+	Name         string   `json:"name"`
+	Scopes       []string `json:"scopes"`
+	DailyQuota   int      `json:"daily_quota"`
+	MonthlyQuota int      `json:"monthly_quota"`
+}
+
+func apiKeysHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string][]*APIKey{"keys": apiKeys.List()})
+}
+
+func apiCreateKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var req createAPIKeyRequest
+	if err := decodeJSONBody(w, r, 64<<10, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	key, secret, err := apiKeys.Create(req.Name, req.Scopes, req.DailyQuota, req.MonthlyQuota)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	// The secret is only ever shown here
+	writeJSON(w, http.StatusCreated, struct {
+		*APIKey
+		Key string `json:"key"`
+	}{key, secret})
+}
+
+func apiRevokeKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if err := apiKeys.Revoke(r.PathValue("id")); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// runAPIKeyCommand implements `ocr-simple apikey create|list|revoke`
+func runAPIKeyCommand(args []string) int {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, `Usage:
+  ocr-simple apikey create -name NAME [-scopes ocr,read] [-daily N] [-monthly N]
+  ocr-simple apikey list
+  ocr-simple apikey revoke ID`)
+	}
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+
+	store, err := newAPIKeyStore(apiKeysFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Error: %v\n", err)
+		return 1
+	}
+
+	switch args[0] {
+	case "create":
+		fs := flag.NewFlagSet("apikey create", flag.ContinueOnError)
+		name := fs.String("name", "", "name of the client using the key")
+		scopes := fs.String("scopes", ScopeOCR+","+ScopeRead, "comma separated: "+strings.Join(validScopes, ", "))
+		daily := fs.Int("daily", 0, "pages per day, 0 = unlimited")
+		monthly := fs.Int("monthly", 0, "pages per month, 0 = unlimited")
+		if err := fs.Parse(args[1:]); err != nil {
+			return 2
+		}
+		key, secret, err := store.Create(*name, strings.Split(*scopes, ","), *daily, *monthly)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("✅ API key %s (%s) dibuat dengan scope %s\n", key.ID, key.Name, strings.Join(key.Scopes, ","))
+		fmt.Printf("🔑 %s\n", secret)
+		fmt.Println("   Simpan key ini sekarang; key tidak dapat ditampilkan lagi.")
+
+	case "list":
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tPREFIX\tSCOPES\tTODAY\tMONTH\tTOTAL\tSTATUS")
+		for _, k := range store.List() {
+			status := "active"
+			if k.RevokedAt != nil {
+				status = "revoked"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n", k.ID, k.Name, k.Prefix, strings.Join(k.Scopes, ","),
+				quotaUsage(k.Usage.DayPages, k.DailyQuota), quotaUsage(k.Usage.MonthPages, k.MonthlyQuota), k.Usage.TotalPages, status)
+		}
+		tw.Flush()
+
+	case "revoke":
+		if len(args) != 2 {
+			usage()
+			return 2
+		}
+		if err := store.Revoke(args[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("✅ API key %s dicabut\n", args[1])
+
+	default:
+		usage()
+		return 2
+	}
+	return 0
+}
+
+func quotaUsage(used, quota int) string {
+	if quota == 0 {
+		return fmt.Sprintf("%d", used)
+	}
+	return fmt.Sprintf("%d/%d", used, quota)
+}
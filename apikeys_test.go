@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAPIKeyQuotaUnderConcurrency(t *testing.T) {
+	s, err := newAPIKeyStore(filepath.Join(t.TempDir(), "apikeys.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _, err := s.Create("backend", []string{ScopeOCR}, 5, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	granted := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if s.ReservePages(key.ID, 1) == nil {
+				mu.Lock()
+				granted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if granted != 5 {
+		t.Fatalf("%d reservations granted, want 5", granted)
+	}
+
+	// A failed recognition gives its page back
+	s.SettleUsage(key.ID, 1, 0)
+	if err := s.CheckQuota(key.ID); err != nil {
+		t.Fatalf("quota still used up after a refund: %v", err)
+	}
+	if err := s.ReservePages(key.ID, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ReservePages(key.ID, 1); err == nil || err.Code != CodeQuotaExceeded {
+		t.Fatalf("error = %v, want %s", err, CodeQuotaExceeded)
+	}
+}
+
+func TestAPIKeyUsageIsFlushed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "apikeys.json")
+	s, err := newAPIKeyStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _, err := s.Create("backend", []string{ScopeOCR}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.Stat(path)
+
+	s.ReservePages(key.ID, 1)
+	s.SettleUsage(key.ID, 1, 3)
+	if after, _ := os.Stat(path); !os.SameFile(before, after) {
+		t.Fatal("usage rewrote the key file before a flush")
+	}
+
+	s.Flush()
+	data, _ := os.ReadFile(path)
+	var list []*APIKey
+	if err := json.Unmarshal(data, &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Usage.TotalPages != 3 || list[0].Usage.DayPages != 3 || list[0].Usage.Requests != 1 {
+		t.Errorf("flushed usage = %+v", list[0].Usage)
+	}
+}
+
+func TestAPIKeyStoreSeesKeysWrittenInTheSameTick(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "apikeys.json")
+	server, err := newAPIKeyStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _, err := server.Create("first", []string{ScopeOCR}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.ReservePages(first.ID, 1)
+	server.SettleUsage(first.ID, 1, 1)
+
+	// `ocr-simple apikey create` in another process, with the clock held
+	// still so the modification time does not change
+	stat, _ := os.Stat(path)
+	cli, err := newAPIKeyStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, secret, err := cli.Create("second", []string{ScopeRead}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(path, stat.ModTime(), stat.ModTime())
+
+	if _, ok := server.Authenticate(secret); !ok {
+		t.Fatal("key created by the CLI not picked up")
+	}
+	// The flush keeps the CLI's key and the server's usage
+	server.Flush()
+	reread, _ := newAPIKeyStore(path)
+	if _, ok := reread.Get(second.ID); !ok {
+		t.Error("flush dropped the key created by the CLI")
+	}
+	for _, k := range reread.List() {
+		if k.ID == first.ID && k.Usage.TotalPages != 1 {
+			t.Errorf("usage of %s = %d pages, want 1", k.ID, k.Usage.TotalPages)
+		}
+	}
+}
+
+func TestAPIKeyIDIsNotPartOfTheSecret(t *testing.T) {
+	s, err := newAPIKeyStore(filepath.Join(t.TempDir(), "apikeys.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		key, secret, err := s.Create("k", []string{ScopeOCR}, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(key.ID) != 8 || strings.Contains(secret, key.ID) {
+			t.Fatalf("ID %q taken from the secret %q", key.ID, secret)
+		}
+	}
+}
+
+func TestKeyUsageCurrent(t *testing.T) {
+	u := KeyUsage{Day: "2024-03-31", DayPages: 7, Month: "2024-03", MonthPages: 40, TotalPages: 90}
+	if got := u.current(time.Date(2024, 3, 31, 23, 0, 0, 0, time.UTC)); got != u {
+		t.Errorf("same day: %+v", got)
+	}
+	got := u.current(time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC))
+	want := KeyUsage{Day: "2024-04-01", Month: "2024-04", TotalPages: 90}
+	if got != want {
+		t.Errorf("next month: %+v, want %+v", got, want)
+	}
+}
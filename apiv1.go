@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Recognition is the result of recognising one image
+type Recognition struct {
+	DocumentID    string     `json:"document_id,omitempty"`
+	Filename      string     `json:"filename"`
+	Text          string     `json:"text"`
+	Words         []OCRWord  `json:"words"`
+	Confidence    float64    `json:"confidence"`
+	Options       OCROptions `json:"options"`
+	EngineVersion string     `json:"engine_version,omitempty"`
+}
+
+// recognize runs OCR through run (runOCR or runOCRWithRetry), counts the
+// pages against the quota of the API key and stores the document when
+// requested
+func recognize(ctx context.Context, input recognitionInput, run func(context.Context, []byte, string, OCROptions) OCRResponse) (*Recognition, *APIError) {
+	ctx, span := tracer.Start(ctx, "ocr.recognize", trace.WithAttributes(
+		attribute.String("ocr.filename", input.Filename),
+		attribute.Int("ocr.file.size", len(input.Image)),
+		attribute.String("ocr.language", metricsLanguage(input.Options)),
+		attribute.Int("ocr.psm", input.Options.PSM),
+		attribute.String("ocr.preprocess", input.Options.Preprocess),
+		attribute.Bool("ocr.store", input.Store),
+	))
+	defer span.End()
+
+	// One page is reserved up front; multi-page images are billed the rest
+	// once their page count is known
+	if apiErr := apiKeys.ReservePages(input.KeyID, 1); apiErr != nil {
+		return nil, spanError(span, apiErr)
+	}
+
+	result := run(ctx, input.Image, input.Filename, input.Options)
+	if result.Err != nil {
+		apiKeys.SettleUsage(input.KeyID, 1, 0)
+		return nil, spanError(span, ocrError(result.Err))
+	}
+	span.SetAttributes(attribute.Int("ocr.pages", pageCount(result.Words)), attribute.Int("ocr.words", len(result.Words)))
+	apiKeys.SettleUsage(input.KeyID, 1, pageCount(result.Words))
+
+	rec := &Recognition{
+		Filename:      input.Filename,
+		Text:          result.Text,
+		Words:         result.Words,
+		Confidence:    result.Confidence,
+		Options:       result.Options,
+		EngineVersion: result.EngineVersion,
+	}
+	if rec.Words == nil {
+		rec.Words = []OCRWord{}
+	}
+
+	if input.Store {
+		doc, err := docStore.Add(input.Filename, input.Image, result, input.Details)
+		if err != nil {
+			slog.WarnContext(ctx, "storing document failed", "filename", input.Filename, "err", err)
+		} else {
+			rec.DocumentID = doc.ID
+		}
+	}
+	return rec, nil
+}
+
+func apiV1RecognizeHandler(w http.ResponseWriter, r *http.Request) {
+	if !engineAvailable() {
+		writeError(w, r, errEngineUnavailable)
+		return
+	}
+
+	input, apiErr := readRecognitionInput(w, r)
+	if apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+
+	rec, apiErr := recognize(r.Context(), input, runOCR)
+	if apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+	writeJSON(w, http.StatusOK, rec)
+}
+
+func apiV1CreateJobHandler(w http.ResponseWriter, r *http.Request) {
+	if !engineAvailable() {
+		writeError(w, r, errEngineUnavailable)
+		return
+	}
+
+	input, apiErr := readRecognitionInput(w, r)
+	if apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+
+	// Fail now rather than in the job when the quota is already used up
+	if apiErr := apiKeys.CheckQuota(input.KeyID); apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+
+	job, ok := jobStore.Create(input.Filename, input.KeyID)
+	if !ok {
+		writeError(w, r, newAPIError(CodeQueueFull, "Too many pending jobs, please try again later"))
+		return
+	}
+	jobStore.Run(r.Context(), job.ID, input)
+
+	w.Header().Set("Location", "/api/v1/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+func apiV1JobHandler(w http.ResponseWriter, r *http.Request) {
+	// Jobs are only visible to the key that created them
+	job, ok := jobStore.Get(r.PathValue("id"))
+	if !ok || job.KeyID != apiKeyIDFrom(r.Context()) {
+		writeError(w, r, newAPIError(CodeNotFound, "Job not found"))
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func apiV1LanguagesHandler(w http.ResponseWriter, r *http.Request) {
+	path, _, ok := currentEngine()
+	if !ok {
+		writeError(w, r, errEngineUnavailable)
+		return
+	}
+
+	langs, err := listTesseractLanguages(path)
+	if err != nil {
+		slog.WarnContext(r.Context(), "listing Tesseract languages failed", "err", err)
+		writeError(w, r, newAPIError(CodeInternal, "Failed to list Tesseract languages"))
+		return
+	}
+	if langs == nil {
+		langs = []string{}
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"languages": langs})
+}
+
+// HealthStatus is the body of GET /api/v1/health
+type HealthStatus struct {
+	Status    string `json:"status"`
+	Tesseract struct {
+		Available bool   `json:"available"`
+		Path      string `json:"path,omitempty"`
+		Version   string `json:"version,omitempty"`
+	} `json:"tesseract"`
+	Documents int `json:"documents"`
+	Queue     struct {
+		Length   int `json:"length"`
+		Capacity int `json:"capacity"`
+	} `json:"queue"`
+}
+
+func apiV1HealthHandler(w http.ResponseWriter, r *http.Request) {
+	var health HealthStatus
+	health.Status = "ok"
+	health.Tesseract.Path, health.Tesseract.Version, health.Tesseract.Available = currentEngine()
+	health.Documents = len(docStore.List())
+	health.Queue.Length = len(ocrWorkerPool)
+	health.Queue.Capacity = cap(ocrWorkerPool)
+
+	status := http.StatusOK
+	if !health.Tesseract.Available {
+		health.Status = "unavailable"
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, health)
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	sessionCookie = "ocr_session"
+	sessionTTL    = 12 * time.Hour
+)
+
+// Session is a browser login; it acts with the scopes of the key used to
+// log in and ends when that key is revoked. A JWT login keeps the verified
+// caller in Key and ends when the token expires.
+type Session struct {
+	KeyID     string
+	Key       *APIKey
+	ExpiresAt time.Time
+}
+
+// SessionStore keeps browser sessions in memory; a restart logs everyone out
+type SessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]Session
+}
+
+var sessions = &SessionStore{sessions: make(map[string]Session)}
+
+func (s *SessionStore) Create(key *APIKey) string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	id := hex.EncodeToString(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for sid, sess := range s.sessions {
+		if now.After(sess.ExpiresAt) {
+			delete(s.sessions, sid)
+		}
+	}
+	sess := Session{KeyID: key.ID, ExpiresAt: now.Add(sessionTTL)}
+	if !key.expiresAt.IsZero() {
+		sess.Key = key
+		if key.expiresAt.Before(sess.ExpiresAt) {
+			sess.ExpiresAt = key.expiresAt
+		}
+	}
+	s.sessions[id] = sess
+	return id
+}
+
+func (s *SessionStore) Get(id string) (Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[id]
+	if !ok || time.Now().After(sess.ExpiresAt) {
+		delete(s.sessions, id)
+		return Session{}, false
+	}
+	return sess, true
+}
+
+func (s *SessionStore) Delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+}
+
+// requiredScope returns the scope needed for a request, or "" for pages that
+// stay public: login, health probes, the version and the API description.
+// The setup page shows paths, versions and directories of the server, so
+// it needs admin once authentication is on.
+func requiredScope(r *http.Request) string {
+	path := r.URL.Path
+	switch {
+	case path == "/login" || path == "/logout" ||
+		path == "/healthz" || path == "/readyz" || path == "/api/version" ||
+		path == "/api/v1/health" || path == "/api/v1/openapi.json":
+		return ""
+	case path == "/api/keys" || strings.HasPrefix(path, "/api/keys/") || path == "/api/diagnostics" ||
+		path == "/setup" || strings.HasPrefix(path, "/api/engine/"):
+		return ScopeAdmin
+	case path == "/" || path == "/upload" ||
+		path == "/api/v1/recognize" || strings.HasPrefix(path, "/api/v1/jobs"):
+		return ScopeOCR
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return ScopeRead
+	default:
+		return ScopeWrite
+	}
+}
+
+var errInvalidAPIKey = errors.New("API key is invalid or revoked")
+
+// authEnabled reports whether requests need credentials: once an API key
+// exists or JWT validation is configured
+func authEnabled() bool {
+	return jwtVerifier != nil || apiKeys.Enabled()
+}
+
+// authenticateToken checks a bearer token, which is a JWT when JWT
+// validation is configured and the token looks like one, else an API key
+func authenticateToken(token string) (*APIKey, error) {
+	if jwtVerifier != nil && looksLikeJWT(token) {
+		return jwtVerifier.Verify(token)
+	}
+	key, ok := apiKeys.Authenticate(token)
+	if !ok {
+		return nil, errInvalidAPIKey
+	}
+	return key, nil
+}
+
+// withAuth requires an API key or JWT, given as "Authorization: Bearer
+// <token>" or "X-API-Key: <key>", or a session cookie once at least one key
+// exists or JWT validation is configured. Otherwise the server stays open
+// as before.
+func withAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope := requiredScope(r)
+		if scope == "" || !authEnabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, viaSession, err := authenticateRequest(r)
+		if key == nil {
+			if !wantsJSON(r) {
+				http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+				return
+			}
+			if err != nil {
+				writeError(w, r, newAPIError(CodeUnauthorized, "Authentication failed: %v", err))
+				return
+			}
+			writeError(w, r, newAPIError(CodeUnauthorized, "A valid API key or token is required, send it as \"Authorization: Bearer <token>\""))
+			return
+		}
+		if !key.HasScope(scope) {
+			writeError(w, r, newAPIError(CodeForbidden, "Caller %s does not have the %q scope", key.ID, scope))
+			return
+		}
+
+		// Form posts from the pages carry the session cookie; only accept
+		// them from this site
+		if viaSession && r.Method != http.MethodGet && r.Method != http.MethodHead && !sameOrigin(r) {
+			writeError(w, r, newAPIError(CodeForbidden, "Cross-site request rejected"))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey, key)))
+	})
+}
+
+// authenticateRequest returns the caller of the request and whether it came
+// from a session cookie; err tells why sent credentials were rejected
+func authenticateRequest(r *http.Request) (*APIKey, bool, error) {
+	secret := r.Header.Get("X-API-Key")
+	if auth := r.Header.Get("Authorization"); secret == "" && auth != "" {
+		if scheme, token, ok := strings.Cut(auth, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			secret = strings.TrimSpace(token)
+		}
+	}
+	if secret != "" {
+		key, err := authenticateToken(secret)
+		return key, false, err
+	}
+
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil, false, nil
+	}
+	sess, ok := sessions.Get(cookie.Value)
+	if !ok {
+		return nil, false, nil
+	}
+	if sess.Key != nil {
+		return sess.Key, true, nil
+	}
+	key, ok := apiKeys.Get(sess.KeyID)
+	if !ok {
+		sessions.Delete(cookie.Value)
+		return nil, false, nil
+	}
+	return key, true, nil
+}
+
+// sameOrigin checks the Origin or Referer header of a browser request
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		origin = r.Header.Get("Referer")
+	}
+	if origin == "" {
+		// Not sent by some privacy settings; the SameSite cookie still applies
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+// apiKeyFrom returns the key the request was authenticated with, if any
+func apiKeyFrom(ctx context.Context) *APIKey {
+	key, _ := ctx.Value(apiKeyContextKey).(*APIKey)
+	return key
+}
+
+// apiKeyIDFrom returns the ID of the key the request was authenticated
+// with, or "" when authentication is off
+func apiKeyIDFrom(ctx context.Context) string {
+	if key := apiKeyFrom(ctx); key != nil {
+		return key.ID
+	}
+	return ""
+}
+
+// safeRedirect keeps login redirects on this site
+func safeRedirect(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	next := safeRedirect(r.FormValue("next"))
+
+	data := struct {
+		Next    string
+		Error   string
+		Enabled bool
+	}{Next: next, Enabled: authEnabled()}
+
+	if r.Method == http.MethodPost {
+		key, err := authenticateToken(strings.TrimSpace(r.PostFormValue("key")))
+		if err == nil {
+			http.SetCookie(w, &http.Cookie{
+				Name:     sessionCookie,
+				Value:    sessions.Create(key),
+				Path:     "/",
+				MaxAge:   int(sessionTTL.Seconds()),
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteLaxMode,
+			})
+			http.Redirect(w, r, next, http.StatusSeeOther)
+			return
+		}
+		data.Error = "API key atau token tidak valid: " + err.Error()
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+
+	tmpl, exists := cachedTemplate("login")
+	if !exists {
+		writeError(w, r, errTemplateNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	tmpl.Execute(w, data)
+}
+
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		sessions.Delete(cookie.Value)
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "", Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+const loginTmpl = `
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>OCR Simple - Masuk</title>
+    <style>
+        * { box-sizing: border-box; }
+        body { font-family: Arial, sans-serif; padding: 15px; background: #f5f5f5; margin: 0; }
+        .container { max-width: 420px; margin: 60px auto; background: white; padding: 24px; border-radius: 4px; box-shadow: 0 2px 4px rgba(0,0,0,0.1); }
+        h1 { margin: 0 0 15px; font-size: 1.5em; color: #333; }
+        p { color: #666; font-size: 0.9em; }
+        input[type="password"] { width: 100%; padding: 8px; border: 1px solid #ccc; border-radius: 3px; font-size: 14px; margin-bottom: 12px; font-family: monospace; }
+        .btn { background: #007bff; color: white; border: none; padding: 8px 16px; border-radius: 3px; cursor: pointer; font-size: 14px; width: 100%; }
+        .btn:hover { background: #0056b3; }
+        .error { background: #f8d7da; border: 1px solid #f5c6cb; color: #721c24; padding: 8px 12px; border-radius: 4px; margin-bottom: 12px; }
+        code { background: #f8f9fa; padding: 1px 4px; border-radius: 3px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <h1>🔐 Masuk</h1>
+        {{if .Error}}<div class="error">{{.Error}}</div>{{end}}
+        {{if .Enabled}}
+        <form method="POST" action="/login">
+            <input type="hidden" name="next" value="{{.Next}}">
+            <input type="password" name="key" placeholder="ocr_... atau token JWT" autocomplete="current-password" required autofocus>
+            <button type="submit" class="btn">Masuk</button>
+        </form>
+        <p>Masuk dengan API key atau token JWT Anda. Sesi berlaku 12 jam, atau sampai token kedaluwarsa; halaman yang bisa dibuka mengikuti scope key atau role token tersebut.</p>
+        {{else}}
+        <p>Autentikasi belum aktif karena belum ada API key. Buat key pertama dengan
+        <code>ocr-simple apikey create -name admin -scopes admin</code>.</p>
+        <p><a href="/">← Kembali ke OCR</a></p>
+        {{end}}
+    </div>
+</body>
+</html>`
+
+// grpcUnaryAuth and grpcStreamAuth require a key or JWT with the ocr scope
+// for the OCR service, sent as "authorization: Bearer <token>" or
+// "x-api-key" metadata.
+// Health checks and reflection stay open.
+func grpcUnaryAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := grpcAuthenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func grpcStreamAuth(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := grpcAuthenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, requestIDStream{ss, ctx})
+}
+
+func grpcAuthenticate(ctx context.Context, method string) (context.Context, error) {
+	if strings.HasPrefix(method, "/grpc.") || !authEnabled() {
+		return ctx, nil
+	}
+
+	var secret string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("x-api-key"); len(v) > 0 {
+			secret = v[0]
+		} else if v := md.Get("authorization"); len(v) > 0 {
+			if scheme, token, ok := strings.Cut(v[0], " "); ok && strings.EqualFold(scheme, "Bearer") {
+				secret = strings.TrimSpace(token)
+			}
+		}
+	}
+	if secret == "" {
+		return nil, grpcError(ctx, newAPIError(CodeUnauthorized, "A valid API key or token is required, send it as \"authorization: Bearer <token>\" metadata"))
+	}
+	key, err := authenticateToken(secret)
+	if err != nil {
+		return nil, grpcError(ctx, newAPIError(CodeUnauthorized, "Authentication failed: %v", err))
+	}
+	if !key.HasScope(ScopeOCR) {
+		return nil, grpcError(ctx, newAPIError(CodeForbidden, "Caller %s does not have the %q scope", key.ID, ScopeOCR))
+	}
+	return context.WithValue(ctx, apiKeyContextKey, key), nil
+}
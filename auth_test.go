@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequiredScope(t *testing.T) {
+	tests := []struct {
+		method, path, scope string
+	}{
+		{"GET", "/login", ""},
+		{"GET", "/healthz", ""},
+		{"GET", "/api/v1/openapi.json", ""},
+		// The setup page shows server paths and versions
+		{"GET", "/setup", ScopeAdmin},
+		{"POST", "/api/engine/detect", ScopeAdmin},
+		{"GET", "/api/keys", ScopeAdmin},
+		{"GET", "/", ScopeOCR},
+		{"POST", "/api/v1/recognize", ScopeOCR},
+		{"GET", "/documents", ScopeRead},
+		{"DELETE", "/api/documents/1", ScopeWrite},
+	}
+	for _, tt := range tests {
+		if got := requiredScope(httptest.NewRequest(tt.method, tt.path, nil)); got != tt.scope {
+			t.Errorf("%s %s: scope %q, want %q", tt.method, tt.path, got, tt.scope)
+		}
+	}
+}
+
+func TestSetupPageNeedsAdminOnceAuthIsOn(t *testing.T) {
+	page := withAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	get := func(header string) int {
+		r := httptest.NewRequest(http.MethodGet, "/setup", nil)
+		r.Header.Set("Accept", "application/json")
+		if header != "" {
+			r.Header.Set("Authorization", "Bearer "+header)
+		}
+		w := httptest.NewRecorder()
+		page.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	old := apiKeys
+	t.Cleanup(func() { apiKeys = old })
+	var err error
+	if apiKeys, err = newAPIKeyStore(t.TempDir() + "/apikeys.json"); err != nil {
+		t.Fatal(err)
+	}
+	if code := get(""); code != http.StatusOK {
+		t.Errorf("without keys: status %d, want 200", code)
+	}
+
+	_, reader, _ := apiKeys.Create("reader", []string{ScopeOCR, ScopeRead}, 0, 0)
+	_, admin, _ := apiKeys.Create("admin", []string{ScopeAdmin}, 0, 0)
+	for secret, want := range map[string]int{"": http.StatusUnauthorized, reader: http.StatusForbidden, admin: http.StatusOK} {
+		if code := get(secret); code != want {
+			t.Errorf("key %q: status %d, want %d", secret, code, want)
+		}
+	}
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// batchManifestFile is the checkpoint written into the batch root unless
+// -manifest says otherwise
+const batchManifestFile = ".ocr-batch.jsonl"
+
+// batchEntry is one line of the checkpoint manifest, written as soon as a
+// file is finished. A rerun skips files whose last entry is "done" and whose
+// size and modification time have not changed.
+type batchEntry struct {
+	File       string    `json:"file"` // relative to the batch root
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"mod_time"`
+	Status     string    `json:"status"` // done or failed
+	Outputs    []string  `json:"outputs,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	At         time.Time `json:"at"`
+}
+
+// batchFile is an image found by the walk and where its results go
+type batchFile struct {
+	path, rel    string
+	size         int64
+	modTime      time.Time
+	txt, jsonOut string
+}
+
+func (f batchFile) unchangedSince(e batchEntry) bool {
+	return e.Size == f.size && e.ModTime.Equal(f.modTime)
+}
+
+// batchReport sums up a run
+type batchReport struct {
+	mu        sync.Mutex
+	found     int
+	skipped   int
+	oldFailed int // skipped, but failed in an earlier run
+	succeeded int
+	failed    int
+	bytes     int64
+	failures  []batchEntry
+	start     time.Time
+}
+
+func (r *batchReport) add(e batchEntry, size int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e.Status == "done" {
+		r.succeeded++
+		r.bytes += size
+	} else {
+		r.failed++
+		r.failures = append(r.failures, e)
+	}
+}
+
+// runBatchCommand implements `ocr-simple batch DIR`: every image below DIR
+// is recognised once, with sidecars next to it or under -out
+func runBatchCommand(args []string) int {
+	fs := flag.NewFlagSet("batch", flag.ContinueOnError)
+	lang := fs.String("lang", "", "language codes, e.g. eng or ind+eng")
+	psm := fs.String("psm", "", "page segmentation mode 0-13")
+	preprocess := fs.String("preprocess", "", "grayscale or threshold")
+	out := fs.String("out", "", "directory for the .txt and .json results, mirroring DIR; next to the images when empty")
+	manifestPath := fs.String("manifest", "", "checkpoint manifest (default DIR/"+batchManifestFile+")")
+	concurrency := fs.Int("concurrency", 0, "images recognised at the same time (default ocr.workers)")
+	retryFailed := fs.Bool("retry-failed", false, "recognise files that failed in an earlier run again")
+	configFile := fs.String("config", "", "config file, YAML or TOML (env OCR_CONFIG)")
+	tesseract := fs.String("tesseract", "", "Tesseract executable, instead of ocr.tesseract_paths")
+	verbose := fs.Bool("v", false, "log each recognition to stderr")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ocr-simple batch [flags] DIR")
+		fs.PrintDefaults()
+	}
+	dirs, err := parseInterspersed(fs, args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if len(dirs) != 1 {
+		fs.Usage()
+		return 2
+	}
+	root := dirs[0]
+	opts, err := parseOCROptions(*lang, *psm, *preprocess)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Error: %v\n", err)
+		return 2
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		fmt.Fprintf(os.Stderr, "❌ Error: %s is not a directory\n", root)
+		return 2
+	}
+	if *manifestPath == "" {
+		*manifestPath = filepath.Join(root, batchManifestFile)
+	}
+
+	if err := setupCLI(*configFile, *tesseract, *verbose); err != nil {
+		return cliSetupFailed(err)
+	}
+	if *concurrency <= 0 {
+		*concurrency = config.Workers
+	}
+
+	files, err := walkBatch(root, *out)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Error: %v\n", err)
+		return 1
+	}
+	previous, err := readBatchManifest(*manifestPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Error: reading %s: %v\n", *manifestPath, err)
+		return 1
+	}
+	manifest, err := os.OpenFile(*manifestPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Error: %v\n", err)
+		return 1
+	}
+	defer manifest.Close()
+
+	report := &batchReport{found: len(files), start: time.Now()}
+	var todo []batchFile
+	for _, f := range files {
+		if e, ok := previous[f.rel]; ok && f.unchangedSince(e) && (e.Status == "done" || !*retryFailed) {
+			report.skipped++
+			if e.Status != "done" {
+				report.oldFailed++
+			}
+			continue
+		}
+		todo = append(todo, f)
+	}
+	fmt.Fprintf(os.Stderr, "🔎 %d images found, %d finished in an earlier run, %d to recognise with %d workers\n",
+		report.found, report.skipped, len(todo), *concurrency)
+
+	// Ctrl+C lets the running recognitions finish, so the manifest is exact
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	interrupted, err := recogniseBatch(ctx, todo, opts, *concurrency, manifest, report)
+	report.print(*manifestPath)
+	switch {
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "❌ Error: writing %s: %v\nStopped, as a later run could not tell which files are done\n", *manifestPath, err)
+		return 1
+	case interrupted:
+		return 130
+	case report.failed > 0:
+		return 1
+	}
+	return 0
+}
+
+// recogniseBatch recognises todo with concurrency workers and appends an
+// entry to manifest as each file finishes. It stops handing out files when
+// ctx is cancelled or an entry cannot be written, and returns the write
+// error: files missing from the checkpoint are recognised again on resume.
+func recogniseBatch(ctx context.Context, todo []batchFile, opts OCROptions, concurrency int, manifest io.Writer, report *batchReport) (interrupted bool, err error) {
+	ctx, fail := context.WithCancelCause(ctx)
+	defer fail(nil)
+
+	var manifestMu sync.Mutex
+	var manifestErr error
+	jobs := make(chan batchFile)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range jobs {
+				e := processBatchFile(f, opts)
+				if e.Status != "done" && ctx.Err() != nil {
+					// Ctrl+C reaches Tesseract too; the file is done again on resume
+					continue
+				}
+				data, _ := json.Marshal(e)
+				manifestMu.Lock()
+				if _, err := manifest.Write(append(data, '\n')); err != nil && manifestErr == nil {
+					manifestErr = err
+					fail(err)
+				}
+				manifestMu.Unlock()
+				report.add(e, f.size)
+				if e.Status != "done" {
+					fmt.Fprintf(os.Stderr, "❌ %s: %s\n", f.rel, e.Error)
+				}
+			}
+		}()
+	}
+
+	progress := time.NewTicker(10 * time.Second)
+	defer progress.Stop()
+dispatch:
+	for _, f := range todo {
+		for {
+			select {
+			case jobs <- f:
+				continue dispatch
+			case <-progress.C:
+				report.printProgress(len(todo))
+			case <-ctx.Done():
+				interrupted = true
+				break dispatch
+			}
+		}
+	}
+	close(jobs)
+	if interrupted && errors.Is(context.Cause(ctx), context.Canceled) {
+		fmt.Fprintln(os.Stderr, "⏸️  Interrupted, waiting for the running recognitions; run the same command again to resume")
+	}
+	wg.Wait()
+	if manifestErr != nil {
+		return false, manifestErr
+	}
+	return interrupted, nil
+}
+
+// walkBatch lists the images below root in lexical order, skipping hidden
+// files and directories and the output directory. Images sharing a name
+// apart from the extension get their sidecars named after the full name.
+func walkBatch(root, out string) ([]batchFile, error) {
+	outAbs := ""
+	if out != "" {
+		outAbs, _ = filepath.Abs(out)
+	}
+	taken := map[string]bool{}
+	var files []batchFile
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  %v\n", err)
+			return nil
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path == root {
+				return nil
+			}
+			if abs, _ := filepath.Abs(path); strings.HasPrefix(name, ".") || abs == outAbs {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(name, ".") || !d.Type().IsRegular() || !isValidImageType(name) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(root, path)
+		dir := filepath.Dir(path)
+		if out != "" {
+			dir = filepath.Join(out, filepath.Dir(rel))
+		}
+		base := filepath.Join(dir, strings.TrimSuffix(name, filepath.Ext(name)))
+		if taken[base] {
+			base = filepath.Join(dir, name)
+		}
+		taken[base] = true
+		files = append(files, batchFile{
+			path: path, rel: filepath.ToSlash(rel),
+			size: info.Size(), modTime: info.ModTime(),
+			txt: base + ".txt", jsonOut: base + ".json",
+		})
+		return nil
+	})
+	return files, err
+}
+
+// readBatchManifest returns the last entry of every file in the manifest
+func readBatchManifest(path string) (map[string]batchEntry, error) {
+	entries := map[string]batchEntry{}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e batchEntry
+		// A line cut short by a crash is skipped, the file is done again
+		if json.Unmarshal(scanner.Bytes(), &e) == nil && e.File != "" {
+			entries[e.File] = e
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// processBatchFile recognises one image with the same code path as the
+// server's workers and writes its sidecars
+func processBatchFile(f batchFile, opts OCROptions) batchEntry {
+	start := time.Now()
+	e := batchEntry{File: f.rel, Size: f.size, ModTime: f.modTime, Status: "failed"}
+	defer func() {
+		e.DurationMS = time.Since(start).Milliseconds()
+		e.At = time.Now()
+	}()
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		e.Error = err.Error()
+		return e
+	}
+	result := processOCRRequest(context.Background(), data, filepath.Base(f.path), opts)
+	if result.Err != nil {
+		e.Error = result.Err.Error()
+		return e
+	}
+
+	rec := &Recognition{
+		Filename:      f.rel,
+		Text:          result.Text,
+		Words:         result.Words,
+		Confidence:    result.Confidence,
+		Options:       result.Options,
+		EngineVersion: result.EngineVersion,
+	}
+	if err := os.MkdirAll(filepath.Dir(f.txt), 0o755); err != nil {
+		e.Error = err.Error()
+		return e
+	}
+	if err := writeSidecarFiles(f.txt, f.jsonOut, rec); err != nil {
+		e.Error = err.Error()
+		return e
+	}
+	e.Status, e.Outputs = "done", []string{f.txt, f.jsonOut}
+	return e
+}
+
+func (r *batchReport) printProgress(total int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	done := r.succeeded + r.failed
+	rate := float64(done) / time.Since(r.start).Seconds()
+	eta := "-"
+	if rate > 0 {
+		eta = (time.Duration(float64(total-done)/rate) * time.Second).Round(time.Second).String()
+	}
+	fmt.Fprintf(os.Stderr, "⏳ %d/%d (%d failed), %.1f images/s, about %s left\n", done, total, r.failed, rate, eta)
+}
+
+// print writes the final report to stdout
+func (r *batchReport) print(manifest string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	elapsed := time.Since(r.start)
+	secs := elapsed.Seconds()
+	fmt.Printf("📊 Batch report (%s)\n", elapsed.Round(time.Millisecond))
+	fmt.Printf("   Found:      %d images\n", r.found)
+	fmt.Printf("   Skipped:    %d (finished in an earlier run", r.skipped)
+	if r.oldFailed > 0 {
+		fmt.Printf(", %d of them failed; retry with -retry-failed", r.oldFailed)
+	}
+	fmt.Println(")")
+	fmt.Printf("   Succeeded:  %d\n", r.succeeded)
+	fmt.Printf("   Failed:     %d\n", r.failed)
+	if done := r.succeeded + r.failed; done > 0 && secs > 0 {
+		fmt.Printf("   Throughput: %.1f images/s, %.2f MB/s\n", float64(done)/secs, float64(r.bytes)/secs/(1<<20))
+	}
+	fmt.Printf("   Manifest:   %s\n", manifest)
+	if r.failed > 0 {
+		fmt.Println("❌ Failed files (run again with -retry-failed to retry them):")
+		for i, e := range r.failures {
+			if i == 20 {
+				fmt.Printf("   ... and %d more, see the manifest\n", len(r.failures)-i)
+				break
+			}
+			fmt.Printf("   %s: %s\n", e.File, e.Error)
+		}
+	}
+}
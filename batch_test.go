@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// fakeTesseract writes a Tesseract stand-in that recognises the last line
+// of an image, one page per "|"-separated part, and appends it to
+// dir/calls. Images whose last line contains "bad" fail while dir/broken
+// exists.
+func fakeTesseract(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	script := `#!/bin/sh
+dir=$(dirname "$0")
+case "$1" in
+--version) echo "tesseract 5.3.0"; exit 0;;
+--list-langs) echo 'List of available languages in "/tessdata/" (1):'; echo eng; exit 0;;
+esac
+name=$(tail -n 1 "$1")
+echo "$name" >> "$dir/calls"
+case "$name" in *bad*) if [ -e "$dir/broken" ]; then echo "Error: image file cannot be read" >&2; exit 1; fi;; esac
+printf 'level\tpage_num\tblock_num\tpar_num\tline_num\tword_num\tleft\ttop\twidth\theight\tconf\ttext\n'
+echo "$name" | tr '|' '\n' | awk '{ printf "5\t%d\t1\t1\t1\t1\t0\t0\t10\t10\t90\t%s\n", NR, $0 }'
+`
+	path := filepath.Join(dir, "tesseract")
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// recognised returns the images the fake Tesseract was run on, sorted as
+// the workers finish in any order, and forgets them
+func recognised(t *testing.T, tesseract string) []string {
+	t.Helper()
+	calls := filepath.Join(filepath.Dir(tesseract), "calls")
+	data, _ := os.ReadFile(calls)
+	os.Remove(calls)
+	names := strings.Fields(string(data))
+	sort.Strings(names)
+	return names
+}
+
+// writeBatchImage writes a PNG whose last line names it for the fake Tesseract
+func writeBatchImage(t *testing.T, path, name string) {
+	t.Helper()
+	os.MkdirAll(filepath.Dir(path), 0o755)
+	if err := os.WriteFile(path, append(append([]byte{}, testPNG[:8]...), "\n"+name+"\n"...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// runBatch runs `ocr-simple batch` through runCLI
+func runBatch(t *testing.T, args ...string) int {
+	t.Helper()
+	return runCLI(t, runBatchCommand, args...)
+}
+
+func TestBatchResume(t *testing.T) {
+	tesseract := fakeTesseract(t)
+	root := t.TempDir()
+	writeBatchImage(t, filepath.Join(root, "a.png"), "a.png")
+	writeBatchImage(t, filepath.Join(root, "sub", "b.png"), "b.png")
+	writeBatchImage(t, filepath.Join(root, ".hidden", "c.png"), "c.png")
+	os.WriteFile(filepath.Join(root, "notes.txt"), []byte("not an image"), 0o644)
+
+	if code := runBatch(t, "-tesseract", tesseract, root); code != 0 {
+		t.Fatalf("first run: exit %d", code)
+	}
+	if got, want := recognised(t, tesseract), []string{"a.png", "b.png"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("first run recognised %v, want %v", got, want)
+	}
+	if text, _ := os.ReadFile(filepath.Join(root, "sub", "b.txt")); string(text) != "b.png" {
+		t.Errorf("sub/b.txt = %q", text)
+	}
+
+	// A rerun skips finished files, a changed file is recognised again
+	if code := runBatch(t, "-tesseract", tesseract, root); code != 0 {
+		t.Fatalf("second run: exit %d", code)
+	}
+	if got := recognised(t, tesseract); len(got) != 0 {
+		t.Errorf("second run recognised %v, want nothing", got)
+	}
+	writeBatchImage(t, filepath.Join(root, "sub", "b.png"), "b.png-edited")
+	if code := runBatch(t, "-tesseract", tesseract, root); code != 0 {
+		t.Fatalf("third run: exit %d", code)
+	}
+	if got, want := recognised(t, tesseract), []string{"b.png-edited"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after an edit recognised %v, want %v", got, want)
+	}
+
+	entries, err := readBatchManifest(filepath.Join(root, batchManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries["a.png"].Status != "done" || entries["sub/b.png"].Status != "done" {
+		t.Errorf("manifest = %+v", entries)
+	}
+}
+
+func TestBatchRetryFailed(t *testing.T) {
+	tesseract := fakeTesseract(t)
+	broken := filepath.Join(filepath.Dir(tesseract), "broken")
+	os.WriteFile(broken, nil, 0o644)
+	root := t.TempDir()
+	writeBatchImage(t, filepath.Join(root, "good.png"), "good.png")
+	writeBatchImage(t, filepath.Join(root, "bad.png"), "bad.png")
+	manifest := filepath.Join(t.TempDir(), "run.jsonl")
+
+	if code := runBatch(t, "-tesseract", tesseract, "-manifest", manifest, root); code != 1 {
+		t.Fatalf("run with a failure: exit %d, want 1", code)
+	}
+	recognised(t, tesseract)
+	if entries, _ := readBatchManifest(manifest); entries["bad.png"].Status != "failed" || entries["bad.png"].Error == "" {
+		t.Fatalf("bad.png = %+v", entries["bad.png"])
+	}
+
+	// Failures are not retried by default, even once the cause is gone
+	os.Remove(broken)
+	if code := runBatch(t, "-tesseract", tesseract, "-manifest", manifest, root); code != 0 {
+		t.Fatalf("rerun: exit %d", code)
+	}
+	if got := recognised(t, tesseract); len(got) != 0 {
+		t.Errorf("rerun recognised %v, want nothing", got)
+	}
+
+	// Flags may follow the directory
+	if code := runBatch(t, "-tesseract", tesseract, root, "-manifest", manifest, "-retry-failed"); code != 0 {
+		t.Fatalf("-retry-failed: exit %d", code)
+	}
+	if got, want := recognised(t, tesseract), []string{"bad.png"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("-retry-failed recognised %v, want %v", got, want)
+	}
+	if entries, _ := readBatchManifest(manifest); entries["bad.png"].Status != "done" {
+		t.Errorf("bad.png after the retry = %+v", entries["bad.png"])
+	}
+}
+
+func TestBatchUsage(t *testing.T) {
+	tesseract := fakeTesseract(t)
+	file := filepath.Join(t.TempDir(), "a.png")
+	writeBatchImage(t, file, "a.png")
+
+	tests := []struct {
+		args []string
+		code int
+	}{
+		{nil, 2},
+		{[]string{t.TempDir(), t.TempDir()}, 2},
+		{[]string{file}, 2},
+		{[]string{"-psm", "99", t.TempDir()}, 2},
+		{[]string{"-tesseract", filepath.Join(t.TempDir(), "missing"), t.TempDir()}, 3},
+		{[]string{"-tesseract", tesseract, t.TempDir()}, 0},
+	}
+	for _, tt := range tests {
+		if code := runBatch(t, tt.args...); code != tt.code {
+			t.Errorf("batch %v: exit %d, want %d", tt.args, code, tt.code)
+		}
+	}
+}
+
+func TestWalkBatchOutputs(t *testing.T) {
+	root := t.TempDir()
+	out := filepath.Join(root, "results")
+	for _, rel := range []string{"scan.jpg", "scan.png", "sub/page.tif", "results/old.png"} {
+		writeBatchImage(t, filepath.Join(root, rel), rel)
+	}
+
+	files, err := walkBatch(root, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, f := range files {
+		got[f.rel] = f.txt
+	}
+	want := map[string]string{
+		"scan.jpg": filepath.Join(out, "scan.txt"),
+		// The same stem as scan.jpg, so the sidecar keeps the extension
+		"scan.png":     filepath.Join(out, "scan.png.txt"),
+		"sub/page.tif": filepath.Join(out, "sub", "page.txt"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sidecars = %v, want %v", got, want)
+	}
+}
+
+func TestReadBatchManifest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.jsonl")
+	if entries, err := readBatchManifest(path); err != nil || len(entries) != 0 {
+		t.Fatalf("missing manifest: %v, %v", entries, err)
+	}
+
+	os.WriteFile(path, []byte(`{"file":"a.png","size":10,"status":"failed","error":"boom"}
+{"file":"b.png","size":20,"status":"done"}
+{"file":"a.png","size":10,"status":"done"}
+{"size":5,"status":"done"}
+{"file":"c.png","size":30,"sta`), 0o644)
+	entries, err := readBatchManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The last entry counts; a line cut short by a crash is ignored
+	if len(entries) != 2 || entries["a.png"].Status != "done" || entries["b.png"].Size != 20 {
+		t.Errorf("entries = %+v", entries)
+	}
+}
+
+// failingWriter fails every write, like a checkpoint on a full disk
+type failingWriter struct{ writes int }
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return 0, errors.New("no space left on device")
+}
+
+// A checkpoint that cannot be written stops the run instead of recognising
+// files that a resume would not know about
+func TestBatchStopsWhenManifestFails(t *testing.T) {
+	tesseract := startTestWorkers(t)
+	root := t.TempDir()
+	for i := 0; i < 20; i++ {
+		writeBatchImage(t, filepath.Join(root, fmt.Sprintf("%02d.png", i)), fmt.Sprintf("%02d.png", i))
+	}
+	files, err := walkBatch(root, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest := &failingWriter{}
+	report := &batchReport{found: len(files)}
+	oldStderr := os.Stderr
+	os.Stderr, _ = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	interrupted, err := recogniseBatch(context.Background(), files, OCROptions{}, 1, manifest, report)
+	os.Stderr.Close()
+	os.Stderr = oldStderr
+
+	if err == nil || !strings.Contains(err.Error(), "no space left") || interrupted {
+		t.Errorf("recogniseBatch = %v, %v; want the write error", interrupted, err)
+	}
+	if got := recognised(t, tesseract); len(got) >= len(files) {
+		t.Errorf("recognised all %d files after the checkpoint failed", len(got))
+	}
+	if manifest.writes != report.succeeded {
+		t.Errorf("%d checkpoint writes for %d recognised files", manifest.writes, report.succeeded)
+	}
+}
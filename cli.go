@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// printUsage lists the commands of the binary
+func printUsage() {
+	fmt.Fprintln(os.Stderr, `Usage:
+  ocr-simple [serve] [server flags]    start the web and gRPC server (default)
+  ocr-simple extract [flags] FILE...   recognise images and print the text
+  ocr-simple languages [flags]         list the installed Tesseract languages
+  ocr-simple watch [server flags]      recognise the images of watch.dirs only
+  ocr-simple batch [flags] DIR         recognise every image below DIR, resumable
+  ocr-simple doctor [-json]            check the installation and suggest fixes
+  ocr-simple config print              show the effective configuration
+  ocr-simple apikey ...                manage API keys
+  ocr-simple jwt ...                   create keys and tokens for testing
+  ocr-simple --version                 print the version
+
+Exit codes of extract, languages and batch: 0 success, 1 an input failed,
+2 bad arguments, 3 Tesseract not available.`)
+}
+
+// setupCLI loads the configuration (file and environment only, the
+// commands have their own flags) and looks for Tesseract. Logs go to stderr,
+// only errors unless verbose; the commands report failures themselves.
+func setupCLI(configFile, tesseract string, verbose bool) error {
+	var args []string
+	if configFile != "" {
+		args = []string{"-config", configFile}
+	}
+	c, err := loadConfig("ocr-simple", args)
+	if err != nil {
+		return err
+	}
+	config = c
+	if tesseract != "" {
+		config.TesseractPaths = []string{tesseract}
+	}
+
+	level := "error"
+	if verbose {
+		level = "debug"
+	}
+	if err := setupLogging(config.LogFormat, level); err != nil {
+		return err
+	}
+	if status := detectTesseract(); !status.Available {
+		return errEngineNotFound{status.Error}
+	}
+	return nil
+}
+
+// errEngineNotFound makes the commands exit with 3
+type errEngineNotFound struct{ msg string }
+
+func (e errEngineNotFound) Error() string { return e.msg }
+
+// cliSetupFailed reports an error of setupCLI and returns the exit code
+func cliSetupFailed(err error) int {
+	var notFound errEngineNotFound
+	if errors.As(err, &notFound) {
+		fmt.Fprintf(os.Stderr, "❌ %v\nInstall Tesseract, or point -tesseract or OCR_TESSERACT_PATHS at it\n", err)
+		return 3
+	}
+	if errors.Is(err, flag.ErrHelp) || errors.Is(err, errConfigUsage) {
+		return 2
+	}
+	fmt.Fprintf(os.Stderr, "❌ Invalid configuration:\n%v\n", err)
+	return 1
+}
+
+// extractResult is one line of `extract -format json`
+type extractResult struct {
+	*Recognition
+	Error string `json:"error,omitempty"`
+}
+
+// runExtractCommand implements `ocr-simple extract`. Inputs are files,
+// glob patterns (for shells that do not expand them) or "-" for stdin;
+// without inputs stdin is read.
+func runExtractCommand(args []string) int {
+	fs := flag.NewFlagSet("extract", flag.ContinueOnError)
+	lang := fs.String("lang", "", "language codes, e.g. eng or ind+eng")
+	psm := fs.String("psm", "", "page segmentation mode 0-13")
+	preprocess := fs.String("preprocess", "", "grayscale or threshold")
+	format := fs.String("format", "text", "text, json (one object per line) or tsv (words)")
+	output := fs.String("o", "-", "output file, - for stdout")
+	configFile := fs.String("config", "", "config file, YAML or TOML (env OCR_CONFIG)")
+	tesseract := fs.String("tesseract", "", "Tesseract executable, instead of ocr.tesseract_paths")
+	verbose := fs.Bool("v", false, "log each recognition to stderr")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ocr-simple extract [flags] [FILE|GLOB|-]...")
+		fs.PrintDefaults()
+	}
+	inputArgs, err := parseInterspersed(fs, args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	opts, err := parseOCROptions(*lang, *psm, *preprocess)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Error: %v\n", err)
+		return 2
+	}
+	switch *format {
+	case "text", "json", "tsv":
+	default:
+		fmt.Fprintf(os.Stderr, "❌ Error: unknown format %q, expected text, json or tsv\n", *format)
+		return 2
+	}
+	inputs, err := expandInputs(inputArgs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Error: %v\n", err)
+		return 1
+	}
+
+	if err := setupCLI(*configFile, *tesseract, *verbose); err != nil {
+		return cliSetupFailed(err)
+	}
+
+	out := os.Stdout
+	if *output != "-" {
+		if out, err = os.Create(*output); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Error: %v\n", err)
+			return 1
+		}
+	}
+	w := bufio.NewWriter(out)
+
+	if *format == "tsv" {
+		fmt.Fprintln(w, "file\tpage\tline\tleft\ttop\twidth\theight\tconfidence\ttext")
+	}
+	failed := 0
+	for i, input := range inputs {
+		rec, err := extractImage(input, opts)
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "❌ %s: %v\n", input, err)
+			if *format == "json" {
+				writeJSONLine(w, extractResult{&Recognition{Filename: input, Words: []OCRWord{}, Options: opts}, err.Error()})
+			}
+			continue
+		}
+
+		switch *format {
+		case "text":
+			if len(inputs) > 1 {
+				if i > 0 {
+					fmt.Fprintln(w)
+				}
+				fmt.Fprintf(w, "==> %s <==\n", input)
+			}
+			if rec.Text != "" {
+				fmt.Fprintln(w, rec.Text)
+			}
+		case "json":
+			writeJSONLine(w, extractResult{Recognition: rec})
+		case "tsv":
+			for _, word := range rec.Words {
+				fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%.2f\t%s\n", input, word.Page, word.Line,
+					word.Left, word.Top, word.Width, word.Height, word.Confidence, word.Text)
+			}
+		}
+		// Results show up while the next image is recognised; once the
+		// output fails there is no point in recognising the rest
+		if w.Flush() != nil {
+			break
+		}
+	}
+
+	// A full disk or a closed pipe must not look like success
+	err = w.Flush()
+	if out != os.Stdout {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Error: writing the results: %v\n", err)
+		return 1
+	}
+	if failed > 0 {
+		if len(inputs) > 1 {
+			fmt.Fprintf(os.Stderr, "❌ %d of %d inputs failed\n", failed, len(inputs))
+		}
+		return 1
+	}
+	return 0
+}
+
+// parseInterspersed parses flags that may also follow the inputs, as in
+// `extract scan.png -lang ind`; everything after "--" is an input
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var inputs []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if n := len(args) - len(rest); n > 0 && args[n-1] == "--" {
+			return append(inputs, rest...), nil
+		}
+		if len(rest) == 0 {
+			return inputs, nil
+		}
+		// Parse stopped at an input; continue with the flags after it
+		inputs = append(inputs, rest[0])
+		args = rest[1:]
+	}
+}
+
+// expandInputs resolves glob patterns; "-" stands for stdin and is also
+// used when there are no arguments
+func expandInputs(args []string) ([]string, error) {
+	if len(args) == 0 {
+		return []string{"-"}, nil
+	}
+	var inputs []string
+	for _, arg := range args {
+		if arg == "-" || !strings.ContainsAny(arg, "*?[") {
+			inputs = append(inputs, arg)
+			continue
+		}
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", arg, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", arg)
+		}
+		inputs = append(inputs, matches...)
+	}
+	return inputs, nil
+}
+
+// extractImage recognises one input with the same code path as the
+// server's workers, preprocessing included
+func extractImage(input string, opts OCROptions) (*Recognition, error) {
+	var (
+		data     []byte
+		filename string
+		err      error
+	)
+	if input == "-" {
+		data, err = io.ReadAll(os.Stdin)
+		filename = "stdin" + detectImageExt(data)
+	} else {
+		data, err = os.ReadFile(input)
+		filename = filepath.Base(input)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("empty input")
+	}
+	if input == "-" && detectImageExt(data) == "" {
+		return nil, errors.New("stdin is not a supported image (PNG, JPEG, GIF, BMP or TIFF)")
+	}
+
+	result := processOCRRequest(context.Background(), data, filename, opts)
+	if result.Err != nil {
+		return nil, result.Err
+	}
+	rec := &Recognition{
+		Filename:      input,
+		Text:          result.Text,
+		Words:         result.Words,
+		Confidence:    result.Confidence,
+		Options:       result.Options,
+		EngineVersion: result.EngineVersion,
+	}
+	// The web page shows a placeholder for empty results; scripts get ""
+	if len(rec.Words) == 0 {
+		rec.Text, rec.Words = "", []OCRWord{}
+	}
+	return rec, nil
+}
+
+func writeJSONLine(w io.Writer, v any) {
+	data, _ := json.Marshal(v)
+	w.Write(append(data, '\n'))
+}
+
+// LanguageList is the output of `languages -format json`
+type LanguageList struct {
+	Tesseract string   `json:"tesseract"`
+	Version   string   `json:"version"`
+	Tessdata  string   `json:"tessdata,omitempty"`
+	Languages []string `json:"languages"`
+}
+
+// runLanguagesCommand implements `ocr-simple languages`
+func runLanguagesCommand(args []string) int {
+	fs := flag.NewFlagSet("languages", flag.ContinueOnError)
+	format := fs.String("format", "text", "text (one code per line) or json")
+	configFile := fs.String("config", "", "config file, YAML or TOML (env OCR_CONFIG)")
+	tesseract := fs.String("tesseract", "", "Tesseract executable, instead of ocr.tesseract_paths")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "❌ Error: unknown format %q, expected text or json\n", *format)
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "❌ Error: unexpected argument %q\n", fs.Arg(0))
+		return 2
+	}
+
+	if err := setupCLI(*configFile, *tesseract, false); err != nil {
+		return cliSetupFailed(err)
+	}
+	path, version, _ := currentEngine()
+	langs, dir, err := tesseractLanguageInfo(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Error: %v\n", err)
+		return 1
+	}
+
+	if *format == "json" {
+		if langs == nil {
+			langs = []string{}
+		}
+		writeJSONLine(os.Stdout, LanguageList{Tesseract: path, Version: version, Tessdata: dir, Languages: langs})
+		return 0
+	}
+	for _, l := range langs {
+		fmt.Println(l)
+	}
+	return 0
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// runCLI runs a command quietly and restores the globals it sets
+func runCLI(t *testing.T, cmd func([]string) int, args ...string) int {
+	t.Helper()
+	isolateConfig(t)
+	oldConfig, oldLogger := config, slog.Default()
+	ocrMutex.RLock()
+	oldPath, oldFound, oldVersion := tesseractPath, tesseractFound, tesseractVersion
+	ocrMutex.RUnlock()
+	oldStdout, oldStderr := os.Stdout, os.Stderr
+	devNull, _ := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	os.Stdout, os.Stderr = devNull, devNull
+	defer func() {
+		os.Stdout, os.Stderr = oldStdout, oldStderr
+		devNull.Close()
+		config = oldConfig
+		slog.SetDefault(oldLogger)
+		ocrMutex.Lock()
+		tesseractPath, tesseractFound, tesseractVersion = oldPath, oldFound, oldVersion
+		ocrMutex.Unlock()
+	}()
+	return cmd(args)
+}
+
+func TestParseInterspersed(t *testing.T) {
+	tests := []struct {
+		args   []string
+		inputs []string
+		lang   string
+		format string
+	}{
+		{nil, nil, "", "text"},
+		{[]string{"a.png"}, []string{"a.png"}, "", "text"},
+		{[]string{"-lang", "ind", "a.png"}, []string{"a.png"}, "ind", "text"},
+		{[]string{"a.png", "-lang", "ind", "b.png", "-format", "json"}, []string{"a.png", "b.png"}, "ind", "json"},
+		{[]string{"a.png", "-", "--lang=eng"}, []string{"a.png", "-"}, "eng", "text"},
+		{[]string{"-lang", "ind", "--", "-lang", "a.png"}, []string{"-lang", "a.png"}, "ind", "text"},
+		{[]string{"a.png", "--", "-format"}, []string{"a.png", "-format"}, "", "text"},
+	}
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("extract", flag.ContinueOnError)
+		lang := fs.String("lang", "", "")
+		format := fs.String("format", "text", "")
+		inputs, err := parseInterspersed(fs, tt.args)
+		if err != nil {
+			t.Errorf("%q: %v", tt.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(inputs, tt.inputs) || *lang != tt.lang || *format != tt.format {
+			t.Errorf("%q = %q, lang %q, format %q; want %q, %q, %q", tt.args, inputs, *lang, *format, tt.inputs, tt.lang, tt.format)
+		}
+	}
+
+	fs := flag.NewFlagSet("extract", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if _, err := parseInterspersed(fs, []string{"a.png", "-unknown"}); err == nil {
+		t.Error("unknown flag after an input accepted")
+	}
+}
+
+func TestExpandInputs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.png", "b.png", "c.jpg"} {
+		os.WriteFile(filepath.Join(dir, name), testPNG, 0o644)
+	}
+	join := func(names ...string) []string {
+		var paths []string
+		for _, name := range names {
+			paths = append(paths, filepath.Join(dir, name))
+		}
+		return paths
+	}
+
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{nil, []string{"-"}},
+		{[]string{"-"}, []string{"-"}},
+		{join("*.png"), join("a.png", "b.png")},
+		{append(join("c.jpg", "?.png"), "-"), append(join("c.jpg", "a.png", "b.png"), "-")},
+		// Files that do not exist are reported by extract, not here
+		{join("missing.png"), join("missing.png")},
+	}
+	for _, tt := range tests {
+		got, err := expandInputs(tt.args)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("expandInputs(%q) = %q, %v; want %q", tt.args, got, err, tt.want)
+		}
+	}
+
+	for _, args := range [][]string{join("*.gif"), join("[")} {
+		if _, err := expandInputs(args); err == nil {
+			t.Errorf("expandInputs(%q) succeeded", args)
+		}
+	}
+}
+
+func TestExtractFormats(t *testing.T) {
+	tesseract := fakeTesseract(t)
+	dir := t.TempDir()
+	writeBatchImage(t, filepath.Join(dir, "a.png"), "halo|dunia")
+	writeBatchImage(t, filepath.Join(dir, "b.png"), "faktur")
+	a, b := filepath.Join(dir, "a.png"), filepath.Join(dir, "b.png")
+
+	extract := func(format string, inputs ...string) (int, string) {
+		t.Helper()
+		out := filepath.Join(t.TempDir(), "out")
+		args := append([]string{"-tesseract", tesseract, "-format", format, "-o", out}, inputs...)
+		code := runCLI(t, runExtractCommand, args...)
+		data, _ := os.ReadFile(out)
+		return code, string(data)
+	}
+
+	if code, got := extract("text", a); code != 0 || got != "halo\n\ndunia\n" {
+		t.Errorf("text of one input: exit %d, %q", code, got)
+	}
+	want := "==> " + a + " <==\nhalo\n\ndunia\n\n==> " + b + " <==\nfaktur\n"
+	if code, got := extract("text", a, b); code != 0 || got != want {
+		t.Errorf("text of two inputs: exit %d, %q, want %q", code, got, want)
+	}
+
+	code, got := extract("tsv", a)
+	lines := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+	if code != 0 || len(lines) != 3 || lines[0] != "file\tpage\tline\tleft\ttop\twidth\theight\tconfidence\ttext" ||
+		lines[2] != a+"\t2\t2\t0\t0\t10\t10\t90.00\tdunia" {
+		t.Errorf("tsv: exit %d, %q", code, got)
+	}
+
+	// A failing input is reported in its JSON line and the exit code
+	missing := filepath.Join(dir, "missing.png")
+	code, got = extract("json", b, missing)
+	lines = strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+	if code != 1 || len(lines) != 2 {
+		t.Fatalf("json: exit %d, %q", code, got)
+	}
+	var ok, failed extractResult
+	if err := json.Unmarshal([]byte(lines[0]), &ok); err != nil || ok.Text != "faktur" || ok.Filename != b || ok.Error != "" || len(ok.Words) != 1 {
+		t.Errorf("json line 1 = %s, %v", lines[0], err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &failed); err != nil || failed.Filename != missing || failed.Error == "" || failed.Words == nil {
+		t.Errorf("json line 2 = %s, %v", lines[1], err)
+	}
+
+	if code, _ := extract("xml", a); code != 2 {
+		t.Errorf("unknown format: exit %d, want 2", code)
+	}
+}
+
+// Results that cannot be written make extract fail even when OCR succeeded
+func TestExtractOutputFailure(t *testing.T) {
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("no /dev/full")
+	}
+	tesseract := fakeTesseract(t)
+	image := filepath.Join(t.TempDir(), "a.png")
+	writeBatchImage(t, image, "halo")
+
+	if code := runCLI(t, runExtractCommand, "-tesseract", tesseract, "-o", "/dev/full", image); code != 1 {
+		t.Errorf("writing to a full disk: exit %d, want 1", code)
+	}
+}
@@ -0,0 +1,598 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// File holding the list of collections
+const collectionsFile = "data/collections.json"
+
+// Supported custom metadata types
+const (
+	MetadataText    = "text"
+	MetadataNumber  = "number"
+	MetadataDate    = "date"
+	MetadataBoolean = "boolean"
+)
+
+// Collection groups documents by project, client, case, ...
+type Collection struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// MetadataValue is a typed custom field such as "vendor" or "case number".
+// Value is always stored in canonical form for its type.
+type MetadataValue struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// CollectionStore keeps the collection list in memory and in collectionsFile
+type CollectionStore struct {
+	path        string
+	mu          sync.RWMutex
+	collections map[string]*Collection
+}
+
+var collectionStore *CollectionStore
+
+var (
+	slugInvalid = regexp.MustCompile(`[^a-z0-9]+`)
+	metadataKey = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+)
+
+func newCollectionStore(path string) (*CollectionStore, error) {
+	s := &CollectionStore{
+		path:        path,
+		collections: make(map[string]*Collection),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var list []*Collection
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("gagal membaca %s: %v", path, err)
+	}
+	for _, c := range list {
+		s.collections[c.ID] = c
+	}
+	return s, nil
+}
+
+// saveLocked writes the collection list atomically; s.mu must be held
+func (s *CollectionStore) saveLocked() error {
+	list := make([]*Collection, 0, len(s.collections))
+	for _, c := range s.collections {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// Create adds a collection whose ID is derived from its name
+func (s *CollectionStore) Create(name, description string) (*Collection, error) {
+	name = strings.TrimSpace(name)
+	id := strings.Trim(slugInvalid.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if id == "" {
+		return nil, invalidField("name", "nama koleksi tidak valid")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.collections[id]; exists {
+		return nil, newAPIError(CodeConflict, "koleksi %q sudah ada", id)
+	}
+	c := &Collection{
+		ID:          id,
+		Name:        name,
+		Description: strings.TrimSpace(description),
+		CreatedAt:   time.Now().UTC(),
+	}
+	s.collections[id] = c
+	if err := s.saveLocked(); err != nil {
+		delete(s.collections, id)
+		return nil, err
+	}
+	return c, nil
+}
+
+// Delete removes a collection; its documents stay but lose the assignment
+func (s *CollectionStore) Delete(id string) error {
+	s.mu.Lock()
+	c, ok := s.collections[id]
+	if !ok {
+		s.mu.Unlock()
+		return newAPIError(CodeNotFound, "koleksi %q tidak ditemukan", id)
+	}
+	delete(s.collections, id)
+	if err := s.saveLocked(); err != nil {
+		s.collections[id] = c
+		s.mu.Unlock()
+		return err
+	}
+	s.mu.Unlock()
+
+	for _, doc := range docStore.List() {
+		if doc.Collection != id {
+			continue
+		}
+		details := DocumentDetails{Tags: doc.Tags, Metadata: doc.Metadata}
+		if _, err := docStore.UpdateDetails(doc.ID, details); err != nil {
+			slog.Warn("removing document from collection failed", "document_id", doc.ID, "collection_id", id, "err", err)
+		}
+	}
+	return nil
+}
+
+// Get returns the collection with the given id
+func (s *CollectionStore) Get(id string) (*Collection, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, ok := s.collections[id]
+	return c, ok
+}
+
+// List returns all collections sorted by name
+func (s *CollectionStore) List() []*Collection {
+	s.mu.RLock()
+	list := make([]*Collection, 0, len(s.collections))
+	for _, c := range s.collections {
+		list = append(list, c)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return strings.ToLower(list[i].Name) < strings.ToLower(list[j].Name)
+	})
+	return list
+}
+
+// normalizeMetadataValue validates value against typ and returns it in
+// canonical form: numbers via strconv, dates as YYYY-MM-DD, booleans as
+// "true"/"false"
+func normalizeMetadataValue(typ, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	switch typ {
+	case MetadataText:
+		return value, nil
+	case MetadataNumber:
+		f, err := strconv.ParseFloat(strings.ReplaceAll(value, ",", ""), 64)
+		if err != nil {
+			return "", fmt.Errorf("%q bukan angka", value)
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	case MetadataDate:
+		t, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return "", fmt.Errorf("%q bukan tanggal (YYYY-MM-DD)", value)
+		}
+		return t.Format("2006-01-02"), nil
+	case MetadataBoolean:
+		b, err := strconv.ParseBool(strings.ToLower(value))
+		if err != nil {
+			return "", fmt.Errorf("%q bukan boolean", value)
+		}
+		return strconv.FormatBool(b), nil
+	default:
+		return "", fmt.Errorf("tipe metadata %q tidak dikenal", typ)
+	}
+}
+
+// normalizeMetadata validates keys and values, dropping empty entries
+func normalizeMetadata(metadata map[string]MetadataValue) (map[string]MetadataValue, error) {
+	out := make(map[string]MetadataValue, len(metadata))
+	for key, mv := range metadata {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key == "" || strings.TrimSpace(mv.Value) == "" {
+			continue
+		}
+		if !metadataKey.MatchString(key) {
+			return nil, fmt.Errorf("nama field %q tidak valid (huruf kecil, angka, underscore)", key)
+		}
+		if mv.Type == "" {
+			mv.Type = MetadataText
+		}
+		value, err := normalizeMetadataValue(mv.Type, mv.Value)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %v", key, err)
+		}
+		out[key] = MetadataValue{Type: mv.Type, Value: value}
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return out, nil
+}
+
+// parseMetadataJSON accepts either typed values ({"amount": {"type": "number",
+// "value": "12.5"}}) or plain JSON values whose type is inferred
+// ({"vendor": "PT Maju", "amount": 12.5, "paid": true})
+func parseMetadataJSON(data []byte) (map[string]MetadataValue, error) {
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return nil, nil
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("metadata harus berupa objek JSON: %v", err)
+	}
+
+	metadata := make(map[string]MetadataValue, len(raw))
+	for key, value := range raw {
+		var typed MetadataValue
+		if err := json.Unmarshal(value, &typed); err == nil && typed.Type != "" {
+			metadata[key] = typed
+			continue
+		}
+
+		var v interface{}
+		if err := json.Unmarshal(value, &v); err != nil {
+			return nil, err
+		}
+		switch v := v.(type) {
+		case string:
+			metadata[key] = MetadataValue{Type: MetadataText, Value: v}
+		case float64:
+			metadata[key] = MetadataValue{Type: MetadataNumber, Value: strconv.FormatFloat(v, 'f', -1, 64)}
+		case bool:
+			metadata[key] = MetadataValue{Type: MetadataBoolean, Value: strconv.FormatBool(v)}
+		case nil:
+		default:
+			return nil, fmt.Errorf("field %s: tipe nilai tidak didukung", key)
+		}
+	}
+	return normalizeMetadata(metadata)
+}
+
+// metadataFilter is a meta.<key>:<value>, meta.<key>><value> or
+// meta.<key><<value> clause in a search query
+type metadataFilter struct {
+	Key   string
+	Op    byte // ':', '>' or '<'
+	Value string
+}
+
+// parseMetadataFilter recognises meta.* clauses, e.g. meta.vendor:maju or
+// meta.amount>1000
+func parseMetadataFilter(field string) (metadataFilter, bool) {
+	if !strings.HasPrefix(strings.ToLower(field), "meta.") {
+		return metadataFilter{}, false
+	}
+	rest := field[len("meta."):]
+	i := strings.IndexAny(rest, ":<>")
+	if i <= 0 || i == len(rest)-1 {
+		return metadataFilter{}, false
+	}
+	return metadataFilter{
+		Key:   strings.ToLower(rest[:i]),
+		Op:    rest[i],
+		Value: rest[i+1:],
+	}, true
+}
+
+func (f metadataFilter) matches(doc *Document) bool {
+	mv, ok := doc.Metadata[f.Key]
+	if !ok {
+		return false
+	}
+
+	switch mv.Type {
+	case MetadataNumber:
+		have, err1 := strconv.ParseFloat(mv.Value, 64)
+		want, err2 := strconv.ParseFloat(f.Value, 64)
+		if err1 != nil || err2 != nil {
+			return false
+		}
+		switch f.Op {
+		case '>':
+			return have > want
+		case '<':
+			return have < want
+		}
+		return have == want
+	case MetadataDate:
+		// Canonical dates compare correctly as strings
+		switch f.Op {
+		case '>':
+			return mv.Value > f.Value
+		case '<':
+			return mv.Value < f.Value
+		}
+		return mv.Value == f.Value
+	case MetadataBoolean:
+		want, err := strconv.ParseBool(strings.ToLower(f.Value))
+		return err == nil && f.Op == ':' && mv.Value == strconv.FormatBool(want)
+	default:
+		return f.Op == ':' && strings.Contains(strings.ToLower(mv.Value), strings.ToLower(f.Value))
+	}
+}
+
+// writeJSON writes v with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func apiCollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"collections": collectionStore.List()})
+}
+
+func apiCreateCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+	if err := decodeJSONBody(w, r, 64<<10, &body); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	c, err := collectionStore.Create(body.Name, body.Description)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, c)
+}
+
+func apiDeleteCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	if err := collectionStore.Delete(r.PathValue("id")); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func apiDocumentsHandler(w http.ResponseWriter, r *http.Request) {
+	var docs []*Document
+	for _, result := range docStore.Search(searchRequest(r), 0) {
+		docs = append(docs, result.Document)
+	}
+	if docs == nil {
+		docs = []*Document{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"documents": docs})
+}
+
+func apiDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	doc, ok := docStore.Get(r.PathValue("id"))
+	if !ok {
+		writeError(w, r, errDocumentNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, doc)
+}
+
+// apiUpdateDocumentHandler changes the collection, tags and metadata of a
+// document. Fields left out of the body keep their current value.
+func apiUpdateDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	doc, ok := docStore.Get(r.PathValue("id"))
+	if !ok {
+		writeError(w, r, errDocumentNotFound)
+		return
+	}
+
+	var body struct {
+		Collection *string          `json:"collection"`
+		Tags       *[]string        `json:"tags"`
+		Metadata   *json.RawMessage `json:"metadata"`
+	}
+	if err := decodeJSONBody(w, r, 64<<10, &body); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	details := DocumentDetails{Collection: doc.Collection, Tags: doc.Tags, Metadata: doc.Metadata}
+	if body.Collection != nil {
+		details.Collection = *body.Collection
+	}
+	if body.Tags != nil {
+		details.Tags = *body.Tags
+	}
+	if body.Metadata != nil {
+		var err error
+		if details.Metadata, err = parseMetadataJSON(*body.Metadata); err != nil {
+			writeError(w, r, asAPIError(err, "metadata"))
+			return
+		}
+	}
+
+	updated, err := docStore.UpdateDetails(doc.ID, details)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func collectionsHandler(w http.ResponseWriter, r *http.Request) {
+	tmpl, exists := cachedTemplate("collections")
+
+	if !exists {
+		writeError(w, r, errTemplateNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	type collectionRow struct {
+		*Collection
+		Count int
+	}
+	counts := make(map[string]int)
+	for _, doc := range docStore.List() {
+		counts[doc.Collection]++
+	}
+	var rows []collectionRow
+	for _, c := range collectionStore.List() {
+		rows = append(rows, collectionRow{c, counts[c.ID]})
+	}
+
+	data := struct {
+		Collections []collectionRow
+		Error       string
+	}{
+		Collections: rows,
+		Error:       r.URL.Query().Get("error"),
+	}
+	tmpl.Execute(w, data)
+}
+
+func createCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	if _, err := collectionStore.Create(r.FormValue("name"), r.FormValue("description")); err != nil {
+		http.Redirect(w, r, "/collections?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/collections", http.StatusSeeOther)
+}
+
+func deleteCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	if err := collectionStore.Delete(r.PathValue("id")); err != nil {
+		http.Redirect(w, r, "/collections?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/collections", http.StatusSeeOther)
+}
+
+// documentEditHandler saves the collection, tags and metadata form on the
+// document detail page. Metadata rows arrive as parallel meta_key,
+// meta_type and meta_value fields.
+func documentEditHandler(w http.ResponseWriter, r *http.Request) {
+	doc, ok := documentFromRequest(w, r)
+	if !ok {
+		return
+	}
+	detailURL := "/documents/" + url.PathEscape(doc.ID)
+
+	if err := r.ParseForm(); err != nil {
+		http.Redirect(w, r, detailURL+"?error="+url.QueryEscape("Form tidak valid"), http.StatusSeeOther)
+		return
+	}
+	keys, types, values := r.PostForm["meta_key"], r.PostForm["meta_type"], r.PostForm["meta_value"]
+	metadata := make(map[string]MetadataValue, len(keys))
+	for i, key := range keys {
+		if i >= len(types) || i >= len(values) {
+			break
+		}
+		metadata[key] = MetadataValue{Type: types[i], Value: values[i]}
+	}
+	details := DocumentDetails{
+		Collection: r.PostForm.Get("collection"),
+		Tags:       parseTagList(r.PostForm.Get("tags")),
+		Metadata:   metadata,
+	}
+	if _, err := docStore.UpdateDetails(doc.ID, details); err != nil {
+		http.Redirect(w, r, detailURL+"?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, detailURL+"?msg="+url.QueryEscape("Detail dokumen disimpan"), http.StatusSeeOther)
+}
+
+const collectionsTmpl = `
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>OCR Simple - Koleksi</title>
+    <style>
+        * { box-sizing: border-box; }
+        body { font-family: Arial, sans-serif; padding: 15px; background: #f5f5f5; margin: 0; }
+        .container { max-width: 900px; margin: 0 auto; background: white; padding: 20px; border-radius: 4px; box-shadow: 0 2px 4px rgba(0,0,0,0.1); }
+        .header { display: flex; justify-content: space-between; align-items: center; margin-bottom: 15px; }
+        .header h1 { margin: 0; font-size: 1.5em; color: #333; }
+        .header a { color: #007bff; text-decoration: none; margin-left: 12px; }
+        form.create { display: flex; flex-wrap: wrap; gap: 8px; margin-bottom: 15px; }
+        input[type="text"] { padding: 6px 8px; border: 1px solid #ccc; border-radius: 3px; font-size: 14px; }
+        input[name="description"] { flex: 1; min-width: 200px; }
+        .btn { background: #007bff; color: white; border: none; padding: 6px 16px; border-radius: 3px; cursor: pointer; font-size: 14px; }
+        .btn:hover { background: #0056b3; }
+        .delete-btn { background: #dc3545; padding: 4px 10px; font-size: 12px; }
+        .delete-btn:hover { background: #c82333; }
+        .error { background: #f8d7da; border: 1px solid #f5c6cb; color: #721c24; padding: 8px 12px; border-radius: 4px; margin-bottom: 12px; }
+        table { width: 100%; border-collapse: collapse; }
+        th, td { text-align: left; padding: 8px; border-bottom: 1px solid #eee; }
+        th { color: #666; font-size: 0.85em; }
+        td a { color: #007bff; text-decoration: none; }
+        code { color: #888; }
+        .empty { color: #666; font-style: italic; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>🗂️ Koleksi</h1>
+            <div>
+                <a href="/documents">📚 Riwayat</a>
+                <a href="/">← Kembali ke OCR</a>
+            </div>
+        </div>
+
+        {{if .Error}}<div class="error">{{.Error}}</div>{{end}}
+
+        <form class="create" method="POST" action="/collections">
+            <input type="text" name="name" placeholder="Nama koleksi (mis. Klien ABC)" required>
+            <input type="text" name="description" placeholder="Deskripsi (opsional)">
+            <button type="submit" class="btn">Buat Koleksi</button>
+        </form>
+
+        {{if .Collections}}
+        <table>
+            <tr><th>Nama</th><th>ID</th><th>Dokumen</th><th>Dibuat</th><th></th></tr>
+            {{range .Collections}}
+            <tr>
+                <td><a href="/documents?collection={{.ID}}">{{.Name}}</a>{{if .Description}}<br><small>{{.Description}}</small>{{end}}</td>
+                <td><code>{{.ID}}</code></td>
+                <td>{{.Count}}</td>
+                <td>{{.CreatedAt.Format "2006-01-02"}}</td>
+                <td>
+                    <form method="POST" action="/collections/{{.ID}}/delete" onsubmit="return confirm('Hapus koleksi ini? Dokumen tidak ikut terhapus.')">
+                        <button type="submit" class="btn delete-btn">Hapus</button>
+                    </form>
+                </td>
+            </tr>
+            {{end}}
+        </table>
+        {{else}}
+        <p class="empty">Belum ada koleksi.</p>
+        {{end}}
+    </div>
+</body>
+</html>`
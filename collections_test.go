@@ -0,0 +1,304 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeMetadataValue(t *testing.T) {
+	tests := []struct {
+		typ, value string
+		want       string
+		ok         bool
+	}{
+		{MetadataText, "  PT Maju  ", "PT Maju", true},
+		{MetadataNumber, "1250", "1250", true},
+		{MetadataNumber, "1,250.50", "1250.5", true},
+		{MetadataNumber, "-3e2", "-300", true},
+		{MetadataNumber, "seribu", "", false},
+		{MetadataDate, "2024-03-01", "2024-03-01", true},
+		{MetadataDate, "2024-13-01", "", false},
+		{MetadataDate, "01/03/2024", "", false},
+		{MetadataBoolean, "TRUE", "true", true},
+		{MetadataBoolean, "0", "false", true},
+		{MetadataBoolean, "ya", "", false},
+		{"money", "10", "", false},
+	}
+	for _, tt := range tests {
+		got, err := normalizeMetadataValue(tt.typ, tt.value)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("normalizeMetadataValue(%s, %q) = %q, %v; want %q, ok %v", tt.typ, tt.value, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestNormalizeMetadata(t *testing.T) {
+	got, err := normalizeMetadata(map[string]MetadataValue{
+		" Vendor ": {Value: "PT Maju"},
+		"amount":   {Type: MetadataNumber, Value: "1,000"},
+		"note":     {Type: MetadataText, Value: "  "},
+		"":         {Value: "no key"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]MetadataValue{
+		"vendor": {Type: MetadataText, Value: "PT Maju"},
+		"amount": {Type: MetadataNumber, Value: "1000"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("normalizeMetadata = %v, want %v", got, want)
+	}
+
+	if got, err := normalizeMetadata(map[string]MetadataValue{"note": {Value: ""}}); got != nil || err != nil {
+		t.Errorf("only empty values = %v, %v; want nil", got, err)
+	}
+	for _, bad := range []map[string]MetadataValue{
+		{"case number": {Value: "12"}},
+		{"1st": {Value: "x"}},
+		{"due": {Type: MetadataDate, Value: "besok"}},
+	} {
+		if _, err := normalizeMetadata(bad); err == nil {
+			t.Errorf("normalizeMetadata(%v) succeeded", bad)
+		}
+	}
+}
+
+func TestParseMetadataJSON(t *testing.T) {
+	got, err := parseMetadataJSON([]byte(`{"vendor": "PT Maju", "amount": 12.5, "paid": true, "skip": null,
+		"due": {"type": "date", "value": "2024-06-01"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]MetadataValue{
+		"vendor": {Type: MetadataText, Value: "PT Maju"},
+		"amount": {Type: MetadataNumber, Value: "12.5"},
+		"paid":   {Type: MetadataBoolean, Value: "true"},
+		"due":    {Type: MetadataDate, Value: "2024-06-01"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseMetadataJSON = %v, want %v", got, want)
+	}
+
+	if got, err := parseMetadataJSON([]byte("  ")); got != nil || err != nil {
+		t.Errorf("empty metadata = %v, %v; want nil", got, err)
+	}
+	for _, bad := range []string{
+		`["vendor"]`,
+		`{"items": [1, 2]}`,
+		`{"amount": {"type": "number", "value": "banyak"}}`,
+		`{"paid": {"type": "boolean", "value": "mungkin"}}`,
+		`{"x": {"type": "money", "value": "1"}}`,
+	} {
+		if _, err := parseMetadataJSON([]byte(bad)); err == nil {
+			t.Errorf("parseMetadataJSON(%s) succeeded", bad)
+		}
+	}
+}
+
+func TestMetadataFilterMatches(t *testing.T) {
+	doc := &Document{Metadata: map[string]MetadataValue{
+		"vendor": {Type: MetadataText, Value: "PT Maju Jaya"},
+		"amount": {Type: MetadataNumber, Value: "1250"},
+		"due":    {Type: MetadataDate, Value: "2024-06-01"},
+		"paid":   {Type: MetadataBoolean, Value: "false"},
+	}}
+	tests := []struct {
+		field string
+		want  bool
+	}{
+		{"meta.vendor:maju", true},
+		{"meta.VENDOR:jaya", true},
+		{"meta.vendor:sentosa", false},
+		{"meta.vendor>a", false},
+		{"meta.amount:1250", true},
+		{"meta.amount>1000", true},
+		{"meta.amount<1000", false},
+		{"meta.amount>abc", false},
+		{"meta.due<2024-07-01", true},
+		{"meta.due>2024-07-01", false},
+		{"meta.due:2024-06-01", true},
+		{"meta.paid:false", true},
+		{"meta.paid:FALSE", true},
+		{"meta.paid:true", false},
+		{"meta.missing:x", false},
+	}
+	for _, tt := range tests {
+		filter, ok := parseMetadataFilter(tt.field)
+		if !ok {
+			t.Errorf("parseMetadataFilter(%q) failed", tt.field)
+			continue
+		}
+		if got := filter.matches(doc); got != tt.want {
+			t.Errorf("%s matches = %v, want %v", tt.field, got, tt.want)
+		}
+	}
+
+	for _, field := range []string{"vendor:maju", "meta.:x", "meta.vendor:", "meta.vendor"} {
+		if _, ok := parseMetadataFilter(field); ok {
+			t.Errorf("parseMetadataFilter(%q) accepted", field)
+		}
+	}
+}
+
+func TestSearchByMetadata(t *testing.T) {
+	useTestStores(t)
+	small := addTestDocument(t, "a.png", "Faktur kecil", time.Now(), DocumentDetails{
+		Metadata: map[string]MetadataValue{"amount": {Type: MetadataNumber, Value: "500"}, "vendor": {Value: "PT Maju"}},
+	})
+	large := addTestDocument(t, "b.png", "Faktur besar", time.Now(), DocumentDetails{
+		Metadata: map[string]MetadataValue{"amount": {Type: MetadataNumber, Value: "2000"}, "vendor": {Value: "CV Sentosa"}},
+	})
+	addTestDocument(t, "c.png", "Faktur tanpa metadata", time.Now(), DocumentDetails{})
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"meta.amount>1000", []string{large.ID}},
+		{"meta.amount<1000", []string{small.ID}},
+		{"meta.vendor:maju", []string{small.ID}},
+		{"faktur meta.vendor:sentosa", []string{large.ID}},
+		{"meta.amount>100 meta.vendor:maju", []string{small.ID}},
+		{"meta.amount>5000", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, result := range docStore.Search(parseSearchQuery(tt.query), 0) {
+			got = append(got, result.Document.ID)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("search %q = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestCreateCollection(t *testing.T) {
+	useTestStores(t)
+	c, err := collectionStore.Create("  Klien ABC / 2024 ", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ID != "klien-abc-2024" || c.Name != "Klien ABC / 2024" {
+		t.Errorf("collection = %+v", c)
+	}
+	if _, err := collectionStore.Create("klien abc 2024", ""); err == nil || err.(*APIError).Code != CodeConflict {
+		t.Errorf("duplicate: %v, want %s", err, CodeConflict)
+	}
+	if _, err := collectionStore.Create(" !! ", ""); err == nil || err.(*APIError).Code != CodeInvalidRequest {
+		t.Errorf("empty name: %v, want %s", err, CodeInvalidRequest)
+	}
+
+	// Collections survive a restart
+	reopened, err := newCollectionStore(collectionStore.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := reopened.Get("klien-abc-2024"); !ok || got.Description != "audit" {
+		t.Errorf("reopened collection = %+v, %v", got, ok)
+	}
+}
+
+func TestDeleteCollectionUnassignsDocuments(t *testing.T) {
+	useTestStores(t)
+	for _, name := range []string{"Klien ABC", "Klien XYZ"} {
+		if _, err := collectionStore.Create(name, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	metadata := map[string]MetadataValue{"vendor": {Type: MetadataText, Value: "PT Maju"}}
+	abc := addTestDocument(t, "a.png", "satu", time.Now(), DocumentDetails{Collection: "klien-abc", Tags: []string{"audit"}, Metadata: metadata})
+	xyz := addTestDocument(t, "b.png", "dua", time.Now(), DocumentDetails{Collection: "klien-xyz"})
+
+	if err := collectionStore.Delete("klien-abc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := collectionStore.Get("klien-abc"); ok {
+		t.Error("collection still listed")
+	}
+	doc, _ := docStore.Get(abc.ID)
+	if doc.Collection != "" || !reflect.DeepEqual(doc.Tags, []string{"audit"}) || !reflect.DeepEqual(doc.Metadata, metadata) {
+		t.Errorf("document after delete = collection %q, tags %v, metadata %v; want only the collection removed", doc.Collection, doc.Tags, doc.Metadata)
+	}
+	if doc, _ := docStore.Get(xyz.ID); doc.Collection != "klien-xyz" {
+		t.Errorf("other collection's document lost its assignment: %q", doc.Collection)
+	}
+	if got := docStore.Search(parseSearchQuery("collection:klien-abc"), 0); len(got) != 0 {
+		t.Errorf("collection:klien-abc still finds %d documents", len(got))
+	}
+
+	if err := collectionStore.Delete("klien-abc"); err == nil || err.(*APIError).Code != CodeNotFound {
+		t.Errorf("deleting again: %v, want %s", err, CodeNotFound)
+	}
+}
+
+func TestUpdateDocumentDetailsAPI(t *testing.T) {
+	useTestStores(t)
+	if _, err := collectionStore.Create("Klien ABC", ""); err != nil {
+		t.Fatal(err)
+	}
+	doc := addTestDocument(t, "a.png", "satu", time.Now(), DocumentDetails{Tags: []string{"lama"}})
+
+	patch := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("PATCH", "/api/documents/"+doc.ID, strings.NewReader(body))
+		r.SetPathValue("id", doc.ID)
+		w := httptest.NewRecorder()
+		apiUpdateDocumentHandler(w, r)
+		return w
+	}
+
+	w := patch(`{"collection": "klien-abc", "metadata": {"amount": "1.000", "paid": false, "due": {"type": "date", "value": "2024-06-01"}}}`)
+	if w.Code != 200 {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var updated Document
+	if err := json.Unmarshal(w.Body.Bytes(), &updated); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]MetadataValue{
+		"amount": {Type: MetadataText, Value: "1.000"},
+		"paid":   {Type: MetadataBoolean, Value: "false"},
+		"due":    {Type: MetadataDate, Value: "2024-06-01"},
+	}
+	if updated.Collection != "klien-abc" || !reflect.DeepEqual(updated.Tags, []string{"lama"}) || !reflect.DeepEqual(updated.Metadata, want) {
+		t.Errorf("updated = collection %q, tags %v, metadata %v", updated.Collection, updated.Tags, updated.Metadata)
+	}
+
+	tests := []struct {
+		body, field string
+	}{
+		{`{"collection": "tidak-ada"}`, "collection"},
+		{`{"metadata": {"amount": {"type": "number", "value": "seribu"}}}`, "metadata"},
+		{`{"metadata": {"due": {"type": "date", "value": "2024-02-30"}}}`, "metadata"},
+		{`{"metadata": {"Case Number": "12"}}`, "metadata"},
+		{`{"metadata": "vendor"}`, "metadata"},
+		{`{"tags": "audit"}`, "body"},
+	}
+	for _, tt := range tests {
+		w := patch(tt.body)
+		if w.Code != 400 {
+			t.Errorf("%s: status %d, want 400", tt.body, w.Code)
+			continue
+		}
+		got := decodeError(t, w)
+		if got.Code != CodeInvalidRequest || len(got.Details) != 1 || got.Details[0].Field != tt.field {
+			t.Errorf("%s: error = %+v, want field %s", tt.body, got, tt.field)
+		}
+	}
+
+	// Failed updates leave the document as it was
+	stored, _ := docStore.Get(doc.ID)
+	var keys []string
+	for key := range stored.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if stored.Collection != "klien-abc" || !reflect.DeepEqual(keys, []string{"amount", "due", "paid"}) {
+		t.Errorf("stored = collection %q, metadata %v", stored.Collection, stored.Metadata)
+	}
+}
@@ -0,0 +1,517 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the settings of the server. Each one is read, in increasing
+// order of precedence, from the defaults, the config file, its environment
+// variable and its command-line flag; see settings.
+type Config struct {
+	Ports        []int // HTTP ports, the first free one is used
+	GRPCPort     string
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+
+	Workers        int
+	QueueSize      int
+	QueueTimeout   time.Duration // waiting for a free queue slot
+	ResultTimeout  time.Duration // waiting for a worker to answer
+	OCRTimeout     time.Duration // a single Tesseract run
+	TesseractPaths []string
+	// Tesseract is looked for again this often, 0 turns it off
+	EngineCheckInterval time.Duration
+
+	MaxUploadSize   int // largest image, however it is sent
+	MultipartMemory int // larger multipart uploads are buffered on disk
+
+	LogFormat string
+	LogLevel  string
+
+	RateLimit      string
+	TrustedProxies string
+	FetchAllow     string
+
+	WatchDirs       []string // hot folders, none when empty
+	WatchOutputDir  string   // results go next to the image when empty
+	WatchInterval   time.Duration
+	WatchSettle     time.Duration // a file must be unchanged this long
+	WatchLanguage   string
+	WatchPreprocess string
+
+	JWTIssuer     string
+	JWTAudience   string
+	JWTRolesClaim string
+	JWTRoleMap    string
+	JWKSURL       string
+	JWKSFile      string
+
+	file    string            // config file that was read, "" without one
+	sources map[string]string // setting key -> where its value came from
+}
+
+// config is the configuration of the running server; main replaces the
+// defaults with loadConfig
+var config = defaultConfig()
+
+func defaultConfig() *Config {
+	paths := []string{"tesseract"}
+	if runtime.GOOS == "windows" {
+		paths = append(paths,
+			"tesseract.exe",
+			"C:/Program Files/Tesseract-OCR/tesseract.exe",
+			"C:/Program Files (x86)/Tesseract-OCR/tesseract.exe",
+		)
+	} else {
+		paths = append(paths,
+			"/usr/bin/tesseract",
+			"/usr/local/bin/tesseract",
+			"/opt/homebrew/bin/tesseract",
+		)
+	}
+
+	return &Config{
+		Ports:               []int{9000, 8000, 7000},
+		GRPCPort:            "9090",
+		ReadTimeout:         30 * time.Second,
+		WriteTimeout:        30 * time.Second,
+		IdleTimeout:         120 * time.Second,
+		Workers:             3,
+		QueueSize:           10,
+		QueueTimeout:        5 * time.Second,
+		ResultTimeout:       35 * time.Second,
+		OCRTimeout:          30 * time.Second,
+		TesseractPaths:      paths,
+		EngineCheckInterval: time.Minute,
+		MaxUploadSize:       5 << 20,
+		MultipartMemory:     5 << 20,
+		LogFormat:           "text",
+		LogLevel:            "info",
+		WatchInterval:       5 * time.Second,
+		WatchSettle:         2 * time.Second,
+		JWTRolesClaim:       "roles",
+	}
+}
+
+// setting ties a Config field to its key in the config file, its
+// environment variable and its flag
+type setting struct {
+	key   string
+	env   string
+	flag  string
+	usage string
+	sep   string // joins lists from the config file, "," when empty
+	value func(c *Config) flag.Value
+}
+
+var settings = []setting{
+	{key: "server.ports", env: "OCR_PORTS", flag: "ports", usage: "HTTP ports to try in order", value: func(c *Config) flag.Value { return (*intListValue)(&c.Ports) }},
+	{key: "server.grpc_port", env: "OCR_GRPC_PORT", flag: "grpc-port", usage: `gRPC port, "off" disables the gRPC API`, value: func(c *Config) flag.Value { return (*stringValue)(&c.GRPCPort) }},
+	{key: "server.read_timeout", env: "OCR_READ_TIMEOUT", flag: "read-timeout", usage: "time to read a request, including the upload", value: func(c *Config) flag.Value { return (*durationValue)(&c.ReadTimeout) }},
+	{key: "server.write_timeout", env: "OCR_WRITE_TIMEOUT", flag: "write-timeout", usage: "time to write a response", value: func(c *Config) flag.Value { return (*durationValue)(&c.WriteTimeout) }},
+	{key: "server.idle_timeout", env: "OCR_IDLE_TIMEOUT", flag: "idle-timeout", usage: "keep-alive connections are closed after this long", value: func(c *Config) flag.Value { return (*durationValue)(&c.IdleTimeout) }},
+
+	{key: "ocr.workers", env: "OCR_WORKERS", flag: "workers", usage: "recognitions run at the same time", value: func(c *Config) flag.Value { return (*intValue)(&c.Workers) }},
+	{key: "ocr.queue_size", env: "OCR_QUEUE_SIZE", flag: "queue-size", usage: "requests waiting for a worker", value: func(c *Config) flag.Value { return (*intValue)(&c.QueueSize) }},
+	{key: "ocr.queue_timeout", env: "OCR_QUEUE_TIMEOUT", flag: "queue-timeout", usage: "time to wait for room in a full queue", value: func(c *Config) flag.Value { return (*durationValue)(&c.QueueTimeout) }},
+	{key: "ocr.result_timeout", env: "OCR_RESULT_TIMEOUT", flag: "result-timeout", usage: "time to wait for a worker to answer", value: func(c *Config) flag.Value { return (*durationValue)(&c.ResultTimeout) }},
+	{key: "ocr.timeout", env: "OCR_TIMEOUT", flag: "ocr-timeout", usage: "a Tesseract run is stopped after this long", value: func(c *Config) flag.Value { return (*durationValue)(&c.OCRTimeout) }},
+	{key: "ocr.engine_check_interval", env: "OCR_ENGINE_CHECK_INTERVAL", flag: "engine-check-interval", usage: "how often Tesseract is looked for again, 0 disables", value: func(c *Config) flag.Value { return (*durationValue)(&c.EngineCheckInterval) }},
+	{key: "ocr.tesseract_paths", env: "OCR_TESSERACT_PATHS", flag: "tesseract-paths", usage: "Tesseract executables to try in order", value: func(c *Config) flag.Value { return (*stringListValue)(&c.TesseractPaths) }},
+
+	{key: "upload.max_size", env: "OCR_MAX_UPLOAD_SIZE", flag: "max-upload-size", usage: "largest image accepted, e.g. 10MB", value: func(c *Config) flag.Value { return (*sizeValue)(&c.MaxUploadSize) }},
+	{key: "upload.multipart_memory", env: "OCR_MULTIPART_MEMORY", flag: "multipart-memory", usage: "multipart uploads above this size are buffered on disk", value: func(c *Config) flag.Value { return (*sizeValue)(&c.MultipartMemory) }},
+
+	{key: "log.format", env: "OCR_LOG_FORMAT", flag: "log-format", usage: "text or json", value: func(c *Config) flag.Value { return (*stringValue)(&c.LogFormat) }},
+	{key: "log.level", env: "OCR_LOG_LEVEL", flag: "log-level", usage: "debug, info, warn or error", value: func(c *Config) flag.Value { return (*stringValue)(&c.LogLevel) }},
+
+	{key: "rate_limit", env: "OCR_RATE_LIMIT", flag: "rate-limit", usage: `e.g. "upload=30/m:5;reprocess=off", or "off"`, sep: ";", value: func(c *Config) flag.Value { return (*stringValue)(&c.RateLimit) }},
+	{key: "trusted_proxies", env: "OCR_TRUSTED_PROXIES", flag: "trusted-proxies", usage: "networks whose X-Forwarded-For is believed", value: func(c *Config) flag.Value { return (*stringValue)(&c.TrustedProxies) }},
+	{key: "fetch_allow", env: "OCR_FETCH_ALLOW", flag: "fetch-allow", usage: "hosts and networks images may be fetched from", value: func(c *Config) flag.Value { return (*stringValue)(&c.FetchAllow) }},
+
+	{key: "watch.dirs", env: "OCR_WATCH_DIRS", flag: "watch-dirs", usage: "hot folders whose images are recognised", value: func(c *Config) flag.Value { return (*stringListValue)(&c.WatchDirs) }},
+	{key: "watch.output_dir", env: "OCR_WATCH_OUTPUT_DIR", flag: "watch-output-dir", usage: "directory for the .txt and .json results, next to the image when empty", value: func(c *Config) flag.Value { return (*stringValue)(&c.WatchOutputDir) }},
+	{key: "watch.interval", env: "OCR_WATCH_INTERVAL", flag: "watch-interval", usage: "how often hot folders are looked at", value: func(c *Config) flag.Value { return (*durationValue)(&c.WatchInterval) }},
+	{key: "watch.settle", env: "OCR_WATCH_SETTLE", flag: "watch-settle", usage: "a file is read once unchanged this long", value: func(c *Config) flag.Value { return (*durationValue)(&c.WatchSettle) }},
+	{key: "watch.lang", env: "OCR_WATCH_LANG", flag: "watch-lang", usage: "language of hot folder images, e.g. ind+eng", value: func(c *Config) flag.Value { return (*stringValue)(&c.WatchLanguage) }},
+	{key: "watch.preprocess", env: "OCR_WATCH_PREPROCESS", flag: "watch-preprocess", usage: "grayscale or threshold for hot folder images", value: func(c *Config) flag.Value { return (*stringValue)(&c.WatchPreprocess) }},
+
+	{key: "jwt.issuer", env: "OCR_JWT_ISSUER", flag: "jwt-issuer", usage: "accepted token issuers, enables JWT validation", value: func(c *Config) flag.Value { return (*stringValue)(&c.JWTIssuer) }},
+	{key: "jwt.audience", env: "OCR_JWT_AUDIENCE", flag: "jwt-audience", usage: "required aud claim", value: func(c *Config) flag.Value { return (*stringValue)(&c.JWTAudience) }},
+	{key: "jwt.roles_claim", env: "OCR_JWT_ROLES_CLAIM", flag: "jwt-roles-claim", usage: "claim holding the roles", value: func(c *Config) flag.Value { return (*stringValue)(&c.JWTRolesClaim) }},
+	{key: "jwt.role_map", env: "OCR_JWT_ROLE_MAP", flag: "jwt-role-map", usage: `e.g. "ocr-admin=admin;ocr-user=ocr,read"`, sep: ";", value: func(c *Config) flag.Value { return (*stringValue)(&c.JWTRoleMap) }},
+	{key: "jwt.jwks_url", env: "OCR_JWKS_URL", flag: "jwks-url", usage: "JWKS of the issuer, discovered when empty", value: func(c *Config) flag.Value { return (*stringValue)(&c.JWKSURL) }},
+	{key: "jwt.jwks_file", env: "OCR_JWKS_FILE", flag: "jwks-file", usage: "local JWKS instead of jwks_url", value: func(c *Config) flag.Value { return (*stringValue)(&c.JWKSFile) }},
+}
+
+// Config files looked for in the working directory when neither -config
+// nor OCR_CONFIG is given
+var defaultConfigFiles = []string{"ocr-simple.yaml", "ocr-simple.yml", "ocr-simple.toml"}
+
+// errConfigUsage is returned by loadConfig for bad flags; the flag package
+// has already printed the problem and the usage
+var errConfigUsage = errors.New("invalid arguments")
+
+// loadConfig layers the defaults, the config file, the environment and the
+// flags in args. A config that fails validation is returned together with
+// the error, so it can still be printed.
+func loadConfig(name string, args []string) (*Config, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	file := fs.String("config", "", "config file, YAML or TOML (env OCR_CONFIG)")
+	flags := map[string]string{}
+	for _, s := range settings {
+		fs.Func(s.flag, s.usage+" (env "+s.env+")", func(v string) error {
+			flags[s.key] = v
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		return nil, errConfigUsage
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(fs.Output(), "unexpected argument %q\n", fs.Arg(0))
+		fs.Usage()
+		return nil, errConfigUsage
+	}
+
+	c := defaultConfig()
+	c.sources = map[string]string{}
+	for _, s := range settings {
+		c.sources[s.key] = "default"
+	}
+
+	c.file = *file
+	if c.file == "" {
+		c.file = os.Getenv("OCR_CONFIG")
+	}
+	if c.file == "" {
+		for _, name := range defaultConfigFiles {
+			if _, err := os.Stat(name); err == nil {
+				c.file = name
+				break
+			}
+		}
+	}
+	if c.file != "" {
+		values, err := readConfigFile(c.file)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range settings {
+			if v, ok := values[s.key]; ok {
+				if err := c.set(s, v, "file"); err != nil {
+					return nil, fmt.Errorf("%s: %v", c.file, err)
+				}
+			}
+		}
+	}
+
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(s.env); ok {
+			if err := c.set(s, v, "env "+s.env); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, s := range settings {
+		if v, ok := flags[s.key]; ok {
+			if err := c.set(s, v, "flag -"+s.flag); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return c, c.validate()
+}
+
+func (c *Config) set(s setting, value, source string) error {
+	if err := s.value(c).Set(value); err != nil {
+		return fmt.Errorf("%s: %v", s.key, err)
+	}
+	c.sources[s.key] = source
+	return nil
+}
+
+// readConfigFile returns the settings of a YAML or TOML file by key, e.g.
+// "ocr.workers" for workers in an ocr section. Lists are joined so they
+// parse like the environment variables.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		err = toml.Unmarshal(data, &doc)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	default:
+		return nil, fmt.Errorf("%s: config files must end in .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	known := map[string]setting{}
+	for _, s := range settings {
+		known[s.key] = s
+	}
+	values := map[string]string{}
+	var walk func(prefix string, m map[string]interface{}) error
+	walk = func(prefix string, m map[string]interface{}) error {
+		for k, v := range m {
+			key := prefix + k
+			if sub, ok := v.(map[string]interface{}); ok {
+				if err := walk(key+".", sub); err != nil {
+					return err
+				}
+				continue
+			}
+			s, ok := known[key]
+			if !ok {
+				return fmt.Errorf("%s: unknown setting %q", path, key)
+			}
+			if list, ok := v.([]interface{}); ok {
+				items := make([]string, len(list))
+				for i, item := range list {
+					items[i] = fmt.Sprint(item)
+				}
+				sep := s.sep
+				if sep == "" {
+					sep = ","
+				}
+				values[key] = strings.Join(items, sep)
+			} else {
+				values[key] = fmt.Sprint(v)
+			}
+		}
+		return nil
+	}
+	return values, walk("", doc)
+}
+
+// validate reports every invalid setting at once
+func (c *Config) validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(len(c.Ports) > 0, "server.ports: at least one port is needed")
+	for _, p := range c.Ports {
+		check(p > 0 && p < 65536, "server.ports: %d is not a port", p)
+	}
+	if c.GRPCPort != "off" {
+		p, err := strconv.Atoi(c.GRPCPort)
+		check(err == nil && p > 0 && p < 65536, `server.grpc_port: expected a port or "off", got %q`, c.GRPCPort)
+	}
+	check(c.ReadTimeout > 0, "server.read_timeout must be positive")
+	check(c.WriteTimeout > 0, "server.write_timeout must be positive")
+	check(c.IdleTimeout > 0, "server.idle_timeout must be positive")
+
+	check(c.Workers > 0, "ocr.workers must be at least 1")
+	check(c.QueueSize > 0, "ocr.queue_size must be at least 1")
+	check(c.QueueTimeout > 0, "ocr.queue_timeout must be positive")
+	check(c.OCRTimeout > 0, "ocr.timeout must be positive")
+	check(c.ResultTimeout > c.OCRTimeout, "ocr.result_timeout (%s) must be longer than ocr.timeout (%s)", c.ResultTimeout, c.OCRTimeout)
+	check(c.EngineCheckInterval >= 0, "ocr.engine_check_interval cannot be negative")
+	check(len(c.TesseractPaths) > 0, "ocr.tesseract_paths: at least one path is needed")
+
+	check(c.MaxUploadSize > 0, "upload.max_size must be positive")
+	check(c.MultipartMemory > 0, "upload.multipart_memory must be positive")
+
+	format := strings.ToLower(c.LogFormat)
+	check(format == "text" || format == "json", "log.format: expected text or json, got %q", c.LogFormat)
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.LogLevel)) == nil, "log.level: expected debug, info, warn or error, got %q", c.LogLevel)
+
+	check(c.WatchInterval > 0, "watch.interval must be positive")
+	check(c.WatchSettle >= 0, "watch.settle cannot be negative")
+	if _, err := parseOCROptions(c.WatchLanguage, "", c.WatchPreprocess); err != nil {
+		errs = append(errs, fmt.Errorf("watch: %v", err))
+	}
+
+	check(c.JWKSURL == "" || c.JWKSFile == "", "jwt.jwks_url and jwt.jwks_file cannot both be set")
+	return errors.Join(errs...)
+}
+
+// redactSecrets hides passwords and token-like query parameters in URLs,
+// so printed configuration can be shared
+func redactSecrets(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		return value
+	}
+	q := u.Query()
+	for k := range q {
+		lower := strings.ToLower(k)
+		for _, word := range []string{"token", "key", "secret", "password", "signature"} {
+			if strings.Contains(lower, word) {
+				q.Set(k, "xxxxx")
+			}
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.Redacted()
+}
+
+// print writes every setting with its value and where it came from
+func (c *Config) print(w io.Writer) {
+	if c.file != "" {
+		fmt.Fprintf(w, "# config file: %s\n", c.file)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tVALUE\tSOURCE")
+	for _, s := range settings {
+		value := redactSecrets(s.value(c).String())
+		if value == "" {
+			value = `""`
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.key, value, c.sources[s.key])
+	}
+	tw.Flush()
+}
+
+// runConfigCommand implements "ocr-simple config print"
+func runConfigCommand(args []string) int {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(os.Stderr, `Usage:
+  ocr-simple config print [-config FILE] [server flags]`)
+		return 2
+	}
+	c, err := loadConfig("config print", args[1:])
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errConfigUsage):
+		return 2
+	case c == nil:
+		fmt.Fprintf(os.Stderr, "❌ Error: %v\n", err)
+		return 1
+	}
+	c.print(os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Invalid configuration:\n%v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// flag.Value implementations for the Config fields
+
+type stringValue string
+
+func (v *stringValue) Set(s string) error { *v = stringValue(strings.TrimSpace(s)); return nil }
+func (v *stringValue) String() string     { return string(*v) }
+
+type intValue int
+
+func (v *intValue) Set(s string) error {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return fmt.Errorf("expected a number, got %q", s)
+	}
+	*v = intValue(n)
+	return nil
+}
+
+func (v *intValue) String() string { return strconv.Itoa(int(*v)) }
+
+type durationValue time.Duration
+
+func (v *durationValue) Set(s string) error {
+	d, err := time.ParseDuration(strings.TrimSpace(s))
+	if err != nil {
+		return fmt.Errorf("expected a duration like 30s or 2m, got %q", s)
+	}
+	*v = durationValue(d)
+	return nil
+}
+
+func (v *durationValue) String() string { return time.Duration(*v).String() }
+
+type intListValue []int
+
+func (v *intListValue) Set(s string) error {
+	var list []int
+	for _, item := range splitList(s, ",") {
+		n, err := strconv.Atoi(item)
+		if err != nil {
+			return fmt.Errorf("expected numbers separated by commas, got %q", s)
+		}
+		list = append(list, n)
+	}
+	*v = list
+	return nil
+}
+
+func (v *intListValue) String() string {
+	items := make([]string, len(*v))
+	for i, n := range *v {
+		items[i] = strconv.Itoa(n)
+	}
+	return strings.Join(items, ",")
+}
+
+type stringListValue []string
+
+func (v *stringListValue) Set(s string) error { *v = splitList(s, ","); return nil }
+func (v *stringListValue) String() string     { return strings.Join(*v, ",") }
+
+// sizeValue is a number of bytes, written as 1048576, 512KB, 10MB or 1GB;
+// the units are powers of 1024
+type sizeValue int
+
+func (v *sizeValue) Set(s string) error {
+	num, multiplier := strings.ToUpper(strings.TrimSpace(s)), 1
+	for _, u := range []struct {
+		suffix string
+		factor int
+	}{{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"B", 1}} {
+		if strings.HasSuffix(num, u.suffix) {
+			num, multiplier = strings.TrimSpace(strings.TrimSuffix(num, u.suffix)), u.factor
+			break
+		}
+	}
+	n, err := strconv.Atoi(num)
+	if err != nil {
+		return fmt.Errorf("expected a size like 10MB, got %q", s)
+	}
+	*v = sizeValue(n * multiplier)
+	return nil
+}
+
+func (v *sizeValue) String() string {
+	n := int(*v)
+	switch {
+	case n != 0 && n%(1<<30) == 0:
+		return strconv.Itoa(n>>30) + "GB"
+	case n != 0 && n%(1<<20) == 0:
+		return strconv.Itoa(n>>20) + "MB"
+	case n != 0 && n%(1<<10) == 0:
+		return strconv.Itoa(n>>10) + "KB"
+	}
+	return strconv.Itoa(n)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EngineStatus is the outcome of a Tesseract detection, returned by
+// POST /api/engine/detect
+type EngineStatus struct {
+	Available bool      `json:"available"`
+	Path      string    `json:"path,omitempty"`
+	Version   string    `json:"version,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Changed   bool      `json:"changed"` // the engine differs from the one before
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// detectMu keeps two detections from interleaving their swaps
+var detectMu sync.Mutex
+
+// detectTesseract looks for Tesseract in ocr.tesseract_paths and swaps the
+// engine under ocrMutex. Recognitions hold the read lock, so running ones
+// finish with the old engine and the next ones use the new one.
+func detectTesseract() EngineStatus {
+	detectMu.Lock()
+	defer detectMu.Unlock()
+
+	status := EngineStatus{CheckedAt: time.Now()}
+	if path, found := checkTesseractInstallation(); !found {
+		status.Error = "Tesseract was not found in " + strings.Join(config.TesseractPaths, ", ")
+	} else {
+		status.Available, status.Path, status.Version = true, path, detectTesseractVersion(path)
+	}
+
+	ocrMutex.Lock()
+	wasAvailable := tesseractFound
+	status.Changed = wasAvailable != status.Available || tesseractPath != status.Path || tesseractVersion != status.Version
+	tesseractPath, tesseractFound, tesseractVersion = status.Path, status.Available, status.Version
+	ocrMutex.Unlock()
+	setGRPCHealth(status.Available)
+
+	if status.Changed {
+		// The cached readiness test ran on the old engine
+		testOCRMu.Lock()
+		lastTestOCR = nil
+		testOCRMu.Unlock()
+
+		if status.Available {
+			slog.Info("OCR engine ready", "path", status.Path, "tesseract_version", status.Version)
+		} else if wasAvailable {
+			slog.Warn("OCR engine is no longer available", "err", status.Error)
+		}
+	}
+	return status
+}
+
+// currentEngine returns the Tesseract in use; ok is false without one
+func currentEngine() (path, version string, ok bool) {
+	ocrMutex.RLock()
+	defer ocrMutex.RUnlock()
+	return tesseractPath, tesseractVersion, tesseractFound
+}
+
+func engineAvailable() bool {
+	_, _, ok := currentEngine()
+	return ok
+}
+
+// watchTesseract re-runs detection every interval, so Tesseract being
+// installed, upgraded or removed is noticed without a restart
+func watchTesseract(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		for range time.Tick(interval) {
+			detectTesseract()
+		}
+	}()
+}
+
+func apiDetectEngineHandler(w http.ResponseWriter, r *http.Request) {
+	status := detectTesseract()
+	// The setup page reloads after a re-check and should show fresh probes
+	forgetSetupReport()
+	writeJSON(w, http.StatusOK, status)
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// doctorSample is a rendered line of text that any working Tesseract
+// reads as doctorSampleText
+//
+//go:embed doctor-sample.png
+var doctorSample []byte
+
+const doctorSampleText = "OCR SIMPLE 2024"
+
+// DoctorCheck is one line of the doctor report
+type DoctorCheck struct {
+	Name   string   `json:"name"`
+	Status string   `json:"status"` // pass, warn or fail
+	Detail string   `json:"detail"`
+	Hints  []string `json:"hints,omitempty"`
+}
+
+// doctor runs the checks in order; later ones are skipped when Tesseract
+// is missing
+func doctor() []DoctorCheck {
+	var checks []DoctorCheck
+	add := func(name, status, detail string, hints ...string) {
+		checks = append(checks, DoctorCheck{Name: name, Status: status, Detail: detail, Hints: hints})
+	}
+	help := platformHelp(runtime.GOOS)
+
+	// The same probes as checkTesseractInstallation, keeping every failure
+	var path string
+	var found TesseractProbe
+	var failures []string
+	for _, p := range config.TesseractPaths {
+		probe := probeTesseractPath(p)
+		if probe.OK {
+			path, found = p, probe
+			break
+		}
+		failures = append(failures, p+": "+probe.Error)
+	}
+	if path == "" {
+		hints := append([]string{"install Tesseract on " + help.Name + ":"}, help.Install...)
+		if help.Link != "" {
+			hints = append(hints, help.Link)
+		}
+		hints = append(hints, "or add its path to ocr.tesseract_paths (env OCR_TESSERACT_PATHS)")
+		add("Tesseract", "fail", strings.Join(failures, "; "), hints...)
+	} else {
+		detail := path
+		if found.Resolved != path {
+			detail += " → " + found.Resolved
+		}
+		if len(failures) > 0 {
+			detail += fmt.Sprintf(" (%d earlier paths not usable)", len(failures))
+		}
+		add("Tesseract", "pass", detail)
+	}
+
+	if path == "" {
+		add("Version", "fail", "skipped, Tesseract not found")
+		add("Languages", "fail", "skipped, Tesseract not found")
+		add("Round-trip OCR", "fail", "skipped, Tesseract not found")
+	} else {
+		checks = append(checks, doctorVersion(path))
+		langs, check := doctorLanguages(path, help)
+		checks = append(checks, check)
+		checks = append(checks, doctorRoundTrip(path, langs))
+	}
+
+	for _, dir := range writableDirChecks() {
+		switch {
+		case dir.Writable:
+			add("Writable: "+dir.Purpose, "pass", dir.Dir)
+		case isNotExist(dir.Dir):
+			add("Writable: "+dir.Purpose, "warn", dir.Dir+" does not exist yet; the server creates it on start")
+		default:
+			add("Writable: "+dir.Purpose, "fail", dir.Error,
+				"run the server as a user that may write to "+dir.Dir+", or start it from another directory")
+		}
+	}
+
+	checks = append(checks, doctorPorts()...)
+	return checks
+}
+
+func isNotExist(dir string) bool {
+	_, err := os.Stat(dir)
+	return errors.Is(err, os.ErrNotExist)
+}
+
+// doctorVersion parses `tesseract --version`; the LSTM engine the server
+// expects came with Tesseract 4
+func doctorVersion(path string) DoctorCheck {
+	c := DoctorCheck{Name: "Version"}
+	version := detectTesseractVersion(path)
+	major, err := strconv.Atoi(strings.SplitN(version, ".", 2)[0])
+	switch {
+	case version == "" || err != nil:
+		c.Status, c.Detail = "fail", fmt.Sprintf("could not parse the output of %s --version", path)
+		c.Hints = []string{"run `" + path + " --version` by hand; a broken install often prints a library error"}
+	case major < 4:
+		c.Status, c.Detail = "warn", version+", older than 4.0"
+		c.Hints = []string{"upgrade to Tesseract 4 or later for the LSTM engine and better accuracy"}
+	default:
+		c.Status, c.Detail = "pass", version
+	}
+	return c
+}
+
+func doctorLanguages(path string, help PlatformHelp) ([]string, DoctorCheck) {
+	c := DoctorCheck{Name: "Languages"}
+	langs, dir, err := tesseractLanguageInfo(path)
+	if err != nil {
+		c.Status, c.Detail = "fail", err.Error()
+		c.Hints = []string{"check that TESSDATA_PREFIX, if set, points at the folder holding the .traineddata files"}
+		return nil, c
+	}
+
+	installed := map[string]bool{}
+	for _, l := range langs {
+		installed[l] = true
+	}
+	var missing []string
+	for _, code := range recommendedLanguages {
+		if !installed[code] {
+			missing = append(missing, code)
+			if strings.Contains(help.Language, "%s") {
+				c.Hints = append(c.Hints, fmt.Sprintf(help.Language, code))
+			}
+		}
+	}
+	if len(c.Hints) == 0 && len(missing) > 0 && help.Language != "" {
+		c.Hints = []string{help.Language}
+	}
+
+	c.Detail = strings.Join(langs, ", ")
+	if dir != "" {
+		c.Detail += " (in " + dir + ")"
+	}
+	switch {
+	case len(langs) == 0:
+		c.Status, c.Detail = "fail", "no languages installed"
+	case len(missing) > 0:
+		c.Status = "warn"
+		c.Detail += "; recommended but missing: " + strings.Join(missing, ", ")
+	default:
+		c.Status = "pass"
+	}
+	return langs, c
+}
+
+// doctorRoundTrip recognises the embedded sample with the same code path as
+// the server's workers, temporary file included
+func doctorRoundTrip(path string, langs []string) DoctorCheck {
+	c := DoctorCheck{Name: "Round-trip OCR"}
+	if !engineAvailable() {
+		c.Status, c.Detail = "fail", "the OCR engine could not be set up with "+path
+		return c
+	}
+	opts := OCROptions{}
+	for _, l := range langs {
+		if l == "eng" {
+			opts.Language = "eng"
+		}
+	}
+
+	result := processOCRRequest(context.Background(), doctorSample, "doctor-sample.png", opts)
+	if result.Err != nil {
+		c.Status, c.Detail = "fail", result.Err.Error()
+		c.Hints = []string{"try `" + path + " IMAGE stdout` by hand to see the full error"}
+		return c
+	}
+	got := strings.Join(strings.FieldsFunc(strings.ToUpper(result.Text), func(r rune) bool {
+		return !(r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}), " ")
+	if len(result.Words) == 0 || !strings.Contains(got, doctorSampleText) {
+		c.Status = "fail"
+		c.Detail = fmt.Sprintf("expected %q, got %q", doctorSampleText, strings.TrimSpace(result.Text))
+		c.Hints = []string{"the eng traineddata may be damaged or of the wrong version; reinstall the language pack"}
+		return c
+	}
+	c.Status = "pass"
+	c.Detail = fmt.Sprintf("read %q (confidence %.0f%%)", doctorSampleText, result.Confidence)
+	return c
+}
+
+// doctorPorts tells which of server.ports and the gRPC port are free. One
+// free HTTP port is enough, the server takes the first.
+func doctorPorts() []DoctorCheck {
+	free := func(port string) error {
+		l, err := net.Listen("tcp", ":"+port)
+		if err == nil {
+			l.Close()
+		}
+		return err
+	}
+
+	c := DoctorCheck{Name: "HTTP ports"}
+	var states []string
+	first := -1
+	for i, p := range config.Ports {
+		if err := free(strconv.Itoa(p)); err != nil {
+			states = append(states, fmt.Sprintf("%d in use", p))
+		} else {
+			states = append(states, fmt.Sprintf("%d free", p))
+			if first < 0 {
+				first = i
+			}
+		}
+	}
+	c.Detail = strings.Join(states, ", ")
+	switch {
+	case first < 0:
+		c.Status = "fail"
+		c.Hints = []string{"stop the program using them (an ocr-simple already running?) or set server.ports (env OCR_PORTS)"}
+	case first > 0:
+		c.Status = "warn"
+		c.Detail += fmt.Sprintf("; the server will use %d", config.Ports[first])
+	default:
+		c.Status = "pass"
+	}
+	checks := []DoctorCheck{c}
+
+	if config.GRPCPort != "off" {
+		g := DoctorCheck{Name: "gRPC port", Status: "pass", Detail: config.GRPCPort + " free"}
+		if err := free(config.GRPCPort); err != nil {
+			g.Status, g.Detail = "warn", config.GRPCPort+" in use; the server starts without the gRPC API"
+			g.Hints = []string{`set server.grpc_port (env OCR_GRPC_PORT) to another port, or "off"`}
+		}
+		checks = append(checks, g)
+	}
+	return checks
+}
+
+// runDoctorCommand implements `ocr-simple doctor`
+func runDoctorCommand(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the report as JSON, e.g. to attach to a support ticket")
+	configFile := fs.String("config", "", "config file, YAML or TOML (env OCR_CONFIG)")
+	tesseract := fs.String("tesseract", "", "Tesseract executable, instead of ocr.tesseract_paths")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	// Like setupCLI, but a missing Tesseract is a finding, not an error
+	err := setupCLI(*configFile, *tesseract, false)
+	var notFound errEngineNotFound
+	if err != nil && !errors.As(err, &notFound) {
+		return cliSetupFailed(err)
+	}
+
+	checks := doctor()
+	failed, warned := 0, 0
+	for _, c := range checks {
+		switch c.Status {
+		case "fail":
+			failed++
+		case "warn":
+			warned++
+		}
+	}
+
+	if *asJSON {
+		data, _ := json.MarshalIndent(map[string]interface{}{
+			"version":  Version,
+			"commit":   GitCommit,
+			"platform": runtime.GOOS + "/" + runtime.GOARCH,
+			"ok":       failed == 0,
+			"checks":   checks,
+		}, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		fmt.Printf("🩺 ocr-simple doctor (%s, %s/%s)\n\n", Version, runtime.GOOS, runtime.GOARCH)
+		width := 0
+		for _, c := range checks {
+			width = max(width, len(c.Name))
+		}
+		for _, c := range checks {
+			icon := map[string]string{"pass": "✅", "warn": "⚠️ ", "fail": "❌"}[c.Status]
+			fmt.Printf("%s %-*s  %s\n", icon, width, c.Name, c.Detail)
+			for _, h := range c.Hints {
+				fmt.Printf("   → %s\n", h)
+			}
+		}
+		fmt.Printf("\n%d passed, %d warnings, %d failed\n", len(checks)-failed-warned, warned, failed)
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
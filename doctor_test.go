@@ -0,0 +1,144 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// scriptTesseract writes a Tesseract stand-in running body
+func scriptTesseract(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tesseract")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDoctorVersion(t *testing.T) {
+	tests := []struct {
+		name, tesseract, status, detail string
+	}{
+		{"current", fakeTesseract(t), "pass", "5.3.0"},
+		{"old", scriptTesseract(t, `echo "tesseract 3.05.02" >&2`), "warn", "3.05.02, older than 4.0"},
+		{"garbage", scriptTesseract(t, `echo "libtesseract.so.5: cannot open shared object file"`), "fail", "could not parse"},
+		{"crash", scriptTesseract(t, `exit 127`), "fail", "could not parse"},
+	}
+	for _, tt := range tests {
+		c := doctorVersion(tt.tesseract)
+		if c.Name != "Version" || c.Status != tt.status || !strings.Contains(c.Detail, tt.detail) {
+			t.Errorf("%s: %+v, want %s with %q", tt.name, c, tt.status, tt.detail)
+		}
+		if tt.status != "pass" && len(c.Hints) == 0 {
+			t.Errorf("%s: no hint", tt.name)
+		}
+	}
+}
+
+func TestDoctorLanguages(t *testing.T) {
+	debian := PlatformHelp{Language: "sudo apt install tesseract-ocr-%s"}
+	both := scriptTesseract(t, `printf 'List of available languages in "/usr/share/tessdata/" (3):\neng\nind\nosd\n'`)
+
+	langs, c := doctorLanguages(both, debian)
+	if c.Status != "pass" || len(langs) != 3 || c.Detail != "eng, ind, osd (in /usr/share/tessdata/)" {
+		t.Errorf("all recommended installed: %v, %+v", langs, c)
+	}
+
+	// fakeTesseract only has eng
+	langs, c = doctorLanguages(fakeTesseract(t), debian)
+	if c.Status != "warn" || len(langs) != 1 || !strings.Contains(c.Detail, "missing: ind") {
+		t.Errorf("ind missing: %v, %+v", langs, c)
+	}
+	if len(c.Hints) != 1 || c.Hints[0] != "sudo apt install tesseract-ocr-ind" {
+		t.Errorf("hints = %q", c.Hints)
+	}
+	if _, c = doctorLanguages(fakeTesseract(t), PlatformHelp{Language: "brew install tesseract-lang"}); len(c.Hints) != 1 || c.Hints[0] != "brew install tesseract-lang" {
+		t.Errorf("hint without a code = %q", c.Hints)
+	}
+
+	none := scriptTesseract(t, `echo 'List of available languages in "/tessdata/" (0):'`)
+	if _, c = doctorLanguages(none, debian); c.Status != "fail" || c.Detail != "no languages installed" {
+		t.Errorf("no languages: %+v", c)
+	}
+	broken := scriptTesseract(t, `echo "Error opening data file /tessdata/eng.traineddata" >&2; exit 1`)
+	if langs, c = doctorLanguages(broken, debian); langs != nil || c.Status != "fail" || !strings.Contains(c.Detail, "Error opening data file") || len(c.Hints) == 0 {
+		t.Errorf("failing --list-langs: %v, %+v", langs, c)
+	}
+}
+
+// freePort returns a port nothing listens on right now
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestDoctorPorts(t *testing.T) {
+	oldPorts, oldGRPC := config.Ports, config.GRPCPort
+	t.Cleanup(func() { config.Ports, config.GRPCPort = oldPorts, oldGRPC })
+
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	busy, free := l.Addr().(*net.TCPAddr).Port, freePort(t)
+
+	tests := []struct {
+		ports  []int
+		grpc   string
+		status []string
+		detail string
+	}{
+		{[]int{free}, "off", []string{"pass"}, strconv.Itoa(free) + " free"},
+		{[]int{busy, free}, "off", []string{"warn"}, "the server will use " + strconv.Itoa(free)},
+		{[]int{busy}, "off", []string{"fail"}, strconv.Itoa(busy) + " in use"},
+		{[]int{free}, strconv.Itoa(free), []string{"pass", "pass"}, ""},
+		{[]int{free}, strconv.Itoa(busy), []string{"pass", "warn"}, ""},
+	}
+	for _, tt := range tests {
+		config.Ports, config.GRPCPort = tt.ports, tt.grpc
+		checks := doctorPorts()
+		var status []string
+		for _, c := range checks {
+			status = append(status, c.Status)
+		}
+		if strings.Join(status, ",") != strings.Join(tt.status, ",") || !strings.Contains(checks[0].Detail, tt.detail) {
+			t.Errorf("ports %v, grpc %s: %+v, want %v with %q", tt.ports, tt.grpc, checks, tt.status, tt.detail)
+		}
+	}
+}
+
+func TestDoctorFindsTesseract(t *testing.T) {
+	oldPaths := config.TesseractPaths
+	t.Cleanup(func() { config.TesseractPaths = oldPaths })
+
+	tesseract := fakeTesseract(t)
+	config.TesseractPaths = []string{filepath.Join(t.TempDir(), "missing"), tesseract}
+	checks := doctor()
+	if c := checks[0]; c.Name != "Tesseract" || c.Status != "pass" || c.Detail != tesseract+" (1 earlier paths not usable)" {
+		t.Errorf("found: %+v", c)
+	}
+	if c := checks[1]; c.Status != "pass" || c.Detail != "5.3.0" {
+		t.Errorf("version: %+v", c)
+	}
+
+	config.TesseractPaths = []string{filepath.Join(t.TempDir(), "missing")}
+	checks = doctor()
+	if c := checks[0]; c.Status != "fail" || !strings.Contains(c.Detail, "missing") || len(c.Hints) == 0 {
+		t.Errorf("missing: %+v", c)
+	}
+	for _, c := range checks[1:4] {
+		if c.Status != "fail" || !strings.HasPrefix(c.Detail, "skipped") {
+			t.Errorf("%s without Tesseract: %+v", c.Name, c)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OCROptions are the Tesseract settings used for one recognition run
+type OCROptions struct {
+	Language   string `json:"language,omitempty"`   // e.g. "eng", "ind+eng"; empty uses Tesseract's default
+	PSM        int    `json:"psm,omitempty"`        // page segmentation mode, 0 uses Tesseract's default
+	Preprocess string `json:"preprocess,omitempty"` // "", "grayscale" or "threshold"
+}
+
+// OCRWord is a single recognised word with its position and confidence
+type OCRWord struct {
+	Text       string  `json:"text"`
+	Confidence float64 `json:"confidence"`
+	Page       int     `json:"page"`
+	Line       int     `json:"line"`
+	Left       int     `json:"left"`
+	Top        int     `json:"top"`
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
+}
+
+var languagePattern = regexp.MustCompile(`^[a-z][a-z_]*(\+[a-z][a-z_]*)*$`)
+
+// Validate checks the options before they are passed to Tesseract
+func (o OCROptions) Validate() error {
+	if o.Language != "" && !languagePattern.MatchString(o.Language) {
+		return fmt.Errorf("invalid language %q, expected codes like eng or ind+eng", o.Language)
+	}
+	if o.PSM < 0 || o.PSM > 13 {
+		return fmt.Errorf("invalid page segmentation mode %d, expected 0-13", o.PSM)
+	}
+	switch o.Preprocess {
+	case PreprocessNone, PreprocessGrayscale, PreprocessThreshold:
+	default:
+		return fmt.Errorf("invalid preprocess mode %q, expected grayscale or threshold", o.Preprocess)
+	}
+	return nil
+}
+
+// Label is a short human-readable summary such as "lang=eng, psm=6"
+func (o OCROptions) Label() string {
+	lang := o.Language
+	if lang == "" {
+		lang = "default"
+	}
+	parts := []string{"lang=" + lang}
+	if o.PSM > 0 {
+		parts = append(parts, "psm="+strconv.Itoa(o.PSM))
+	}
+	if o.Preprocess != "" {
+		parts = append(parts, "preprocess="+o.Preprocess)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// parseOCROptions reads the lang, psm and preprocess form or query values
+func parseOCROptions(lang, psm, preprocess string) (OCROptions, error) {
+	opts := OCROptions{
+		Language:   strings.ToLower(strings.TrimSpace(lang)),
+		Preprocess: strings.ToLower(strings.TrimSpace(preprocess)),
+	}
+	if psm = strings.TrimSpace(psm); psm != "" {
+		n, err := strconv.Atoi(psm)
+		if err != nil {
+			return opts, fmt.Errorf("invalid page segmentation mode %q", psm)
+		}
+		opts.PSM = n
+	}
+	return opts, opts.Validate()
+}
+
+// recognizeImageFile runs Tesseract with TSV output so that, besides the
+// text, every word comes back with its bounding box and confidence
+func recognizeImageFile(ctx context.Context, bin, imageFile string, opts OCROptions) (string, []OCRWord, error) {
+	args := []string{imageFile, "stdout"}
+	if opts.Language != "" {
+		args = append(args, "-l", opts.Language)
+	}
+	if opts.PSM > 0 {
+		args = append(args, "--psm", strconv.Itoa(opts.PSM))
+	}
+	args = append(args, "tsv")
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, bin, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", nil, ctx.Err()
+		}
+		return "", nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	text, words := parseTesseractTSV(stdout.String())
+	return text, words, nil
+}
+
+// parseTesseractTSV turns Tesseract's TSV output into plain text and words.
+// Words on the same line are joined with spaces and paragraphs are separated
+// by a blank line, matching Tesseract's own text output.
+func parseTesseractTSV(tsv string) (string, []OCRWord) {
+	var (
+		text     strings.Builder
+		words    []OCRWord
+		lastPara string
+		lastLine string
+		lineNo   int
+	)
+
+	scanner := bufio.NewScanner(strings.NewReader(tsv))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		// level page block par line word left top width height conf text
+		cols := strings.SplitN(scanner.Text(), "\t", 12)
+		if len(cols) < 12 || cols[0] != "5" {
+			continue
+		}
+		word := strings.TrimSpace(cols[11])
+		if word == "" {
+			continue
+		}
+
+		para := cols[1] + "." + cols[2] + "." + cols[3]
+		line := para + "." + cols[4]
+		switch {
+		case lastLine == "":
+		case para != lastPara:
+			text.WriteString("\n\n")
+		case line != lastLine:
+			text.WriteString("\n")
+		default:
+			text.WriteString(" ")
+		}
+		if line != lastLine {
+			lineNo++
+		}
+		lastPara, lastLine = para, line
+		text.WriteString(word)
+
+		atoi := func(s string) int { n, _ := strconv.Atoi(s); return n }
+		conf, _ := strconv.ParseFloat(cols[10], 64)
+		words = append(words, OCRWord{
+			Text:       word,
+			Confidence: conf,
+			Page:       atoi(cols[1]),
+			Line:       lineNo,
+			Left:       atoi(cols[6]),
+			Top:        atoi(cols[7]),
+			Width:      atoi(cols[8]),
+			Height:     atoi(cols[9]),
+		})
+	}
+
+	return text.String(), words
+}
+
+// detectTesseractVersion returns the version reported by `tesseract --version`,
+// e.g. "5.3.0", or "" if it cannot be determined
+func detectTesseractVersion(bin string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Older releases print the version on stderr
+	out, err := exec.CommandContext(ctx, bin, "--version").CombinedOutput()
+	if err != nil {
+		return ""
+	}
+	return parseTesseractVersion(string(out))
+}
+
+func parseTesseractVersion(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && strings.EqualFold(fields[0], "tesseract") {
+			return strings.TrimPrefix(fields[1], "v")
+		}
+	}
+	return ""
+}
+
+// listTesseractLanguages returns the installed language codes reported by
+// `tesseract --list-langs`, sorted
+func listTesseractLanguages(bin string) ([]string, error) {
+	langs, _, err := tesseractLanguageInfo(bin)
+	return langs, err
+}
+
+// tesseractLanguageInfo returns the installed languages and the tessdata
+// directory they were found in
+func tesseractLanguageInfo(bin string) ([]string, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, bin, "--list-langs").CombinedOutput()
+	if err != nil {
+		return nil, "", fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return parseTesseractLanguages(string(out)), parseTessdataDir(string(out)), nil
+}
+
+// parseTessdataDir reads the directory from the
+// 'List of available languages in "/usr/share/tessdata/" (3):' header
+func parseTessdataDir(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		if _, rest, ok := strings.Cut(line, `languages in "`); ok {
+			if dir, _, ok := strings.Cut(rest, `"`); ok {
+				return dir
+			}
+		}
+	}
+	return ""
+}
+
+func parseTesseractLanguages(output string) []string {
+	var langs []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		// Skip the 'List of available languages in "..." (n):' header
+		if line == "" || strings.Contains(line, " ") || strings.HasSuffix(line, ":") {
+			continue
+		}
+		langs = append(langs, line)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// meanConfidence averages the word confidences, 0 when there are no words
+func meanConfidence(words []OCRWord) float64 {
+	if len(words) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, w := range words {
+		sum += w.Confidence
+	}
+	return sum / float64(len(words))
+}
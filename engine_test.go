@@ -0,0 +1,124 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// tsvRows builds Tesseract TSV output from tab-free rows
+func tsvRows(rows ...string) string {
+	var b strings.Builder
+	b.WriteString("level\tpage_num\tblock_num\tpar_num\tline_num\tword_num\tleft\ttop\twidth\theight\tconf\ttext\n")
+	for _, r := range rows {
+		b.WriteString(strings.ReplaceAll(r, " ", "\t") + "\n")
+	}
+	return b.String()
+}
+
+func TestParseTesseractTSV(t *testing.T) {
+	tsv := tsvRows(
+		"1 1 0 0 0 0 0 0 800 600 -1 ",
+		"2 1 1 0 0 0 10 10 300 40 -1 ",
+		"4 1 1 1 1 0 10 10 300 20 -1 ",
+		"5 1 1 1 1 1 10 10 80 20 96.5 Nomor",
+		"5 1 1 1 1 2 95 10 60 20 91 Faktur",
+		"5 1 1 1 2 1 10 35 120 20 88 INV-2024/001",
+		// Tesseract emits empty words for blank areas
+		"5 1 1 1 2 2 140 35 10 20 95 ",
+		"5 1 1 2 1 1 10 80 70 20 60.25 Total",
+		"5 1 2 1 1 1 10 200 50 20 70 Lunas",
+		"5 2 1 1 1 1 5 5 40 20 99 Halaman",
+	)
+	text, words := parseTesseractTSV(tsv)
+
+	wantText := "Nomor Faktur\nINV-2024/001\n\nTotal\n\nLunas\n\nHalaman"
+	if text != wantText {
+		t.Errorf("text = %q, want %q", text, wantText)
+	}
+
+	want := []OCRWord{
+		{Text: "Nomor", Confidence: 96.5, Page: 1, Line: 1, Left: 10, Top: 10, Width: 80, Height: 20},
+		{Text: "Faktur", Confidence: 91, Page: 1, Line: 1, Left: 95, Top: 10, Width: 60, Height: 20},
+		{Text: "INV-2024/001", Confidence: 88, Page: 1, Line: 2, Left: 10, Top: 35, Width: 120, Height: 20},
+		{Text: "Total", Confidence: 60.25, Page: 1, Line: 3, Left: 10, Top: 80, Width: 70, Height: 20},
+		{Text: "Lunas", Confidence: 70, Page: 1, Line: 4, Left: 10, Top: 200, Width: 50, Height: 20},
+		{Text: "Halaman", Confidence: 99, Page: 2, Line: 5, Left: 5, Top: 5, Width: 40, Height: 20},
+	}
+	if !reflect.DeepEqual(words, want) {
+		t.Errorf("words = %+v\nwant %+v", words, want)
+	}
+}
+
+func TestParseTesseractTSVEdgeCases(t *testing.T) {
+	tests := []struct {
+		name  string
+		tsv   string
+		text  string
+		words int
+	}{
+		{"empty", "", "", 0},
+		{"header only", tsvRows(), "", 0},
+		{"no words", tsvRows("1 1 0 0 0 0 0 0 800 600 -1 "), "", 0},
+		{"short row", "5\t1\t1\t1\t1\t1\t10\n", "", 0},
+		{"windows line endings", strings.ReplaceAll(tsvRows("5 1 1 1 1 1 0 0 5 5 90 Halo"), "\n", "\r\n"), "Halo", 1},
+		// A tab inside the text column stays part of the word
+		{"tab in text", "5\t1\t1\t1\t1\t1\t0\t0\t5\t5\t90\ta\tb\n", "a\tb", 1},
+	}
+	for _, tt := range tests {
+		text, words := parseTesseractTSV(tt.tsv)
+		if text != tt.text || len(words) != tt.words {
+			t.Errorf("%s: got %q with %d words, want %q with %d", tt.name, text, len(words), tt.text, tt.words)
+		}
+	}
+}
+
+func TestMeanConfidence(t *testing.T) {
+	if got := meanConfidence(nil); got != 0 {
+		t.Errorf("meanConfidence(nil) = %v", got)
+	}
+	words := []OCRWord{{Confidence: 90}, {Confidence: 60}}
+	if got := meanConfidence(words); got != 75 {
+		t.Errorf("meanConfidence = %v, want 75", got)
+	}
+}
+
+func TestParseOCROptions(t *testing.T) {
+	tests := []struct {
+		lang, psm, preprocess string
+		want                  OCROptions
+		wantErr               bool
+	}{
+		{"", "", "", OCROptions{}, false},
+		{" IND+Eng ", "6", "", OCROptions{Language: "ind+eng", PSM: 6}, false},
+		{"eng", "", "grayscale", OCROptions{Language: "eng", Preprocess: "grayscale"}, false},
+		{"eng;rm", "", "", OCROptions{}, true},
+		{"-l", "", "", OCROptions{}, true},
+		{"", "14", "", OCROptions{}, true},
+		{"", "six", "", OCROptions{}, true},
+		{"", "", "sharpen", OCROptions{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseOCROptions(tt.lang, tt.psm, tt.preprocess)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseOCROptions(%q, %q, %q) error = %v", tt.lang, tt.psm, tt.preprocess, err)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("parseOCROptions(%q, %q, %q) = %+v, want %+v", tt.lang, tt.psm, tt.preprocess, got, tt.want)
+		}
+	}
+}
+
+func TestParseTesseractLanguages(t *testing.T) {
+	out := "List of available languages in \"/usr/share/tesseract-ocr/5/tessdata/\" (3):\neng\nosd\nind\n"
+	if got, want := parseTesseractLanguages(out), []string{"eng", "ind", "osd"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("languages = %v, want %v", got, want)
+	}
+	if got, want := parseTessdataDir(out), "/usr/share/tesseract-ocr/5/tessdata/"; got != want {
+		t.Errorf("tessdata = %q, want %q", got, want)
+	}
+	if got := parseTesseractVersion("tesseract v5.3.0\n leptonica-1.82.0\n"); got != "5.3.0" {
+		t.Errorf("version = %q", got)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error codes returned in the "code" field of every error response. Codes
+// are part of the API contract; messages are for humans and may change.
+const (
+	CodeInvalidRequest    = "invalid_request"    // input failed validation, see details
+	CodeUnsupportedMedia  = "unsupported_media"  // not an accepted image or content type
+	CodePayloadTooLarge   = "payload_too_large"  // request body over the size limit
+	CodeUnauthorized      = "unauthorized"       // missing or invalid API key
+	CodeForbidden         = "forbidden"          // API key lacks the scope for this endpoint
+	CodeNotFound          = "not_found"          // document, collection, job or page does not exist
+	CodeConflict          = "conflict"           // resource already exists
+	CodeEngineUnavailable = "engine_unavailable" // Tesseract is not installed or failed to initialise
+	CodeQuotaExceeded     = "quota_exceeded"     // daily or monthly page quota of the API key used up
+	CodeRateLimited       = "rate_limited"       // too many requests from this client, retry later
+	CodeQueueFull         = "queue_full"         // all OCR workers busy, retry later
+	CodeTimeout           = "timeout"            // OCR did not finish in time
+	CodeOCRFailed         = "ocr_failed"         // Tesseract returned an error for this image
+	CodeURLNotAllowed     = "url_not_allowed"    // url points to a private, loopback or link-local address
+	CodeFetchFailed       = "fetch_failed"       // downloading the image from url failed
+	CodeInternal          = "internal"           // unexpected server error
+)
+
+// errorCodes maps every code to its HTTP status and whether repeating the
+// same request later may succeed
+var errorCodes = map[string]struct {
+	Status    int
+	Retryable bool
+}{
+	CodeInvalidRequest:    {http.StatusBadRequest, false},
+	CodeUnsupportedMedia:  {http.StatusUnsupportedMediaType, false},
+	CodePayloadTooLarge:   {http.StatusRequestEntityTooLarge, false},
+	CodeUnauthorized:      {http.StatusUnauthorized, false},
+	CodeForbidden:         {http.StatusForbidden, false},
+	CodeNotFound:          {http.StatusNotFound, false},
+	CodeConflict:          {http.StatusConflict, false},
+	CodeEngineUnavailable: {http.StatusServiceUnavailable, false},
+	CodeQuotaExceeded:     {http.StatusTooManyRequests, true},
+	CodeRateLimited:       {http.StatusTooManyRequests, true},
+	CodeQueueFull:         {http.StatusServiceUnavailable, true},
+	CodeTimeout:           {http.StatusGatewayTimeout, true},
+	CodeOCRFailed:         {http.StatusInternalServerError, false},
+	CodeURLNotAllowed:     {http.StatusForbidden, false},
+	CodeFetchFailed:       {http.StatusBadGateway, true},
+	CodeInternal:          {http.StatusInternalServerError, true},
+}
+
+// APIError is the error model of every endpoint. JSON clients receive it
+// wrapped as {"error": ...}; browsers get the message as plain text.
+type APIError struct {
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Status    int          `json:"status"`
+	Retryable bool         `json:"retryable"`
+	Details   []FieldError `json:"details,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+
+	// retryAfter is sent as the Retry-After header when set
+	retryAfter time.Duration
+}
+
+func (e *APIError) Error() string { return e.Message }
+
+// FieldError points at a single invalid request field
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// newAPIError creates an error whose status and retryable flag follow from code
+func newAPIError(code, format string, args ...interface{}) *APIError {
+	info, ok := errorCodes[code]
+	if !ok {
+		panic("unknown error code " + code)
+	}
+	return &APIError{
+		Code:      code,
+		Message:   fmt.Sprintf(format, args...),
+		Status:    info.Status,
+		Retryable: info.Retryable,
+	}
+}
+
+// invalidField reports a single invalid request field
+func invalidField(field, format string, args ...interface{}) *APIError {
+	err := newAPIError(CodeInvalidRequest, format, args...)
+	err.Details = []FieldError{{Field: field, Message: err.Message}}
+	return err
+}
+
+// asAPIError wraps plain errors as invalid_request, for validation helpers
+// whose errors are always the caller's fault
+func asAPIError(err error, field string) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	return invalidField(field, "%s", err.Error())
+}
+
+var (
+	errEngineUnavailable = newAPIError(CodeEngineUnavailable, "Tesseract OCR not configured. Please visit /setup for installation instructions.")
+	errDocumentNotFound  = newAPIError(CodeNotFound, "Document not found")
+	errTemplateNotFound  = newAPIError(CodeInternal, "Template not found")
+)
+
+// ocrError classifies the error of an OCR run
+func ocrError(err error) *APIError {
+	switch {
+	case errors.Is(err, errOCRBusy):
+		return newAPIError(CodeQueueFull, "%s", err.Error())
+	case errors.Is(err, errOCRTimeout):
+		return newAPIError(CodeTimeout, "%s", err.Error())
+	default:
+		return newAPIError(CodeOCRFailed, "OCR failed: %v", err)
+	}
+}
+
+// wantsJSON reports whether the client expects JSON rather than a page
+func wantsJSON(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/") ||
+		r.URL.Path == "/upload" ||
+		strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// writeError writes err in the error model. Errors that are not *APIError
+// are logged and reported as internal so no details leak to the client.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		slog.ErrorContext(r.Context(), "request failed", "method", r.Method, "path", r.URL.Path, "err", err)
+		apiErr = newAPIError(CodeInternal, "Internal server error")
+	}
+
+	// Shared errors must not be modified
+	resp := *apiErr
+	resp.RequestID = requestIDFrom(r.Context())
+
+	switch {
+	case resp.retryAfter > 0:
+		w.Header().Set("Retry-After", strconv.Itoa(int(resp.retryAfter.Seconds())+1))
+	case resp.Code == CodeQueueFull:
+		w.Header().Set("Retry-After", "5")
+	case resp.Code == CodeUnauthorized:
+		w.Header().Set("WWW-Authenticate", `Bearer realm="ocr-simple"`)
+	}
+
+	if !wantsJSON(r) {
+		msg := resp.Message
+		if resp.RequestID != "" {
+			msg += " (request ID " + resp.RequestID + ")"
+		}
+		http.Error(w, msg, resp.Status)
+		return
+	}
+	writeJSON(w, resp.Status, map[string]*APIError{"error": &resp})
+}
+
+// decodeJSONBody decodes a JSON request body of at most limit bytes. An
+// empty body leaves v untouched.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, limit int64, v interface{}) *APIError {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit)).Decode(v)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case err == nil || errors.Is(err, io.EOF):
+		return nil
+	case errors.As(err, &tooLarge):
+		return newAPIError(CodePayloadTooLarge, "Request body must be at most %d bytes", tooLarge.Limit)
+	default:
+		return invalidField("body", "Invalid JSON body: %v", err)
+	}
+}
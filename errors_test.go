@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// decodeError reads the error model from a JSON error response
+func decodeError(t *testing.T, w *httptest.ResponseRecorder) APIError {
+	t.Helper()
+	var body struct {
+		Error *APIError `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error == nil {
+		t.Fatalf("response is not the error model: %v: %s", err, w.Body)
+	}
+	return *body.Error
+}
+
+func TestWriteError(t *testing.T) {
+	limited := newAPIError(CodeRateLimited, "Too many requests")
+	limited.retryAfter = 2500 * time.Millisecond
+
+	tests := []struct {
+		name      string
+		err       error
+		status    int
+		code      string
+		retryable bool
+		header    string
+		value     string
+	}{
+		{"not found", errDocumentNotFound, 404, CodeNotFound, false, "", ""},
+		{"retry after", limited, 429, CodeRateLimited, true, "Retry-After", "3"},
+		{"queue full", newAPIError(CodeQueueFull, "busy"), 503, CodeQueueFull, true, "Retry-After", "5"},
+		{"unauthorized", newAPIError(CodeUnauthorized, "API key required"), 401, CodeUnauthorized, false, "WWW-Authenticate", `Bearer realm="ocr-simple"`},
+		{"invalid field", invalidField("language", "Unknown language %q", "xx"), 400, CodeInvalidRequest, false, "", ""},
+		{"plain error", errors.New("open /var/lib/secret: permission denied"), 500, CodeInternal, true, "", ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/api/v1/documents/x", nil)
+		r = r.WithContext(context.WithValue(r.Context(), requestIDKey, "req-42"))
+		w := httptest.NewRecorder()
+		writeError(w, r, tt.err)
+
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.status)
+		}
+		got := decodeError(t, w)
+		if got.Code != tt.code || got.Status != tt.status || got.Retryable != tt.retryable || got.RequestID != "req-42" {
+			t.Errorf("%s: error = %+v", tt.name, got)
+		}
+		if tt.header != "" && w.Header().Get(tt.header) != tt.value {
+			t.Errorf("%s: %s = %q, want %q", tt.name, tt.header, w.Header().Get(tt.header), tt.value)
+		}
+		if tt.header != "Retry-After" && w.Header().Get("Retry-After") != "" {
+			t.Errorf("%s: unexpected Retry-After %q", tt.name, w.Header().Get("Retry-After"))
+		}
+	}
+
+	// Plain errors are logged, never shown to the client
+	w := httptest.NewRecorder()
+	writeError(w, httptest.NewRequest("GET", "/api/v1/health", nil), errors.New("open /var/lib/secret: permission denied"))
+	if strings.Contains(w.Body.String(), "secret") {
+		t.Errorf("internal error leaked: %s", w.Body)
+	}
+
+	// Details point at the invalid field
+	w = httptest.NewRecorder()
+	writeError(w, httptest.NewRequest("GET", "/api/v1/health", nil), invalidField("language", "Unknown language"))
+	if got := decodeError(t, w); len(got.Details) != 1 || got.Details[0].Field != "language" {
+		t.Errorf("details = %+v", got.Details)
+	}
+}
+
+func TestWriteErrorDoesNotModifySharedErrors(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/v1/documents/x", nil)
+	writeError(httptest.NewRecorder(), r.WithContext(context.WithValue(r.Context(), requestIDKey, "req-1")), errDocumentNotFound)
+	if errDocumentNotFound.RequestID != "" {
+		t.Errorf("errDocumentNotFound.RequestID = %q", errDocumentNotFound.RequestID)
+	}
+}
+
+func TestWriteErrorPlainText(t *testing.T) {
+	r := httptest.NewRequest("GET", "/history/x", nil)
+	r = r.WithContext(context.WithValue(r.Context(), requestIDKey, "req-7"))
+	w := httptest.NewRecorder()
+	writeError(w, r, errDocumentNotFound)
+
+	if w.Code != 404 || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("status %d, %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if body := strings.TrimSpace(w.Body.String()); body != "Document not found (request ID req-7)" {
+		t.Errorf("body = %q", body)
+	}
+
+	// Asking for JSON gets the error model on any path
+	r = httptest.NewRequest("GET", "/history/x", nil)
+	r.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	writeError(w, r, errDocumentNotFound)
+	if got := decodeError(t, w); got.Code != CodeNotFound {
+		t.Errorf("code = %s", got.Code)
+	}
+}
+
+// Messages with quotes, backslashes and newlines must still give valid JSON
+func TestWriteErrorEscapesMessage(t *testing.T) {
+	msg := "OCR failed: exit status 1: Error: cannot read \"scan.png\"\nC:\\scans"
+	w := httptest.NewRecorder()
+	writeError(w, httptest.NewRequest("POST", "/upload", nil), newAPIError(CodeOCRFailed, "%s", msg))
+	if got := decodeError(t, w); got.Message != msg {
+		t.Errorf("message = %q, want %q", got.Message, msg)
+	}
+}
+
+// Regression test: /upload used to build its error JSON with fmt.Sprintf,
+// which broke as soon as Tesseract's error contained quotes
+func TestUploadErrorWithQuotesIsValidJSON(t *testing.T) {
+	useTestStores(t)
+	startTestWorkers(t)
+
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho 'Error: cannot read \"scan.png\": not an image' >&2\nexit 1\n"
+	failing := filepath.Join(dir, "tesseract")
+	if err := os.WriteFile(failing, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	ocrMutex.Lock()
+	tesseractPath = failing
+	ocrMutex.Unlock()
+
+	r := httptest.NewRequest("POST", "/upload?filename=scan.png", bytes.NewReader(testPNG))
+	r.Header.Set("Content-Type", "image/png")
+	w := httptest.NewRecorder()
+	uploadHandler(w, r)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status %d, want 500", w.Code)
+	}
+	got := decodeError(t, w)
+	if got.Code != CodeOCRFailed || !strings.Contains(got.Message, `cannot read "scan.png"`) {
+		t.Errorf("error = %+v", got)
+	}
+}
+
+func TestDecodeJSONBody(t *testing.T) {
+	type body struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+	tests := []struct {
+		name  string
+		input string
+		code  string
+		want  body
+	}{
+		{"valid", `{"name":"a","count":2}`, "", body{"a", 2}},
+		{"empty", ``, "", body{"keep", 1}},
+		{"malformed", `{"name":"a"`, CodeInvalidRequest, body{}},
+		{"not JSON", `name=a`, CodeInvalidRequest, body{}},
+		{"wrong type", `{"count":"two"}`, CodeInvalidRequest, body{}},
+		{"too large", `{"name":"` + strings.Repeat("a", 100) + `"}`, CodePayloadTooLarge, body{}},
+	}
+	for _, tt := range tests {
+		v := body{"keep", 1}
+		r := httptest.NewRequest("POST", "/api/v1/collections", strings.NewReader(tt.input))
+		apiErr := decodeJSONBody(httptest.NewRecorder(), r, 64, &v)
+		switch {
+		case tt.code == "" && apiErr != nil:
+			t.Errorf("%s: unexpected error %v", tt.name, apiErr)
+		case tt.code == "" && v != tt.want:
+			t.Errorf("%s: decoded %+v, want %+v", tt.name, v, tt.want)
+		case tt.code != "" && (apiErr == nil || apiErr.Code != tt.code):
+			t.Errorf("%s: error = %v, want %s", tt.name, apiErr, tt.code)
+		case tt.code == CodeInvalidRequest && (len(apiErr.Details) != 1 || apiErr.Details[0].Field != "body"):
+			t.Errorf("%s: details = %+v, want the body field", tt.name, apiErr.Details)
+		}
+	}
+}
+
+func TestOCRErrorCodes(t *testing.T) {
+	tests := []struct {
+		err  error
+		code string
+	}{
+		{errOCRBusy, CodeQueueFull},
+		{errOCRTimeout, CodeTimeout},
+		{errors.New(`exit status 1: Error: "x"`), CodeOCRFailed},
+	}
+	for _, tt := range tests {
+		if got := ocrError(tt.err); got.Code != tt.code {
+			t.Errorf("ocrError(%v) = %s, want %s", tt.err, got.Code, tt.code)
+		}
+	}
+}
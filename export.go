@@ -0,0 +1,196 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Extra write time granted per exported document so large exports are not
+// cut off by the server's WriteTimeout
+const exportWriteGrace = 30 * time.Second
+
+// exportSidecar is the content of the per-document .json file
+type exportSidecar struct {
+	ID         string                   `json:"id"`
+	Filename   string                   `json:"filename"`
+	Text       string                   `json:"text"`
+	Words      []OCRWord                `json:"words"`
+	Confidence float64                  `json:"confidence"`
+	Options    OCROptions               `json:"options"`
+	Collection string                   `json:"collection,omitempty"`
+	Tags       []string                 `json:"tags,omitempty"`
+	Metadata   map[string]MetadataValue `json:"metadata,omitempty"`
+	CreatedAt  time.Time                `json:"created_at"`
+}
+
+// exportBaseName is the file name prefix shared by a document's image and
+// sidecars inside the archive, unique thanks to the document ID
+func exportBaseName(doc *Document) string {
+	name := strings.TrimSuffix(doc.Filename, filepath.Ext(doc.Filename))
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < 0x20 {
+			return '_'
+		}
+		return r
+	}, name)
+	return "documents/" + doc.ID + "-" + name
+}
+
+// exportHandler streams a ZIP archive of the documents selected by the same
+// q, tag, collection, from and to filters as the history page. The archive
+// is written straight to the client, never assembled in memory.
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	docs := docStore.Search(searchRequest(r), 0)
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="ocr-export-%s.zip"`, time.Now().Format("20060102-150405")))
+	w.Header().Set("Cache-Control", "no-cache")
+
+	rc := http.NewResponseController(w)
+	zw := zip.NewWriter(w)
+
+	// The manifest is written last so it only lists files that made it into the archive
+	var rows [][]string
+
+	for _, result := range docs {
+		doc := result.Document
+		if err := r.Context().Err(); err != nil {
+			slog.WarnContext(r.Context(), "export aborted", "err", err)
+			return
+		}
+		rc.SetWriteDeadline(time.Now().Add(exportWriteGrace))
+
+		// A document whose image cannot be opened is still exported with its
+		// sidecars, and the manifest says why the image is missing
+		var image io.ReadCloser
+		imageError := ""
+		if doc.ImageFile != "" {
+			f, err := os.Open(docStore.FilePath(doc, doc.ImageFile))
+			if err != nil {
+				slog.WarnContext(r.Context(), "exporting document without its image", "document_id", doc.ID, "err", err)
+				imageError = "image unavailable: " + err.Error()
+			} else {
+				image = f
+			}
+		}
+
+		row, err := exportDocument(zw, doc, image, imageError)
+		if image != nil {
+			image.Close()
+		}
+		if err != nil {
+			// An entry is cut short or the client is gone; headers are already
+			// sent, so stop and let the client see a broken archive
+			slog.WarnContext(r.Context(), "export aborted", "document_id", doc.ID, "err", err)
+			return
+		}
+		rows = append(rows, row)
+		rc.Flush()
+	}
+
+	mw, err := zw.CreateHeader(&zip.FileHeader{Name: "manifest.csv", Method: zip.Deflate, Modified: time.Now()})
+	if err == nil {
+		err = writeManifest(mw, rows)
+	}
+	if err != nil {
+		slog.WarnContext(r.Context(), "export failed", "err", err)
+		return
+	}
+
+	if err := zw.Close(); err != nil {
+		slog.WarnContext(r.Context(), "export failed", "err", err)
+	}
+}
+
+// exportDocument writes the original image (when image is not nil) and the
+// .txt and .json sidecars of doc, returning its manifest row. imageError
+// explains in the manifest why a stored image is not in the archive.
+func exportDocument(zw *zip.Writer, doc *Document, image io.Reader, imageError string) ([]string, error) {
+	base := exportBaseName(doc)
+
+	imagePath := ""
+	if image != nil {
+		imagePath = base + strings.ToLower(filepath.Ext(doc.ImageFile))
+		// Images are already compressed, store them as-is
+		iw, err := zw.CreateHeader(&zip.FileHeader{Name: imagePath, Method: zip.Store, Modified: doc.CreatedAt})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(iw, image); err != nil {
+			return nil, err
+		}
+	}
+
+	textPath := base + ".txt"
+	tw, err := zw.CreateHeader(&zip.FileHeader{Name: textPath, Method: zip.Deflate, Modified: doc.CreatedAt})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(tw, doc.Text); err != nil {
+		return nil, err
+	}
+
+	jsonPath := base + ".json"
+	jw, err := zw.CreateHeader(&zip.FileHeader{Name: jsonPath, Method: zip.Deflate, Modified: doc.CreatedAt})
+	if err != nil {
+		return nil, err
+	}
+	sidecar := exportSidecar{
+		ID:         doc.ID,
+		Filename:   doc.Filename,
+		Text:       doc.Text,
+		Words:      doc.Words,
+		Confidence: doc.Confidence,
+		Options:    doc.Options,
+		Collection: doc.Collection,
+		Tags:       doc.Tags,
+		Metadata:   doc.Metadata,
+		CreatedAt:  doc.CreatedAt,
+	}
+	if sidecar.Words == nil {
+		sidecar.Words = []OCRWord{}
+	}
+	enc := json.NewEncoder(jw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(sidecar); err != nil {
+		return nil, err
+	}
+
+	metadata := ""
+	if len(doc.Metadata) > 0 {
+		data, _ := json.Marshal(doc.Metadata)
+		metadata = string(data)
+	}
+	return []string{
+		doc.ID,
+		doc.Filename,
+		doc.CreatedAt.Format(time.RFC3339),
+		strconv.FormatInt(doc.Size, 10),
+		doc.Collection,
+		strings.Join(doc.Tags, ";"),
+		doc.Options.Language,
+		strconv.FormatFloat(doc.Confidence, 'f', 2, 64),
+		imagePath,
+		textPath,
+		jsonPath,
+		metadata,
+		imageError,
+	}, nil
+}
+
+func writeManifest(w io.Writer, rows [][]string) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "filename", "created_at", "size", "collection", "tags", "language", "confidence", "image", "text", "json", "metadata", "image_error"})
+	cw.WriteAll(rows)
+	return cw.Error()
+}
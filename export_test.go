@@ -0,0 +1,188 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// useTestStores points docStore and collectionStore at empty stores in a
+// temporary directory for the duration of a test
+func useTestStores(t *testing.T) {
+	t.Helper()
+	oldDocs, oldCollections := docStore, collectionStore
+	t.Cleanup(func() { docStore, collectionStore = oldDocs, oldCollections })
+
+	dir := t.TempDir()
+	var err error
+	if docStore, err = newDocumentStore(dir + "/documents"); err != nil {
+		t.Fatal(err)
+	}
+	if collectionStore, err = newCollectionStore(dir + "/collections.json"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// addTestDocument stores a document created at the given time
+func addTestDocument(t *testing.T, filename, text string, created time.Time, details DocumentDetails) *Document {
+	t.Helper()
+	result := OCRResponse{
+		Text:       text,
+		Words:      []OCRWord{{Text: text, Confidence: 91.5, Page: 1, Line: 1, Width: 40, Height: 12}},
+		Confidence: 91.5,
+		Options:    OCROptions{Language: "ind", PSM: 6},
+	}
+	doc, err := docStore.Add(filename, testPNG, result, details)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err = docStore.update(doc.ID, func(doc *Document) { doc.CreatedAt = created })
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// readExport runs exportHandler for query and returns the archive's files
+func readExport(t *testing.T, query string) map[string][]byte {
+	t.Helper()
+	w := httptest.NewRecorder()
+	exportHandler(w, httptest.NewRequest("GET", "/export"+query, nil))
+	if w.Code != 200 || w.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("export%s: status %d, %s", query, w.Code, w.Header().Get("Content-Type"))
+	}
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("export%s: %v", query, err)
+	}
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name], err = io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return files
+}
+
+// manifestRows returns the manifest of an export keyed by document ID
+func manifestRows(t *testing.T, files map[string][]byte) map[string]map[string]string {
+	t.Helper()
+	records, err := csv.NewReader(bytes.NewReader(files["manifest.csv"])).ReadAll()
+	if err != nil || len(records) == 0 {
+		t.Fatalf("manifest.csv: %v", err)
+	}
+	rows := map[string]map[string]string{}
+	for _, record := range records[1:] {
+		row := map[string]string{}
+		for i, column := range records[0] {
+			row[column] = record[i]
+		}
+		rows[row["id"]] = row
+	}
+	return rows
+}
+
+func TestExportArchive(t *testing.T) {
+	useTestStores(t)
+	if _, err := collectionStore.Create("Klien ABC", ""); err != nil {
+		t.Fatal(err)
+	}
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 10, 0, 0, 0, time.UTC) }
+	invoice := addTestDocument(t, "faktur.png", "Faktur 001", day(1), DocumentDetails{
+		Collection: "klien-abc",
+		Tags:       []string{"audit"},
+		Metadata:   map[string]MetadataValue{"amount": {Type: MetadataNumber, Value: "1250"}},
+	})
+	receipt := addTestDocument(t, "kwitansi.png", "Kwitansi 002", day(15), DocumentDetails{Collection: "klien-abc"})
+	other := addTestDocument(t, "lain.png", "Surat 003", day(20), DocumentDetails{Tags: []string{"audit"}})
+
+	files := readExport(t, "")
+	base := exportBaseName(invoice)
+	if !bytes.Equal(files[base+".png"], testPNG) {
+		t.Errorf("%s.png differs from the original", base)
+	}
+	if string(files[base+".txt"]) != "Faktur 001" {
+		t.Errorf("%s.txt = %q", base, files[base+".txt"])
+	}
+	var sidecar exportSidecar
+	if err := json.Unmarshal(files[base+".json"], &sidecar); err != nil {
+		t.Fatal(err)
+	}
+	if sidecar.ID != invoice.ID || len(sidecar.Words) != 1 || sidecar.Words[0].Confidence != 91.5 ||
+		sidecar.Options.Language != "ind" || sidecar.Collection != "klien-abc" || sidecar.Metadata["amount"].Value != "1250" {
+		t.Errorf("sidecar = %+v", sidecar)
+	}
+
+	rows := manifestRows(t, files)
+	if len(rows) != 3 {
+		t.Fatalf("manifest has %d rows, want 3", len(rows))
+	}
+	want := map[string]string{
+		"filename": "faktur.png", "created_at": "2024-03-01T10:00:00Z", "collection": "klien-abc",
+		"tags": "audit", "language": "ind", "confidence": "91.50", "image": base + ".png",
+		"text": base + ".txt", "json": base + ".json", "metadata": `{"amount":{"type":"number","value":"1250"}}`, "image_error": "",
+	}
+	for column, value := range want {
+		if got := rows[invoice.ID][column]; got != value {
+			t.Errorf("manifest %s = %q, want %q", column, got, value)
+		}
+	}
+
+	// Filters select the same documents as the history page
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"?collection=klien-abc", []string{invoice.ID, receipt.ID}},
+		{"?tag=audit", []string{invoice.ID, other.ID}},
+		{"?collection=klien-abc&tag=audit", []string{invoice.ID}},
+		{"?from=2024-03-10", []string{receipt.ID, other.ID}},
+		{"?to=2024-03-15", []string{invoice.ID, receipt.ID}},
+		{"?q=kwitansi", []string{receipt.ID}},
+		{"?collection=none", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for id := range manifestRows(t, readExport(t, tt.query)) {
+			got = append(got, id)
+		}
+		sort.Strings(got)
+		sort.Strings(tt.want)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("export%s = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestExportKeepsDocumentWithoutImage(t *testing.T) {
+	useTestStores(t)
+	doc := addTestDocument(t, "hilang.png", "Teks tetap ada", time.Now(), DocumentDetails{})
+	os.Remove(docStore.FilePath(doc, doc.ImageFile))
+
+	files := readExport(t, "")
+	base := exportBaseName(doc)
+	if _, ok := files[base+".png"]; ok {
+		t.Error("archive contains an image that could not be read")
+	}
+	if string(files[base+".txt"]) != "Teks tetap ada" || len(files[base+".json"]) == 0 {
+		t.Errorf("sidecars missing: %v", files)
+	}
+	row := manifestRows(t, files)[doc.ID]
+	if row == nil || row["image"] != "" || row["image_error"] == "" {
+		t.Errorf("manifest row = %v, want an empty image and an image_error", row)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	fetchTimeout      = 20 * time.Second
+	fetchDialTimeout  = 5 * time.Second
+	fetchMaxRedirects = 3
+)
+
+// Ranges that are never fetched unless allow-listed: besides loopback,
+// private and link-local addresses (checked with netip) these are shared,
+// benchmarking and reserved networks that are not reachable on the internet
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// fetchAllowlist holds the hosts and networks from OCR_FETCH_ALLOW, e.g.
+// "10.0.5.0/24,images.internal", that may be fetched despite the guard
+type fetchAllowlist struct {
+	hosts    map[string]bool
+	prefixes []netip.Prefix
+}
+
+func parseFetchAllowlist(value string) fetchAllowlist {
+	allow := fetchAllowlist{hosts: map[string]bool{}}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if p, err := netip.ParsePrefix(entry); err == nil {
+			allow.prefixes = append(allow.prefixes, p.Masked())
+		} else if a, err := netip.ParseAddr(entry); err == nil {
+			allow.prefixes = append(allow.prefixes, netip.PrefixFrom(a, a.BitLen()))
+		} else if strings.ContainsAny(entry, "/:") {
+			slog.Warn("ignoring OCR_FETCH_ALLOW entry", "entry", entry)
+		} else {
+			allow.hosts[entry] = true
+		}
+	}
+	return allow
+}
+
+func (a fetchAllowlist) allowsAddr(addr netip.Addr) bool {
+	for _, p := range a.prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// isBlockedAddr reports whether addr is in a range the server must not reach
+// on behalf of a client
+func isBlockedAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return true
+	}
+	for _, p := range blockedPrefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+var errBlockedAddress = errors.New("address not allowed")
+
+// guardedDial resolves the host itself and only connects to addresses that
+// pass the guard or are allow-listed. Dialling the checked IP, rather than
+// the name, means a DNS answer cannot change between the check and the
+// connection.
+func (a fetchAllowlist) guardedDial(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	hostAllowed := a.hosts[strings.ToLower(host)]
+
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: fetchDialTimeout}
+	var lastErr error = errBlockedAddress
+	for _, ip := range ips {
+		if isBlockedAddr(ip) && !hostAllowed && !a.allowsAddr(ip.Unmap()) {
+			continue
+		}
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.Unmap().String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// fetchClient downloads image URLs; serve replaces it with one that honours
+// OCR_FETCH_ALLOW
+var fetchClient = newFetchClient(fetchAllowlist{})
+
+func newFetchClient(allow fetchAllowlist) *http.Client {
+	return &http.Client{
+		Timeout: fetchTimeout,
+		Transport: &http.Transport{
+			// Never go through a proxy, it would do its own (unguarded) resolving
+			Proxy:                 nil,
+			DialContext:           allow.guardedDial,
+			TLSHandshakeTimeout:   5 * time.Second,
+			ResponseHeaderTimeout: 10 * time.Second,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > fetchMaxRedirects {
+				return fmt.Errorf("more than %d redirects", fetchMaxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+// fetchImage downloads an image for recognition, returning it with a file
+// name taken from the response or the URL
+func fetchImage(ctx context.Context, rawURL string) ([]byte, string, *APIError) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, "", invalidField("url", "url must be an absolute http or https URL")
+	}
+	if u.User != nil {
+		return nil, "", invalidField("url", "url must not contain credentials")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", invalidField("url", "%v", err)
+	}
+	req.Header.Set("Accept", "image/*")
+	req.Header.Set("User-Agent", "ocr-simple")
+
+	resp, err := fetchClient.Do(req)
+	if err != nil {
+		if errors.Is(err, errBlockedAddress) {
+			return nil, "", newAPIError(CodeURLNotAllowed, "url resolves to a private, loopback or link-local address")
+		}
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return nil, "", newAPIError(CodeFetchFailed, "Fetching the image timed out")
+		}
+		return nil, "", newAPIError(CodeFetchFailed, "Fetching the image failed: %v", unwrapURLError(err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", newAPIError(CodeFetchFailed, "Fetching the image failed: server answered %s", resp.Status)
+	}
+	if resp.ContentLength > int64(config.MaxUploadSize) {
+		return nil, "", newAPIError(CodePayloadTooLarge, "Image must be at most %d bytes", config.MaxUploadSize)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "" && mediaType != "application/octet-stream" && !strings.HasPrefix(mediaType, "image/") {
+		return nil, "", newAPIError(CodeUnsupportedMedia, "url does not point to an image (Content-Type %q)", mediaType)
+	}
+
+	image, err := io.ReadAll(io.LimitReader(resp.Body, int64(config.MaxUploadSize)+1))
+	if err != nil {
+		return nil, "", newAPIError(CodeFetchFailed, "Fetching the image failed: %v", err)
+	}
+	if len(image) > config.MaxUploadSize {
+		return nil, "", newAPIError(CodePayloadTooLarge, "Image must be at most %d bytes", config.MaxUploadSize)
+	}
+	// The header can lie; the content decides
+	if detectImageExt(image) == "" {
+		return nil, "", newAPIError(CodeUnsupportedMedia, "url does not point to a PNG, JPG, GIF, BMP or TIFF image")
+	}
+
+	filename := ""
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		filename = params["filename"]
+	}
+	if filename == "" {
+		filename = path.Base(resp.Request.URL.Path)
+	}
+	return image, filename, nil
+}
+
+// unwrapURLError drops the "Get <url>:" prefix of client errors
+func unwrapURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
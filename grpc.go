@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"ocr-simple/ocrpb"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// maxGRPCMessageSize leaves room for the other fields of a RecognizeRequest
+// next to the image
+func maxGRPCMessageSize() int {
+	return config.MaxUploadSize + 1<<20
+}
+
+// grpcCodes maps the error codes of the HTTP API to gRPC status codes
+var grpcCodes = map[string]codes.Code{
+	CodeInvalidRequest:    codes.InvalidArgument,
+	CodeUnsupportedMedia:  codes.InvalidArgument,
+	CodePayloadTooLarge:   codes.ResourceExhausted,
+	CodeUnauthorized:      codes.Unauthenticated,
+	CodeForbidden:         codes.PermissionDenied,
+	CodeNotFound:          codes.NotFound,
+	CodeConflict:          codes.AlreadyExists,
+	CodeEngineUnavailable: codes.Unavailable,
+	CodeQuotaExceeded:     codes.ResourceExhausted,
+	CodeRateLimited:       codes.ResourceExhausted,
+	CodeQueueFull:         codes.ResourceExhausted,
+	CodeTimeout:           codes.DeadlineExceeded,
+	CodeOCRFailed:         codes.Internal,
+	CodeURLNotAllowed:     codes.PermissionDenied,
+	CodeFetchFailed:       codes.Unavailable,
+	CodeInternal:          codes.Internal,
+}
+
+// grpcHealth answers the standard health checks; detectTesseract keeps it
+// in step with the engine, so checks fail while Tesseract is missing
+var grpcHealth = health.NewServer()
+
+// setGRPCHealth reports the server and the OCR service as serving or not
+func setGRPCHealth(available bool) {
+	st := healthpb.HealthCheckResponse_NOT_SERVING
+	if available {
+		st = healthpb.HealthCheckResponse_SERVING
+	}
+	grpcHealth.SetServingStatus("", st)
+	grpcHealth.SetServingStatus(ocrpb.OCR_ServiceDesc.ServiceName, st)
+}
+
+// startGRPCServer serves ocrpb.OCR next to the HTTP server. A port that
+// cannot be opened is logged and does not stop the HTTP server.
+func startGRPCServer() {
+	port := config.GRPCPort
+	if port == "off" {
+		return
+	}
+
+	lis, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		slog.Warn("gRPC server could not start", "err", err)
+		return
+	}
+
+	server := newGRPCServer()
+	slog.Info("gRPC server started", "addr", "localhost:"+port)
+	go func() {
+		if err := server.Serve(lis); err != nil {
+			slog.Error("gRPC server stopped", "err", err)
+		}
+	}()
+}
+
+// newGRPCServer registers the OCR, health and reflection services behind the
+// tracing, request ID, auth and rate limit interceptors
+func newGRPCServer() *grpc.Server {
+	server := grpc.NewServer(
+		grpc.MaxRecvMsgSize(maxGRPCMessageSize()),
+		grpc.ChainUnaryInterceptor(grpcUnaryTracing, grpcUnaryRequestID, grpcUnaryAuth, grpcUnaryRateLimit),
+		grpc.ChainStreamInterceptor(grpcStreamTracing, grpcStreamRequestID, grpcStreamAuth, grpcStreamRateLimit),
+	)
+	ocrpb.RegisterOCRServer(server, grpcServer{})
+	setGRPCHealth(engineAvailable())
+	healthpb.RegisterHealthServer(server, grpcHealth)
+	reflection.Register(server)
+	return server
+}
+
+// grpcServer implements the gRPC API on the same recognition path, and so
+// the same worker pool, as /api/v1
+type grpcServer struct {
+	ocrpb.UnimplementedOCRServer
+}
+
+func (grpcServer) Recognize(ctx context.Context, req *ocrpb.RecognizeRequest) (*ocrpb.Recognition, error) {
+	rec, err := grpcRecognize(ctx, req, nil)
+	if err != nil {
+		return nil, err
+	}
+	return recognitionToProto(rec), nil
+}
+
+func (grpcServer) Upload(stream ocrpb.OCR_UploadServer) error {
+	ctx := stream.Context()
+
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	header := first.GetHeader()
+	if header == nil {
+		return grpcError(ctx, invalidField("header", "The first message must be the header"))
+	}
+	if header.GetImage() != nil {
+		return grpcError(ctx, invalidField("image", "Send the image as chunks after the header"))
+	}
+
+	var image bytes.Buffer
+	for {
+		msg, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if msg.GetHeader() != nil {
+			return grpcError(ctx, invalidField("header", "Only the first message may be a header"))
+		}
+		if image.Len()+len(msg.GetChunk()) > config.MaxUploadSize {
+			return grpcError(ctx, newAPIError(CodePayloadTooLarge, "Image must be at most %d bytes", config.MaxUploadSize))
+		}
+		image.Write(msg.GetChunk())
+	}
+	if image.Len() > 0 && header.GetUrl() != "" {
+		return grpcError(ctx, invalidField("url", "Send either chunks or url, not both"))
+	}
+
+	rec, err := grpcRecognize(ctx, header, image.Bytes())
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(recognitionToProto(rec))
+}
+
+// RecognizePages sends one message per page. Tesseract reads all pages of
+// a file in one run, so nothing is sent before the whole file is done.
+func (grpcServer) RecognizePages(req *ocrpb.RecognizeRequest, stream ocrpb.OCR_RecognizePagesServer) error {
+	rec, err := grpcRecognize(stream.Context(), req, nil)
+	if err != nil {
+		return err
+	}
+
+	pageCount := 1
+	for _, w := range rec.Words {
+		pageCount = max(pageCount, w.Page)
+	}
+	pages := make([][]OCRWord, pageCount)
+	for _, w := range rec.Words {
+		if w.Page >= 1 {
+			pages[w.Page-1] = append(pages[w.Page-1], w)
+		}
+	}
+
+	for i, words := range pages {
+		err := stream.Send(&ocrpb.PageResult{
+			Page:       int32(i + 1),
+			PageCount:  int32(pageCount),
+			Text:       wordsText(words),
+			Words:      wordsToProto(words),
+			Confidence: meanConfidence(words),
+			DocumentId: rec.DocumentID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (grpcServer) ListLanguages(ctx context.Context, _ *ocrpb.ListLanguagesRequest) (*ocrpb.ListLanguagesResponse, error) {
+	path, _, ok := currentEngine()
+	if !ok {
+		return nil, grpcError(ctx, errEngineUnavailable)
+	}
+	langs, err := listTesseractLanguages(path)
+	if err != nil {
+		slog.WarnContext(ctx, "listing Tesseract languages failed", "err", err)
+		return nil, grpcError(ctx, newAPIError(CodeInternal, "Failed to list Tesseract languages"))
+	}
+	return &ocrpb.ListLanguagesResponse{Languages: langs}, nil
+}
+
+// grpcRecognize validates req like the HTTP API does and runs OCR. chunks,
+// if not nil, is the image sent by Upload.
+func grpcRecognize(ctx context.Context, req *ocrpb.RecognizeRequest, chunks []byte) (*Recognition, error) {
+	if !engineAvailable() {
+		return nil, grpcError(ctx, errEngineUnavailable)
+	}
+
+	image, filename := chunks, req.GetFilename()
+	if image == nil {
+		image = req.GetImage()
+	}
+	if len(image) == 0 && req.GetUrl() != "" {
+		var apiErr *APIError
+		var fetchedName string
+		if image, fetchedName, apiErr = fetchImage(ctx, req.GetUrl()); apiErr != nil {
+			return nil, grpcError(ctx, apiErr)
+		}
+		if filename == "" {
+			filename = fetchedName
+		}
+	}
+	if len(image) == 0 {
+		return nil, grpcError(ctx, invalidField("image", "image or url is required"))
+	}
+	if len(image) > config.MaxUploadSize {
+		return nil, grpcError(ctx, newAPIError(CodePayloadTooLarge, "Image must be at most %d bytes", config.MaxUploadSize))
+	}
+
+	opts := req.GetOptions()
+	psm := ""
+	if opts.GetPsm() != 0 {
+		psm = strconv.Itoa(int(opts.GetPsm()))
+	}
+	var meta []byte
+	if req.GetMetadata() != nil {
+		meta, _ = req.GetMetadata().MarshalJSON()
+	}
+	store := ""
+	if req.Store != nil {
+		store = strconv.FormatBool(req.GetStore())
+	}
+
+	input, apiErr := newRecognitionInput(filename, image, opts.GetLanguage(), psm, opts.GetPreprocess(),
+		req.GetCollection(), req.GetTags(), meta, store)
+	if apiErr != nil {
+		return nil, grpcError(ctx, apiErr)
+	}
+	input.KeyID = apiKeyIDFrom(ctx)
+	rec, apiErr := recognize(ctx, input, runOCR)
+	if apiErr != nil {
+		return nil, grpcError(ctx, apiErr)
+	}
+	return rec, nil
+}
+
+// grpcError converts an *APIError to a gRPC status. The error code goes in
+// an ErrorInfo detail so clients can switch on the same codes as over HTTP.
+func grpcError(ctx context.Context, apiErr *APIError) error {
+	info := &errdetails.ErrorInfo{
+		Reason: apiErr.Code,
+		Domain: "ocr-simple",
+		Metadata: map[string]string{
+			"retryable":  strconv.FormatBool(apiErr.Retryable),
+			"request_id": requestIDFrom(ctx),
+		},
+	}
+	details := []protoadapt.MessageV1{info}
+	if len(apiErr.Details) > 0 {
+		br := &errdetails.BadRequest{}
+		for _, d := range apiErr.Details {
+			br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{Field: d.Field, Description: d.Message})
+		}
+		details = append(details, br)
+	}
+	switch {
+	case apiErr.retryAfter > 0:
+		details = append(details, &errdetails.RetryInfo{RetryDelay: durationpb.New(apiErr.retryAfter)})
+	case apiErr.Code == CodeQueueFull:
+		details = append(details, &errdetails.RetryInfo{RetryDelay: durationpb.New(5 * time.Second)})
+	}
+
+	st, err := status.New(grpcCodes[apiErr.Code], apiErr.Message).WithDetails(details...)
+	if err != nil {
+		return status.Error(grpcCodes[apiErr.Code], apiErr.Message)
+	}
+	return st.Err()
+}
+
+func recognitionToProto(rec *Recognition) *ocrpb.Recognition {
+	return &ocrpb.Recognition{
+		DocumentId: rec.DocumentID,
+		Filename:   rec.Filename,
+		Text:       rec.Text,
+		Words:      wordsToProto(rec.Words),
+		Confidence: rec.Confidence,
+		Options: &ocrpb.Options{
+			Language:   rec.Options.Language,
+			Psm:        int32(rec.Options.PSM),
+			Preprocess: rec.Options.Preprocess,
+		},
+		EngineVersion: rec.EngineVersion,
+	}
+}
+
+func wordsToProto(words []OCRWord) []*ocrpb.Word {
+	out := make([]*ocrpb.Word, len(words))
+	for i, w := range words {
+		out[i] = &ocrpb.Word{
+			Text:       w.Text,
+			Confidence: w.Confidence,
+			Page:       int32(w.Page),
+			Line:       int32(w.Line),
+			Left:       int32(w.Left),
+			Top:        int32(w.Top),
+			Width:      int32(w.Width),
+			Height:     int32(w.Height),
+		}
+	}
+	return out
+}
+
+// wordsText joins words into lines of text
+func wordsText(words []OCRWord) string {
+	var b strings.Builder
+	for i, w := range words {
+		if i > 0 {
+			if w.Line != words[i-1].Line {
+				b.WriteString("\n")
+			} else {
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString(w.Text)
+	}
+	return b.String()
+}
+
+// grpcUnaryRequestID and grpcStreamRequestID do for gRPC what withRequestID
+// does for HTTP, using the x-request-id metadata key
+func grpcUnaryRequestID(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(grpcWithRequestID(ctx), req)
+}
+
+func grpcStreamRequestID(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, requestIDStream{ss, grpcWithRequestID(ss.Context())})
+}
+
+func grpcWithRequestID(ctx context.Context) context.Context {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get("x-request-id"); len(ids) > 0 {
+			id = ids[0]
+		}
+	}
+	id = requestIDOrNew(id)
+	grpc.SetHeader(ctx, metadata.Pairs("x-request-id", id))
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+type requestIDStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s requestIDStream) Context() context.Context { return s.ctx }
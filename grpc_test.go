@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"ocr-simple/ocrpb"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// dialTestGRPC serves newGRPCServer over an in-memory connection and
+// returns a client connected to it
+func dialTestGRPC(t *testing.T) *grpc.ClientConn {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	server := newGRPCServer()
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// useTestAPIKeys replaces apiKeys with an empty store, which leaves
+// authentication off until a key is created
+func useTestAPIKeys(t *testing.T) {
+	t.Helper()
+	old := apiKeys
+	t.Cleanup(func() { apiKeys = old })
+	var err error
+	if apiKeys, err = newAPIKeyStore(t.TempDir() + "/apikeys.json"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// startTestGRPC runs a gRPC server on the fake engine with empty stores
+// and without rate limits
+func startTestGRPC(t *testing.T) ocrpb.OCRClient {
+	t.Helper()
+	useTestStores(t)
+	useTestAPIKeys(t)
+	startTestWorkers(t)
+	setRateLimitRules(t, nil)
+	return ocrpb.NewOCRClient(dialTestGRPC(t))
+}
+
+// grpcReason returns the error code of the HTTP API carried by a gRPC error
+func grpcReason(err error) string {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info.Reason
+		}
+	}
+	return ""
+}
+
+// namedImage is a PNG that the fake Tesseract reads as text
+func namedImage(text string) []byte {
+	return append(append([]byte{}, testPNG[:8]...), "\n"+text+"\n"...)
+}
+
+func TestGRPCRecognize(t *testing.T) {
+	client := startTestGRPC(t)
+	ctx := context.Background()
+
+	rec, err := client.Recognize(ctx, &ocrpb.RecognizeRequest{
+		Source:   &ocrpb.RecognizeRequest_Image{Image: namedImage("faktur")},
+		Filename: "scan.png",
+		Options:  &ocrpb.Options{Language: "ind", Psm: 6},
+		Tags:     []string{"audit"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Text != "faktur" || len(rec.Words) != 1 || rec.EngineVersion != "5.3.0" ||
+		rec.Options.GetLanguage() != "ind" || rec.Options.GetPsm() != 6 {
+		t.Errorf("recognition = %+v", rec)
+	}
+	doc, ok := docStore.Get(rec.DocumentId)
+	if !ok || doc.Filename != "scan.png" || !hasTag(doc, "audit") {
+		t.Errorf("stored document = %+v", doc)
+	}
+
+	store := false
+	if rec, err := client.Recognize(ctx, &ocrpb.RecognizeRequest{Source: &ocrpb.RecognizeRequest_Image{Image: namedImage("x")}, Store: &store}); err != nil || rec.DocumentId != "" {
+		t.Errorf("store=false: %v, document %q", err, rec.GetDocumentId())
+	}
+
+	tests := []struct {
+		name   string
+		req    *ocrpb.RecognizeRequest
+		code   codes.Code
+		reason string
+	}{
+		{"no image", &ocrpb.RecognizeRequest{}, codes.InvalidArgument, CodeInvalidRequest},
+		{"not an image", &ocrpb.RecognizeRequest{Source: &ocrpb.RecognizeRequest_Image{Image: []byte("%PDF-1.7")}}, codes.InvalidArgument, CodeUnsupportedMedia},
+		{"bad psm", &ocrpb.RecognizeRequest{Source: &ocrpb.RecognizeRequest_Image{Image: namedImage("x")}, Options: &ocrpb.Options{Psm: 99}}, codes.InvalidArgument, CodeInvalidRequest},
+	}
+	for _, tt := range tests {
+		_, err := client.Recognize(ctx, tt.req)
+		if status.Code(err) != tt.code || grpcReason(err) != tt.reason {
+			t.Errorf("%s: %v, want %s with reason %s", tt.name, err, tt.code, tt.reason)
+		}
+	}
+}
+
+func TestGRPCUpload(t *testing.T) {
+	client := startTestGRPC(t)
+	setMaxUploadSize(t, 1024)
+	ctx := context.Background()
+
+	upload := func(header *ocrpb.RecognizeRequest, chunks ...[]byte) (*ocrpb.Recognition, error) {
+		stream, err := client.Upload(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if header != nil {
+			if err := stream.Send(&ocrpb.UploadRequest{Part: &ocrpb.UploadRequest_Header{Header: header}}); err != nil {
+				return nil, err
+			}
+		}
+		for _, chunk := range chunks {
+			if err := stream.Send(&ocrpb.UploadRequest{Part: &ocrpb.UploadRequest_Chunk{Chunk: chunk}}); err != nil && err != io.EOF {
+				return nil, err
+			}
+		}
+		return stream.CloseAndRecv()
+	}
+
+	image := namedImage("kwitansi")
+	rec, err := upload(&ocrpb.RecognizeRequest{Filename: "kwitansi.png"}, image[:5], image[5:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Text != "kwitansi" || rec.Filename != "kwitansi.png" {
+		t.Errorf("recognition = %+v", rec)
+	}
+
+	// The limit applies to the sum of the chunks, not to each message
+	big := namedImage(strings.Repeat("a", 1015))
+	_, err = upload(&ocrpb.RecognizeRequest{}, big[:600], big[600:])
+	if status.Code(err) != codes.ResourceExhausted || grpcReason(err) != CodePayloadTooLarge {
+		t.Errorf("%d bytes in two chunks: %v, want %s", len(big), err, CodePayloadTooLarge)
+	}
+	exact := namedImage(strings.Repeat("a", 1014))
+	if _, err := upload(&ocrpb.RecognizeRequest{}, exact[:512], exact[512:]); err != nil {
+		t.Errorf("%d bytes refused: %v", len(exact), err)
+	}
+
+	if _, err := upload(nil, image); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("chunks without a header: %v, want InvalidArgument", err)
+	}
+	if _, err := upload(&ocrpb.RecognizeRequest{Source: &ocrpb.RecognizeRequest_Image{Image: image}}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("image inside the header: %v, want InvalidArgument", err)
+	}
+}
+
+func TestGRPCRecognizePages(t *testing.T) {
+	client := startTestGRPC(t)
+
+	stream, err := client.RecognizePages(context.Background(), &ocrpb.RecognizeRequest{Source: &ocrpb.RecognizeRequest_Image{Image: namedImage("satu|dua|tiga")}, Filename: "pages.tiff"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pages []*ocrpb.PageResult
+	for {
+		page, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, page)
+	}
+
+	want := []string{"satu", "dua", "tiga"}
+	if len(pages) != len(want) {
+		t.Fatalf("%d pages, want %d", len(pages), len(want))
+	}
+	for i, page := range pages {
+		if page.Page != int32(i+1) || page.PageCount != 3 || page.Text != want[i] || len(page.Words) != 1 || page.DocumentId == "" {
+			t.Errorf("page %d = %+v", i+1, page)
+		}
+	}
+}
+
+func TestGRPCAuth(t *testing.T) {
+	client := startTestGRPC(t)
+	conn := dialTestGRPC(t)
+	_, reader, _ := apiKeys.Create("reader", []string{ScopeRead}, 0, 0)
+	_, ocrKey, _ := apiKeys.Create("ocr", []string{ScopeOCR}, 0, 0)
+
+	call := func(md ...string) error {
+		ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs(md...))
+		_, err := client.Recognize(ctx, &ocrpb.RecognizeRequest{Source: &ocrpb.RecognizeRequest_Image{Image: namedImage("x")}})
+		return err
+	}
+	tests := []struct {
+		name string
+		md   []string
+		code codes.Code
+	}{
+		{"no key", nil, codes.Unauthenticated},
+		{"unknown key", []string{"x-api-key", "ocr_unknown"}, codes.Unauthenticated},
+		{"key without the ocr scope", []string{"authorization", "Bearer " + reader}, codes.PermissionDenied},
+		{"bearer key", []string{"authorization", "Bearer " + ocrKey}, codes.OK},
+		{"x-api-key", []string{"x-api-key", ocrKey}, codes.OK},
+	}
+	for _, tt := range tests {
+		if code := status.Code(call(tt.md...)); code != tt.code {
+			t.Errorf("%s: %s, want %s", tt.name, code, tt.code)
+		}
+	}
+
+	// Health checks stay open for load balancers
+	if _, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Errorf("health check without a key: %v", err)
+	}
+}
+
+func TestGRPCRateLimit(t *testing.T) {
+	client := startTestGRPC(t)
+	setRateLimitRules(t, map[string]*rateLimitRule{"upload": {Rate: 1.0 / 60, Burst: 2}})
+	old := rateLimiter
+	rateLimiter = &RateLimiter{buckets: make(map[string]*tokenBucket)}
+	t.Cleanup(func() { rateLimiter = old })
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.Recognize(ctx, &ocrpb.RecognizeRequest{Source: &ocrpb.RecognizeRequest_Image{Image: namedImage("x")}}); err != nil {
+			t.Fatalf("request %d within the burst: %v", i+1, err)
+		}
+	}
+
+	// Streams count against the same bucket
+	stream, err := client.RecognizePages(ctx, &ocrpb.RecognizeRequest{Source: &ocrpb.RecognizeRequest_Image{Image: namedImage("x")}})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.ResourceExhausted || grpcReason(err) != CodeRateLimited {
+		t.Fatalf("request over the burst: %v, want %s", err, CodeRateLimited)
+	}
+	var retry *errdetails.RetryInfo
+	for _, detail := range status.Convert(err).Details() {
+		if r, ok := detail.(*errdetails.RetryInfo); ok {
+			retry = r
+		}
+	}
+	if retry == nil || retry.RetryDelay.AsDuration() <= 0 {
+		t.Errorf("no RetryInfo in %v", status.Convert(err).Details())
+	}
+
+	if _, err := client.ListLanguages(ctx, &ocrpb.ListLanguagesRequest{}); err != nil {
+		t.Errorf("ListLanguages is not rate limited: %v", err)
+	}
+}
+
+func TestGRPCHealthFollowsDetection(t *testing.T) {
+	startTestGRPC(t)
+	health := healthpb.NewHealthClient(dialTestGRPC(t))
+	check := func() healthpb.HealthCheckResponse_ServingStatus {
+		t.Helper()
+		res, err := health.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "ocr.v1.OCR"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.Status
+	}
+	if got := check(); got != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("with an engine: %s", got)
+	}
+
+	oldPaths := config.TesseractPaths
+	config.TesseractPaths = []string{t.TempDir() + "/missing"}
+	t.Cleanup(func() { config.TesseractPaths = oldPaths })
+	detectTesseract()
+	if got := check(); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("after Tesseract disappeared: %s", got)
+	}
+	t.Cleanup(func() { setGRPCHealth(engineAvailable()) })
+}
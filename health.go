@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A passing test OCR is trusted for this long, so frequent probes do not
+// start Tesseract every time. A failing one is repeated sooner, but not on
+// every probe while the engine is broken.
+const (
+	readyCheckInterval = 30 * time.Second
+	readyRetryInterval = 5 * time.Second
+)
+
+var (
+	startTime   = time.Now()
+	busyWorkers atomic.Int32
+)
+
+// testOCRResult is the outcome of the last readiness test OCR
+type testOCRResult struct {
+	OK        bool      `json:"ok"`
+	Error     string    `json:"error,omitempty"`
+	Duration  float64   `json:"duration_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+var (
+	testOCRMu   sync.Mutex
+	lastTestOCR *testOCRResult
+)
+
+// runTestOCR recognises a small blank image with Tesseract directly, not
+// through ocrWorkerPool, so probes neither wait for nor take a queue slot
+func runTestOCR() testOCRResult {
+	testOCRMu.Lock()
+	defer testOCRMu.Unlock()
+	if lastTestOCR != nil {
+		ttl := readyRetryInterval
+		if lastTestOCR.OK {
+			ttl = readyCheckInterval
+		}
+		if time.Since(lastTestOCR.CheckedAt) < ttl {
+			recordCacheLookup("readiness_test", true)
+			return *lastTestOCR
+		}
+	}
+	recordCacheLookup("readiness_test", false)
+
+	start := time.Now()
+	res := testOCRResult{CheckedAt: start}
+	err := func() error {
+		img := image.NewGray(image.Rect(0, 0, 64, 32))
+		for i := range img.Pix {
+			img.Pix[i] = 0xff
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return err
+		}
+		file, err := writeTempImage(buf.Bytes(), ".png")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(file)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		// ocrMutex is not held while Tesseract runs, so a slow test does not
+		// hold up re-detection or the engineAvailable checks behind it
+		path, _, _ := currentEngine()
+		_, _, err = recognizeImageFile(ctx, path, file, OCROptions{})
+		return err
+	}()
+	res.Duration = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		res.Error = err.Error()
+	} else {
+		res.OK = true
+	}
+	lastTestOCR = &res
+	return res
+}
+
+// healthzHandler only tells that the process is alive and serving
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-cache")
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":         "ok",
+		"uptime_seconds": int64(time.Since(startTime).Seconds()),
+	})
+}
+
+// ReadinessCheck is one condition of GET /readyz
+type ReadinessCheck struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+// readyzHandler answers 200 only when requests can be served: the engine is
+// initialised, a test OCR succeeds and the queue has room
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	var checks []ReadinessCheck
+	ready := true
+	add := func(name string, ok bool, message string) {
+		checks = append(checks, ReadinessCheck{Name: name, OK: ok, Message: message})
+		ready = ready && ok
+	}
+
+	if _, version, ok := currentEngine(); ok {
+		add("engine", true, "Tesseract "+version)
+		test := runTestOCR()
+		add("test_ocr", test.OK, test.Error)
+	} else {
+		add("engine", false, "Tesseract is not installed or failed to initialise")
+		add("test_ocr", false, "skipped")
+	}
+
+	queued, capacity := len(ocrWorkerPool), cap(ocrWorkerPool)
+	if queued >= capacity {
+		add("queue", false, fmt.Sprintf("queue full (%d/%d)", queued, capacity))
+	} else {
+		add("queue", true, fmt.Sprintf("%d/%d queued", queued, capacity))
+	}
+
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "not_ready", http.StatusServiceUnavailable
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	writeJSON(w, code, map[string]interface{}{"status": status, "checks": checks})
+}
+
+// Diagnostics is the body of GET /api/diagnostics
+type Diagnostics struct {
+	Tesseract struct {
+		Available      bool     `json:"available"`
+		Path           string   `json:"path,omitempty"`
+		Version        string   `json:"version,omitempty"`
+		Languages      []string `json:"languages"`
+		Tessdata       string   `json:"tessdata,omitempty"`
+		TessdataPrefix string   `json:"tessdata_prefix,omitempty"` // TESSDATA_PREFIX of the server
+		Error          string   `json:"error,omitempty"`
+	} `json:"tesseract"`
+	Workers struct {
+		Total int `json:"total"`
+		Busy  int `json:"busy"`
+	} `json:"workers"`
+	Queue struct {
+		Length   int `json:"length"`
+		Capacity int `json:"capacity"`
+	} `json:"queue"`
+	LastTestOCR *testOCRResult `json:"last_test_ocr,omitempty"`
+	Runtime     struct {
+		GoVersion     string `json:"go_version"`
+		OS            string `json:"os"`
+		Arch          string `json:"arch"`
+		Goroutines    int    `json:"goroutines"`
+		HeapBytes     uint64 `json:"heap_bytes"`
+		UptimeSeconds int64  `json:"uptime_seconds"`
+	} `json:"runtime"`
+}
+
+func apiDiagnosticsHandler(w http.ResponseWriter, r *http.Request) {
+	var d Diagnostics
+	path, version, ok := currentEngine()
+	d.Tesseract.Available = ok
+	d.Tesseract.Path = path
+	d.Tesseract.Version = version
+	d.Tesseract.Languages = []string{}
+	d.Tesseract.TessdataPrefix = os.Getenv("TESSDATA_PREFIX")
+	if ok {
+		langs, dir, err := tesseractLanguageInfo(path)
+		if err != nil {
+			d.Tesseract.Error = err.Error()
+		} else if langs != nil {
+			d.Tesseract.Languages = langs
+		}
+		d.Tesseract.Tessdata = dir
+	}
+
+	d.Workers.Total = config.Workers
+	d.Workers.Busy = int(busyWorkers.Load())
+	d.Queue.Length = len(ocrWorkerPool)
+	d.Queue.Capacity = cap(ocrWorkerPool)
+
+	testOCRMu.Lock()
+	if lastTestOCR != nil {
+		last := *lastTestOCR
+		d.LastTestOCR = &last
+	}
+	testOCRMu.Unlock()
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	d.Runtime.GoVersion = runtime.Version()
+	d.Runtime.OS = runtime.GOOS
+	d.Runtime.Arch = runtime.GOARCH
+	d.Runtime.Goroutines = runtime.NumGoroutine()
+	d.Runtime.HeapBytes = mem.HeapAlloc
+	d.Runtime.UptimeSeconds = int64(time.Since(startTime).Seconds())
+
+	w.Header().Set("Cache-Control", "no-cache")
+	writeJSON(w, http.StatusOK, d)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunTestOCRCachesFailures(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "tesseract")
+	os.WriteFile(script, []byte("#!/bin/sh\necho run >> \""+dir+"/calls\"\necho 'Error: broken install' >&2\nexit 1\n"), 0o755)
+
+	ocrMutex.Lock()
+	oldPath, oldFound := tesseractPath, tesseractFound
+	tesseractPath, tesseractFound = script, true
+	ocrMutex.Unlock()
+	testOCRMu.Lock()
+	oldResult := lastTestOCR
+	lastTestOCR = nil
+	testOCRMu.Unlock()
+	t.Cleanup(func() {
+		ocrMutex.Lock()
+		tesseractPath, tesseractFound = oldPath, oldFound
+		ocrMutex.Unlock()
+		testOCRMu.Lock()
+		lastTestOCR = oldResult
+		testOCRMu.Unlock()
+	})
+	runs := func() int {
+		data, _ := os.ReadFile(filepath.Join(dir, "calls"))
+		return strings.Count(string(data), "run")
+	}
+
+	for i := 0; i < 3; i++ {
+		if res := runTestOCR(); res.OK || res.Error == "" {
+			t.Fatalf("probe %d: %+v, want a failure", i, res)
+		}
+	}
+	if n := runs(); n != 1 {
+		t.Errorf("Tesseract ran %d times for 3 probes, want 1", n)
+	}
+
+	// Once the failure is old enough the next probe tries again
+	testOCRMu.Lock()
+	lastTestOCR.CheckedAt = time.Now().Add(-readyRetryInterval)
+	testOCRMu.Unlock()
+	runTestOCR()
+	if n := runs(); n != 2 {
+		t.Errorf("Tesseract ran %d times after the retry interval, want 2", n)
+	}
+}
@@ -0,0 +1,576 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"image"
+	"image/jpeg"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	_ "image/gif"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+)
+
+// Name and maximum edge length of the thumbnail kept next to each document
+const (
+	thumbnailFile = "thumbnail.jpg"
+	thumbnailSize = 240
+)
+
+// Documents shown per page in the history browser
+const documentsPerPage = 24
+
+// writeThumbnail scales the image down to fit thumbnailSize and stores it as JPEG
+func writeThumbnail(path string, imageBytes []byte) error {
+	src, _, err := image.Decode(bytes.NewReader(imageBytes))
+	if err != nil {
+		return err
+	}
+
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == 0 || h == 0 {
+		return fmt.Errorf("gambar kosong")
+	}
+	if w > h {
+		w, h = thumbnailSize, max(1, h*thumbnailSize/w)
+	} else {
+		w, h = max(1, w*thumbnailSize/h), thumbnailSize
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	// White background so transparent PNGs don't turn black in JPEG
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80}); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+var documentTemplateFuncs = template.FuncMap{
+	"humanSize": func(n int64) string {
+		switch {
+		case n >= 1<<20:
+			return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+		case n >= 1<<10:
+			return fmt.Sprintf("%.0f KB", float64(n)/(1<<10))
+		default:
+			return fmt.Sprintf("%d B", n)
+		}
+	},
+	"dec": func(n int) int { return n - 1 },
+}
+
+// documentFromRequest looks up the {id} path value, writing a 404 if it is unknown
+func documentFromRequest(w http.ResponseWriter, r *http.Request) (*Document, bool) {
+	doc, ok := docStore.Get(r.PathValue("id"))
+	if !ok {
+		writeError(w, r, errDocumentNotFound)
+		return nil, false
+	}
+	return doc, true
+}
+
+func documentsHandler(w http.ResponseWriter, r *http.Request) {
+	tmpl, exists := cachedTemplate("documents")
+
+	if !exists {
+		writeError(w, r, errTemplateNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	params := r.URL.Query()
+	var docs []*Document
+	if params.Get("q") != "" || params.Get("tag") != "" || params.Get("collection") != "" || params.Get("from") != "" || params.Get("to") != "" {
+		for _, result := range docStore.Search(searchRequest(r), 0) {
+			docs = append(docs, result.Document)
+		}
+	} else {
+		docs = docStore.List()
+	}
+
+	pages := max(1, (len(docs)+documentsPerPage-1)/documentsPerPage)
+	page, err := strconv.Atoi(params.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	page = min(page, pages)
+	start := (page - 1) * documentsPerPage
+	end := min(len(docs), start+documentsPerPage)
+
+	// Keep the filters when moving between pages
+	pageURL := func(p int) string {
+		values := url.Values{}
+		for _, key := range []string{"q", "tag", "collection", "from", "to"} {
+			if v := params.Get(key); v != "" {
+				values.Set(key, v)
+			}
+		}
+		values.Set("page", strconv.Itoa(p))
+		return "/documents?" + values.Encode()
+	}
+
+	data := struct {
+		Query        string
+		Tag          string
+		Collection   string
+		From         string
+		To           string
+		Collections  []*Collection
+		Documents    []*Document
+		Total        int
+		Page         int
+		Pages        int
+		PrevURL      string
+		NextURL      string
+		ExportURL    string
+		ReprocessURL string
+		Message      string
+	}{
+		Query:       params.Get("q"),
+		Tag:         params.Get("tag"),
+		Collection:  params.Get("collection"),
+		From:        params.Get("from"),
+		To:          params.Get("to"),
+		Collections: collectionStore.List(),
+		Documents:   docs[start:end],
+		Total:       len(docs),
+		Page:        page,
+		Pages:       pages,
+		Message:     params.Get("msg"),
+	}
+	data.ExportURL = "/export?" + strings.TrimPrefix(pageURL(1), "/documents?")
+	data.ReprocessURL = "/documents/reprocess?" + strings.TrimPrefix(pageURL(1), "/documents?")
+	if page > 1 {
+		data.PrevURL = pageURL(page - 1)
+	}
+	if page < pages {
+		data.NextURL = pageURL(page + 1)
+	}
+
+	tmpl.Execute(w, data)
+}
+
+func documentHandler(w http.ResponseWriter, r *http.Request) {
+	doc, ok := documentFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	tmpl, exists := cachedTemplate("document")
+
+	if !exists {
+		writeError(w, r, errTemplateNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	// Older versions can be viewed with ?version=n, the latest is the default
+	version, ok := doc.Version(len(doc.Versions))
+	if n, err := strconv.Atoi(r.URL.Query().Get("version")); err == nil {
+		if v, found := doc.Version(n); found {
+			version, ok = v, true
+		}
+	}
+	if !ok {
+		version = ResultVersion{Text: doc.Text, Options: doc.Options}
+	}
+
+	data := struct {
+		Document        *Document
+		Version         ResultVersion
+		Collections     []*Collection
+		MetadataTypes   []string
+		PreprocessModes []string
+		Message         string
+		Error           string
+	}{
+		Document:        doc,
+		Version:         version,
+		Collections:     collectionStore.List(),
+		MetadataTypes:   []string{MetadataText, MetadataNumber, MetadataDate, MetadataBoolean},
+		PreprocessModes: []string{PreprocessGrayscale, PreprocessThreshold},
+		Message:         r.URL.Query().Get("msg"),
+		Error:           r.URL.Query().Get("error"),
+	}
+
+	tmpl.Execute(w, data)
+}
+
+func documentImageHandler(w http.ResponseWriter, r *http.Request) {
+	doc, ok := documentFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if doc.ImageFile == "" {
+		writeError(w, r, newAPIError(CodeNotFound, "File not found"))
+		return
+	}
+
+	// Stored files never change, so they can be cached for a long time
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	http.ServeFile(w, r, docStore.FilePath(doc, doc.ImageFile))
+}
+
+func documentThumbnailHandler(w http.ResponseWriter, r *http.Request) {
+	doc, ok := documentFromRequest(w, r)
+	if !ok {
+		return
+	}
+	// Thumbnails are made once at upload; a document without one is a miss
+	recordCacheLookup("thumbnail", doc.ThumbnailFile != "")
+	if doc.ThumbnailFile == "" {
+		writeError(w, r, newAPIError(CodeNotFound, "File not found"))
+		return
+	}
+
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	http.ServeFile(w, r, docStore.FilePath(doc, doc.ThumbnailFile))
+}
+
+// documentRerunHandler re-runs OCR with the options from the form and keeps
+// the result as a new version
+func documentRerunHandler(w http.ResponseWriter, r *http.Request) {
+	doc, ok := documentFromRequest(w, r)
+	if !ok {
+		return
+	}
+	detailURL := "/documents/" + url.PathEscape(doc.ID)
+
+	if !engineAvailable() {
+		http.Redirect(w, r, detailURL+"?error="+url.QueryEscape("Tesseract OCR not configured"), http.StatusSeeOther)
+		return
+	}
+
+	opts, err := optionsFromForm(r)
+	if err != nil {
+		http.Redirect(w, r, detailURL+"?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+		return
+	}
+
+	updated, err := reprocessDocument(r.Context(), doc, opts)
+	if err != nil {
+		slog.WarnContext(r.Context(), "reprocessing document failed", "document_id", doc.ID, "err", err)
+		http.Redirect(w, r, detailURL+"?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+		return
+	}
+
+	msg := fmt.Sprintf("OCR berhasil dijalankan ulang sebagai versi %d", len(updated.Versions))
+	http.Redirect(w, r, detailURL+"?msg="+url.QueryEscape(msg), http.StatusSeeOther)
+}
+
+func documentDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	doc, ok := documentFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := docStore.Delete(doc.ID); err == errDocumentNotFound {
+		// Deleted by someone else in the meantime
+		writeError(w, r, err)
+		return
+	} else if err != nil {
+		slog.WarnContext(r.Context(), "deleting document failed", "document_id", doc.ID, "err", err)
+		http.Redirect(w, r, "/documents/"+url.PathEscape(doc.ID)+"?error="+url.QueryEscape("Gagal menghapus dokumen"), http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, "/documents", http.StatusSeeOther)
+}
+
+const documentsTmpl = `
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>OCR Simple - Riwayat Dokumen</title>
+    <style>
+        * { box-sizing: border-box; }
+        body { font-family: Arial, sans-serif; padding: 15px; background: #f5f5f5; margin: 0; }
+        .container { max-width: 1100px; margin: 0 auto; background: white; padding: 20px; border-radius: 4px; box-shadow: 0 2px 4px rgba(0,0,0,0.1); }
+        .header { display: flex; justify-content: space-between; align-items: center; margin-bottom: 15px; }
+        .header h1 { margin: 0; font-size: 1.5em; color: #333; }
+        .header a { color: #007bff; text-decoration: none; margin-left: 12px; }
+        form { display: flex; flex-wrap: wrap; gap: 8px; margin-bottom: 15px; }
+        input[type="text"], input[type="date"], select { padding: 6px 8px; border: 1px solid #ccc; border-radius: 3px; font-size: 14px; }
+        input[name="q"] { flex: 1; min-width: 200px; }
+        .btn { background: #007bff; color: white; border: none; padding: 6px 16px; border-radius: 3px; cursor: pointer; font-size: 14px; text-decoration: none; }
+        .btn:hover { background: #0056b3; }
+        .export-btn { background: #28a745; }
+        .export-btn:hover { background: #218838; }
+        .summary { color: #666; font-size: 0.9em; margin-bottom: 10px; }
+        .grid { display: grid; grid-template-columns: repeat(auto-fill, minmax(200px, 1fr)); gap: 12px; }
+        .card { border: 1px solid #ddd; border-radius: 4px; overflow: hidden; text-decoration: none; color: #333; display: flex; flex-direction: column; transition: box-shadow 0.2s; }
+        .card:hover { box-shadow: 0 2px 8px rgba(0,0,0,0.15); }
+        .thumb { height: 150px; background: #f8f9fa; display: flex; align-items: center; justify-content: center; overflow: hidden; }
+        .thumb img { max-width: 100%; max-height: 100%; object-fit: contain; }
+        .thumb .placeholder { font-size: 2.5em; color: #ccc; }
+        .card-body { padding: 8px; font-size: 0.85em; }
+        .card-title { font-weight: bold; white-space: nowrap; overflow: hidden; text-overflow: ellipsis; }
+        .card-meta { color: #888; font-size: 0.9em; margin: 2px 0 4px 0; }
+        .card-text { color: #555; font-family: 'Courier New', monospace; font-size: 0.9em; height: 3.6em; overflow: hidden; }
+        .tag { background: #e9ecef; color: #495057; padding: 1px 6px; border-radius: 3px; font-size: 0.85em; margin-right: 3px; }
+        .pagination { display: flex; justify-content: center; align-items: center; gap: 12px; margin-top: 20px; color: #666; }
+        .empty { color: #666; font-style: italic; }
+        .message { background: #d4edda; border: 1px solid #c3e6cb; color: #155724; padding: 8px 12px; border-radius: 4px; margin-bottom: 12px; }
+        details.reprocess { background: #f8f9fa; border: 1px solid #ddd; border-radius: 4px; padding: 8px 12px; margin-bottom: 12px; font-size: 0.9em; }
+        details.reprocess summary { cursor: pointer; font-weight: bold; color: #333; }
+        details.reprocess form { margin-top: 8px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>📚 Riwayat Dokumen</h1>
+            <div>
+                <a href="/search">🔍 Cari</a>
+                <a href="/collections">🗂️ Koleksi</a>
+                <a href="/">← Kembali ke OCR</a>
+            </div>
+        </div>
+
+        <form method="GET" action="/documents">
+            <input type="text" name="q" value="{{.Query}}" placeholder="Filter berdasarkan isi teks">
+            <input type="text" name="tag" value="{{.Tag}}" placeholder="Tag">
+            <select name="collection">
+                <option value="">Semua koleksi</option>
+                {{range .Collections}}<option value="{{.ID}}"{{if eq .ID $.Collection}} selected{{end}}>{{.Name}}</option>{{end}}
+            </select>
+            <input type="date" name="from" value="{{.From}}" title="Dari tanggal">
+            <input type="date" name="to" value="{{.To}}" title="Sampai tanggal">
+            <button type="submit" class="btn">Filter</button>
+            {{if .Documents}}<a class="btn export-btn" href="{{.ExportURL}}" title="Unduh gambar, teks, dan sidecar JSON dari dokumen yang difilter">⬇️ Export ZIP ({{.Total}})</a>{{end}}
+        </form>
+
+        {{if .Message}}<div class="message">{{.Message}}</div>{{end}}
+
+        {{if .Documents}}
+            <details class="reprocess">
+                <summary>🔄 Proses ulang {{.Total}} dokumen yang difilter</summary>
+                <form method="POST" action="{{.ReprocessURL}}" onsubmit="return confirm('Proses ulang {{.Total}} dokumen? Setiap dokumen mendapat versi baru.')">
+                    <input type="text" name="lang" placeholder="Bahasa, mis. eng atau ind+eng">
+                    <input type="number" name="psm" min="0" max="13" placeholder="PSM">
+                    <select name="preprocess">
+                        <option value="">Tanpa preprocessing</option>
+                        <option value="grayscale">grayscale</option>
+                        <option value="threshold">threshold</option>
+                    </select>
+                    <button type="submit" class="btn">Proses ulang</button>
+                </form>
+            </details>
+            <div class="summary">{{.Total}} dokumen</div>
+            <div class="grid">
+                {{range .Documents}}
+                <a class="card" href="/documents/{{.ID}}">
+                    <div class="thumb">
+                        {{if .ThumbnailFile}}<img src="/documents/{{.ID}}/thumbnail" alt="{{.Filename}}" loading="lazy">{{else}}<span class="placeholder">🖼️</span>{{end}}
+                    </div>
+                    <div class="card-body">
+                        <div class="card-title" title="{{.Filename}}">{{.Filename}}</div>
+                        <div class="card-meta">{{.CreatedAt.Format "2006-01-02 15:04"}} · {{humanSize .Size}}{{if .Collection}} · 🗂️ {{.Collection}}{{end}}</div>
+                        <div>{{range .Tags}}<span class="tag">{{.}}</span>{{end}}</div>
+                        <div class="card-text">{{.Text}}</div>
+                    </div>
+                </a>
+                {{end}}
+            </div>
+            <div class="pagination">
+                {{if .PrevURL}}<a class="btn" href="{{.PrevURL}}">← Sebelumnya</a>{{end}}
+                <span>Halaman {{.Page}} dari {{.Pages}}</span>
+                {{if .NextURL}}<a class="btn" href="{{.NextURL}}">Berikutnya →</a>{{end}}
+            </div>
+        {{else}}
+            <p class="empty">Belum ada dokumen. <a href="/">Upload gambar</a> untuk memulai.</p>
+        {{end}}
+    </div>
+</body>
+</html>`
+
+const documentTmpl = `
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>OCR Simple - {{.Document.Filename}}</title>
+    <style>
+        * { box-sizing: border-box; }
+        body { font-family: Arial, sans-serif; padding: 15px; background: #f5f5f5; margin: 0; }
+        .container { max-width: 1100px; margin: 0 auto; background: white; padding: 20px; border-radius: 4px; box-shadow: 0 2px 4px rgba(0,0,0,0.1); }
+        .header { display: flex; justify-content: space-between; align-items: center; margin-bottom: 10px; }
+        .header h1 { margin: 0; font-size: 1.3em; color: #333; word-break: break-all; }
+        .header a { color: #007bff; text-decoration: none; }
+        .meta { color: #888; font-size: 0.85em; margin-bottom: 12px; }
+        .tag { background: #e9ecef; color: #495057; padding: 1px 6px; border-radius: 3px; font-size: 0.9em; margin-right: 3px; }
+        .message { background: #d4edda; border: 1px solid #c3e6cb; color: #155724; padding: 8px 12px; border-radius: 4px; margin-bottom: 12px; }
+        .error { background: #f8d7da; border: 1px solid #f5c6cb; color: #721c24; padding: 8px 12px; border-radius: 4px; margin-bottom: 12px; }
+        .actions { display: flex; gap: 8px; margin-bottom: 12px; }
+        .actions form { margin: 0; }
+        .btn { background: #007bff; color: white; border: none; padding: 6px 12px; border-radius: 3px; cursor: pointer; font-size: 13px; }
+        .btn:hover { background: #0056b3; }
+        .copy-btn { background: #28a745; }
+        .copy-btn:hover { background: #218838; }
+        .delete-btn { background: #dc3545; }
+        .delete-btn:hover { background: #c82333; }
+        .side-by-side { display: flex; gap: 15px; min-height: 60vh; }
+        .left-panel, .right-panel { flex: 1; display: flex; flex-direction: column; min-width: 0; }
+        .image-box { border: 1px solid #ddd; border-radius: 3px; flex-grow: 1; display: flex; align-items: flex-start; justify-content: center; overflow: auto; background: #f8f9fa; }
+        .image-box img { max-width: 100%; height: auto; }
+        .extracted-text { background: white; padding: 8px; border: 1px solid #ddd; border-radius: 3px; font-family: 'Courier New', monospace; white-space: pre-wrap; flex-grow: 1; overflow-y: auto; font-size: 13px; line-height: 1.4; }
+        h3 { margin: 0 0 8px 0; font-size: 1.1em; }
+        details.edit { background: #f8f9fa; border: 1px solid #ddd; border-radius: 4px; padding: 8px 12px; margin-bottom: 12px; }
+        details.edit summary { cursor: pointer; font-weight: bold; color: #333; }
+        .edit-row { display: flex; gap: 8px; align-items: center; margin: 8px 0; }
+        .edit-row label { width: 90px; color: #666; font-size: 0.9em; }
+        .edit-row input, .edit-row select { padding: 5px 8px; border: 1px solid #ccc; border-radius: 3px; font-size: 13px; }
+        .meta-table { width: 100%; border-collapse: collapse; font-size: 0.9em; }
+        .meta-table td { padding: 3px 4px; }
+        .meta-table input { width: 100%; }
+        .rerun input, .rerun select { padding: 5px 8px; border: 1px solid #ccc; border-radius: 3px; font-size: 13px; }
+        .versions-table { width: 100%; border-collapse: collapse; font-size: 0.85em; margin-top: 8px; }
+        .versions-table th, .versions-table td { padding: 4px 6px; border-bottom: 1px solid #eee; text-align: left; }
+        .versions-table tr.current { background: #e7f1ff; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>{{.Document.Filename}}</h1>
+            <a href="/documents">← Riwayat</a>
+        </div>
+        <div class="meta">
+            Diproses {{.Document.CreatedAt.Format "2006-01-02 15:04:05"}} UTC · {{humanSize .Document.Size}}
+            {{if not .Document.UpdatedAt.IsZero}} · diperbarui {{.Document.UpdatedAt.Format "2006-01-02 15:04:05"}} UTC{{end}}
+            {{if .Document.Collection}} · 🗂️ {{.Document.Collection}}{{end}}
+            {{range .Document.Tags}}<span class="tag">{{.}}</span>{{end}}
+            {{range $key, $value := .Document.Metadata}} · <strong>{{$key}}</strong>: {{$value.Value}}{{end}}
+        </div>
+
+        {{if .Message}}<div class="message">{{.Message}}</div>{{end}}
+        {{if .Error}}<div class="error">{{.Error}}</div>{{end}}
+
+        <div class="actions">
+            <form method="POST" action="/documents/{{.Document.ID}}/rerun" class="rerun">
+                <input type="text" name="lang" value="{{.Document.Options.Language}}" placeholder="Bahasa" size="8" title="Bahasa Tesseract, mis. eng atau ind+eng">
+                <input type="number" name="psm" value="{{if .Document.Options.PSM}}{{.Document.Options.PSM}}{{end}}" min="0" max="13" placeholder="PSM" style="width: 60px;" title="Page segmentation mode">
+                <select name="preprocess" title="Preprocessing gambar">
+                    <option value="">Tanpa preprocessing</option>
+                    {{range .PreprocessModes}}<option value="{{.}}"{{if eq . $.Document.Options.Preprocess}} selected{{end}}>{{.}}</option>{{end}}
+                </select>
+                <button type="submit" class="btn">🔄 Jalankan ulang OCR</button>
+            </form>
+            <button type="button" class="btn copy-btn" onclick="copyText(this)">Copy Text</button>
+            <form method="POST" action="/documents/{{.Document.ID}}/delete" onsubmit="return confirm('Hapus dokumen ini?')">
+                <button type="submit" class="btn delete-btn">🗑️ Hapus</button>
+            </form>
+        </div>
+
+        <details class="edit"{{if .Error}} open{{end}}>
+            <summary>🏷️ Koleksi, tag &amp; metadata</summary>
+            <form method="POST" action="/documents/{{.Document.ID}}/edit">
+                <div class="edit-row">
+                    <label>Koleksi</label>
+                    <select name="collection">
+                        <option value="">— Tanpa koleksi —</option>
+                        {{range .Collections}}<option value="{{.ID}}"{{if eq .ID $.Document.Collection}} selected{{end}}>{{.Name}}</option>{{end}}
+                    </select>
+                    <a href="/collections">Kelola koleksi</a>
+                </div>
+                <div class="edit-row">
+                    <label>Tag</label>
+                    <input type="text" name="tags" value="{{range $i, $t := .Document.Tags}}{{if $i}}, {{end}}{{$t}}{{end}}" placeholder="pisahkan dengan koma" style="flex: 1;">
+                </div>
+                <table class="meta-table" id="metaTable">
+                    <tr><td>Field</td><td>Tipe</td><td>Nilai</td></tr>
+                    {{range $key, $value := .Document.Metadata}}
+                    <tr>
+                        <td><input type="text" name="meta_key" value="{{$key}}"></td>
+                        <td><select name="meta_type">{{range $.MetadataTypes}}<option value="{{.}}"{{if eq . $value.Type}} selected{{end}}>{{.}}</option>{{end}}</select></td>
+                        <td><input type="text" name="meta_value" value="{{$value.Value}}"></td>
+                    </tr>
+                    {{end}}
+                    <tr>
+                        <td><input type="text" name="meta_key" placeholder="mis. vendor"></td>
+                        <td><select name="meta_type">{{range .MetadataTypes}}<option value="{{.}}">{{.}}</option>{{end}}</select></td>
+                        <td><input type="text" name="meta_value" placeholder="kosongkan untuk menghapus"></td>
+                    </tr>
+                </table>
+                <div class="edit-row">
+                    <button type="button" class="btn" onclick="addMetaRow()">+ Field</button>
+                    <button type="submit" class="btn copy-btn">💾 Simpan</button>
+                </div>
+            </form>
+        </details>
+
+        <details class="edit">
+            <summary>🕘 Versi hasil OCR ({{len .Document.Versions}})</summary>
+            <form method="GET" action="/documents/{{.Document.ID}}/diff">
+                <table class="versions-table">
+                    <tr><th>Dari</th><th>Ke</th><th>Versi</th><th>Tanggal</th><th>Opsi</th><th>Tesseract</th><th>Confidence</th></tr>
+                    {{$last := len .Document.Versions}}
+                    {{range .Document.Versions}}
+                    <tr{{if eq .Number $.Version.Number}} class="current"{{end}}>
+                        <td><input type="radio" name="from" value="{{.Number}}"{{if eq .Number (dec $last)}} checked{{end}}></td>
+                        <td><input type="radio" name="to" value="{{.Number}}"{{if eq .Number $last}} checked{{end}}></td>
+                        <td><a href="/documents/{{$.Document.ID}}?version={{.Number}}">v{{.Number}}</a></td>
+                        <td>{{.CreatedAt.Format "2006-01-02 15:04"}}</td>
+                        <td>{{.Options.Label}}</td>
+                        <td>{{if .EngineVersion}}{{.EngineVersion}}{{else}}-{{end}}</td>
+                        <td>{{printf "%.1f" .Confidence}}</td>
+                    </tr>
+                    {{end}}
+                </table>
+                {{if gt $last 1}}<div class="edit-row"><button type="submit" class="btn">↔️ Bandingkan</button></div>{{end}}
+            </form>
+        </details>
+
+        <div class="side-by-side">
+            <div class="left-panel">
+                <h3>Gambar:</h3>
+                <div class="image-box">
+                    {{if .Document.ImageFile}}<img src="/documents/{{.Document.ID}}/image" alt="{{.Document.Filename}}">{{else}}<p>Gambar asli tidak tersedia.</p>{{end}}
+                </div>
+            </div>
+            <div class="right-panel">
+                <h3>Hasil OCR{{if .Version.Number}} (versi {{.Version.Number}}){{end}}:</h3>
+                <div class="extracted-text" id="extractedText">{{.Version.Text}}</div>
+            </div>
+        </div>
+    </div>
+
+    <script>
+        function addMetaRow() {
+            const table = document.getElementById('metaTable');
+            const row = table.rows[table.rows.length - 1].cloneNode(true);
+            row.querySelectorAll('input').forEach(input => { input.value = ''; });
+            table.tBodies[0].appendChild(row);
+        }
+
+        function copyText(btn) {
+            navigator.clipboard.writeText(document.getElementById('extractedText').textContent).then(() => {
+                const originalText = btn.textContent;
+                btn.textContent = 'Copied!';
+                setTimeout(() => { btn.textContent = originalText; }, 1000);
+            });
+        }
+    </script>
+</body>
+</html>`
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// maxUploadBodySize limits request bodies carrying an image of up to
+// upload.max_size; base64 grows data by a third, and there is room left for
+// the other fields
+func maxUploadBodySize() int64 {
+	return int64(config.MaxUploadSize)/3*4 + 1<<20
+}
+
+// recognitionInput is an image and its options, whichever way they were sent
+type recognitionInput struct {
+	Filename string
+	Image    []byte
+	Options  OCROptions
+	Details  DocumentDetails
+	Store    bool
+	KeyID    string // API key billed for the pages, "" without authentication
+}
+
+// recognizeJSONRequest is the application/json form of a recognition request
+type recognizeJSONRequest struct {
+	Image      string          `json:"image"` // base64 or a data: URL
+	URL        string          `json:"url"`   // fetched by the server instead
+	Filename   string          `json:"filename"`
+	Language   string          `json:"language"`
+	PSM        int             `json:"psm"`
+	Preprocess string          `json:"preprocess"`
+	Collection string          `json:"collection"`
+	Tags       []string        `json:"tags"`
+	Metadata   json.RawMessage `json:"metadata"`
+	Store      *bool           `json:"store"`
+}
+
+// readRecognitionInput reads an image sent as a multipart form (the browser),
+// a raw image/* body with options in the query string, or a JSON body with
+// base64 or data URL content. Multipart and JSON requests may give a url to
+// download instead. All of them end up as the same input and share the same
+// size limit.
+func readRecognitionInput(w http.ResponseWriter, r *http.Request) (recognitionInput, *APIError) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBodySize())
+
+	var (
+		input  recognitionInput
+		apiErr *APIError
+	)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch {
+	case mediaType == "multipart/form-data":
+		input, apiErr = readMultipartInput(r)
+	case mediaType == "application/json":
+		input, apiErr = readJSONInput(w, r)
+	case strings.HasPrefix(mediaType, "image/"):
+		input, apiErr = readRawInput(r)
+	default:
+		apiErr = newAPIError(CodeUnsupportedMedia, "Unsupported content type %q, send multipart/form-data, application/json or image/*", mediaType)
+	}
+	input.KeyID = apiKeyIDFrom(r.Context())
+	return input, apiErr
+}
+
+func readMultipartInput(r *http.Request) (recognitionInput, *APIError) {
+	if err := r.ParseMultipartForm(int64(config.MultipartMemory)); err != nil {
+		return recognitionInput{}, bodyReadError(err)
+	}
+
+	var (
+		image    []byte
+		filename string
+		apiErr   *APIError
+	)
+	if file, header, err := r.FormFile("image"); err == nil {
+		defer file.Close()
+		image, apiErr = readImage(file)
+		filename = header.Filename
+	} else if imageURL := r.FormValue("url"); imageURL != "" {
+		image, filename, apiErr = fetchImage(r.Context(), imageURL)
+	} else {
+		apiErr = invalidField("image", "No file uploaded or invalid file")
+	}
+	if apiErr != nil {
+		return recognitionInput{}, apiErr
+	}
+
+	// The browser form sends "lang", API clients "language"
+	lang := r.FormValue("language")
+	if lang == "" {
+		lang = r.FormValue("lang")
+	}
+	return newRecognitionInput(filename, image, lang, r.FormValue("psm"), r.FormValue("preprocess"),
+		r.FormValue("collection"), parseTagList(r.FormValue("tags")), []byte(r.FormValue("metadata")), r.FormValue("store"))
+}
+
+// readRawInput reads an image/* body; the options come from the query string
+func readRawInput(r *http.Request) (recognitionInput, *APIError) {
+	image, apiErr := readImage(r.Body)
+	if apiErr != nil {
+		return recognitionInput{}, apiErr
+	}
+
+	q := r.URL.Query()
+	filename := q.Get("filename")
+	if filename == "" {
+		if _, params, err := mime.ParseMediaType(r.Header.Get("Content-Disposition")); err == nil {
+			filename = params["filename"]
+		}
+	}
+	lang := q.Get("language")
+	if lang == "" {
+		lang = q.Get("lang")
+	}
+	return newRecognitionInput(filename, image, lang, q.Get("psm"), q.Get("preprocess"),
+		q.Get("collection"), parseTagList(q.Get("tags")), []byte(q.Get("metadata")), q.Get("store"))
+}
+
+func readJSONInput(w http.ResponseWriter, r *http.Request) (recognitionInput, *APIError) {
+	var body recognizeJSONRequest
+	if err := decodeJSONBody(w, r, maxUploadBodySize(), &body); err != nil {
+		return recognitionInput{}, err
+	}
+	var (
+		image  []byte
+		apiErr *APIError
+	)
+	switch {
+	case body.Image != "" && body.URL != "":
+		return recognitionInput{}, invalidField("url", "Send either image or url, not both")
+	case body.Image != "":
+		image, apiErr = readImageString(body.Image)
+	case body.URL != "":
+		var filename string
+		image, filename, apiErr = fetchImage(r.Context(), body.URL)
+		if body.Filename == "" {
+			body.Filename = filename
+		}
+	default:
+		apiErr = invalidField("image", "image or url is required")
+	}
+	if apiErr != nil {
+		return recognitionInput{}, apiErr
+	}
+
+	psm := ""
+	if body.PSM != 0 {
+		psm = strconv.Itoa(body.PSM)
+	}
+	store := ""
+	if body.Store != nil {
+		store = strconv.FormatBool(*body.Store)
+	}
+	return newRecognitionInput(body.Filename, image, body.Language, psm, body.Preprocess,
+		body.Collection, body.Tags, body.Metadata, store)
+}
+
+// readImage reads an uploaded image, enforcing upload.max_size
+func readImage(r io.Reader) ([]byte, *APIError) {
+	image, err := io.ReadAll(io.LimitReader(r, int64(config.MaxUploadSize)+1))
+	if err != nil {
+		return nil, bodyReadError(err)
+	}
+	if len(image) > config.MaxUploadSize {
+		return nil, newAPIError(CodePayloadTooLarge, "Image must be at most %d bytes", config.MaxUploadSize)
+	}
+	if len(image) == 0 {
+		return nil, invalidField("image", "Image is empty")
+	}
+	return image, nil
+}
+
+// readImageString decodes the image field of a JSON request
+func readImageString(s string) ([]byte, *APIError) {
+	image, mediaType, err := decodeImageString(s)
+	if err != nil {
+		return nil, invalidField("image", "%v", err)
+	}
+	if len(image) > config.MaxUploadSize {
+		return nil, newAPIError(CodePayloadTooLarge, "Image must be at most %d bytes", config.MaxUploadSize)
+	}
+	if mediaType != "" && !strings.HasPrefix(mediaType, "image/") {
+		return nil, newAPIError(CodeUnsupportedMedia, "Data URL must contain an image, got %q", mediaType)
+	}
+	return image, nil
+}
+
+// decodeImageString decodes base64 image content, optionally wrapped in a
+// data: URL, returning the media type of the data URL if there was one
+func decodeImageString(s string) ([]byte, string, error) {
+	mediaType := ""
+	if rest, ok := strings.CutPrefix(s, "data:"); ok {
+		header, data, found := strings.Cut(rest, ",")
+		if !found || !strings.HasSuffix(header, ";base64") {
+			return nil, "", errors.New("data URL must be base64 encoded, e.g. data:image/png;base64,...")
+		}
+		mediaType = strings.TrimSuffix(header, ";base64")
+		if i := strings.IndexByte(mediaType, ';'); i >= 0 {
+			mediaType = mediaType[:i]
+		}
+		s = data
+	}
+
+	// Tolerate line breaks as produced by many base64 tools
+	s = strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\r' || r == ' ' || r == '\t' {
+			return -1
+		}
+		return r
+	}, s)
+
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if data, err := enc.DecodeString(s); err == nil {
+			return data, mediaType, nil
+		}
+	}
+	return nil, "", errors.New("image is not valid base64")
+}
+
+// imageSignatures identify the supported formats by their first bytes
+var imageSignatures = []struct {
+	magic []byte
+	ext   string
+}{
+	{[]byte("\x89PNG\r\n\x1a\n"), ".png"},
+	{[]byte("\xff\xd8\xff"), ".jpg"},
+	{[]byte("GIF87a"), ".gif"},
+	{[]byte("GIF89a"), ".gif"},
+	{[]byte("BM"), ".bmp"},
+	{[]byte("II*\x00"), ".tiff"},
+	{[]byte("MM\x00*"), ".tiff"},
+}
+
+// detectImageExt returns the file extension matching the image content,
+// or "" if it is not a supported format
+func detectImageExt(data []byte) string {
+	for _, sig := range imageSignatures {
+		if bytes.HasPrefix(data, sig.magic) {
+			return sig.ext
+		}
+	}
+	return ""
+}
+
+// newRecognitionInput validates the fields shared by every input format
+func newRecognitionInput(filename string, image []byte, lang, psm, preprocess, collection string, tags []string, metadata []byte, store string) (recognitionInput, *APIError) {
+	// A usable extension is needed for Tesseract and the stored copy; take
+	// it from the content when the name does not have one
+	filename = filepath.Base(strings.TrimSpace(filename))
+	if filename == "." || filename == string(filepath.Separator) {
+		filename = ""
+	}
+	if !isValidImageType(filename) {
+		ext := detectImageExt(image)
+		if ext == "" {
+			return recognitionInput{}, newAPIError(CodeUnsupportedMedia, "Please upload a valid image file (PNG, JPG, JPEG, GIF, BMP, TIFF)")
+		}
+		if filename == "" {
+			filename = "upload"
+		}
+		filename = strings.TrimSuffix(filename, filepath.Ext(filename)) + ext
+	}
+
+	opts, err := parseOCROptions(lang, psm, preprocess)
+	if err != nil {
+		return recognitionInput{}, asAPIError(err, "options")
+	}
+
+	meta, err := parseMetadataJSON(metadata)
+	if err != nil {
+		return recognitionInput{}, asAPIError(err, "metadata")
+	}
+	details, err := DocumentDetails{Collection: collection, Tags: tags, Metadata: meta}.normalize()
+	if err != nil {
+		return recognitionInput{}, asAPIError(err, "metadata")
+	}
+
+	input := recognitionInput{
+		Filename: filename,
+		Image:    image,
+		Options:  opts,
+		Details:  details,
+		Store:    true,
+	}
+	if store != "" {
+		if input.Store, err = strconv.ParseBool(store); err != nil {
+			return recognitionInput{}, invalidField("store", "store must be true or false")
+		}
+	}
+	return input, nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// setMaxUploadSize changes upload.max_size for the duration of a test
+func setMaxUploadSize(t *testing.T, size int) {
+	t.Helper()
+	old := config.MaxUploadSize
+	config.MaxUploadSize = size
+	t.Cleanup(func() { config.MaxUploadSize = old })
+}
+
+// pngOfSize is a PNG signature padded to size bytes
+func pngOfSize(size int) []byte {
+	return append(append([]byte{}, testPNG[:8]...), bytes.Repeat([]byte{0xab}, size-8)...)
+}
+
+func TestDecodeImageString(t *testing.T) {
+	data := []byte("\x89PNG\r\n\x1a\n\xfb\xff\xfe")
+	std := base64.StdEncoding.EncodeToString(data)
+
+	tests := []struct {
+		name      string
+		input     string
+		mediaType string
+		err       bool
+	}{
+		{"standard", std, "", false},
+		{"unpadded", base64.RawStdEncoding.EncodeToString(data), "", false},
+		{"URL-safe", base64.URLEncoding.EncodeToString(data), "", false},
+		{"URL-safe unpadded", base64.RawURLEncoding.EncodeToString(data), "", false},
+		{"line breaks", std[:4] + "\r\n" + std[4:8] + "\n " + std[8:], "", false},
+		{"data URL", "data:image/png;base64," + std, "image/png", false},
+		{"data URL with parameters", "data:image/jpeg;name=scan.jpg;base64," + std, "image/jpeg", false},
+		{"data URL of another type", "data:text/plain;base64," + std, "text/plain", false},
+		{"data URL without base64", "data:image/png," + std, "", true},
+		{"data URL without comma", "data:image/png;base64", "", true},
+		{"not base64", "not*base64!", "", true},
+		{"truncated", std[:len(std)-3], "", true},
+	}
+	for _, tt := range tests {
+		got, mediaType, err := decodeImageString(tt.input)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: error = %v", tt.name, err)
+			continue
+		}
+		if !tt.err && (!bytes.Equal(got, data) || mediaType != tt.mediaType) {
+			t.Errorf("%s: got %q, %q, want %q, %q", tt.name, got, mediaType, data, tt.mediaType)
+		}
+	}
+}
+
+func TestReadImageStringLimits(t *testing.T) {
+	setMaxUploadSize(t, 1024)
+	b64 := func(size int) string { return base64.StdEncoding.EncodeToString(pngOfSize(size)) }
+
+	tests := []struct {
+		name  string
+		input string
+		code  string
+	}{
+		{"at the limit", b64(1024), ""},
+		{"over the limit", b64(1025), CodePayloadTooLarge},
+		{"data URL over the limit", "data:image/png;base64," + b64(1025), CodePayloadTooLarge},
+		{"not an image", "data:text/html;base64," + b64(16), CodeUnsupportedMedia},
+		{"not base64", "%%%", CodeInvalidRequest},
+	}
+	for _, tt := range tests {
+		_, apiErr := readImageString(tt.input)
+		if code := errorCode(apiErr); code != tt.code {
+			t.Errorf("%s: code = %q, want %q", tt.name, code, tt.code)
+		}
+	}
+}
+
+func TestReadImageLimits(t *testing.T) {
+	setMaxUploadSize(t, 1024)
+	for size, want := range map[int]string{1024: "", 1025: CodePayloadTooLarge, 1 << 20: CodePayloadTooLarge, 0: CodeInvalidRequest} {
+		_, apiErr := readImage(bytes.NewReader(make([]byte, size)))
+		if code := errorCode(apiErr); code != want {
+			t.Errorf("%d bytes: code = %q, want %q", size, code, want)
+		}
+	}
+}
+
+// An image at the limit fits the body limit however it is sent, and one
+// byte more is refused the same way by every format
+func TestRecognitionInputSizeLimitIsShared(t *testing.T) {
+	for _, limit := range []int{1024, 5 << 20} {
+		setMaxUploadSize(t, limit)
+
+		requests := map[string]func(image []byte) *http.Request{
+			"multipart": func(image []byte) *http.Request {
+				var buf bytes.Buffer
+				mw := multipart.NewWriter(&buf)
+				fw, _ := mw.CreateFormFile("image", "scan.png")
+				fw.Write(image)
+				mw.WriteField("language", "eng")
+				mw.Close()
+				r := httptest.NewRequest(http.MethodPost, "/api/v1/recognize", &buf)
+				r.Header.Set("Content-Type", mw.FormDataContentType())
+				return r
+			},
+			"raw": func(image []byte) *http.Request {
+				r := httptest.NewRequest(http.MethodPost, "/api/v1/recognize?filename=scan.png", bytes.NewReader(image))
+				r.Header.Set("Content-Type", "image/png")
+				return r
+			},
+			"json": func(image []byte) *http.Request {
+				body := `{"filename":"scan.png","tags":["a"],"image":"` + base64.StdEncoding.EncodeToString(image) + `"}`
+				r := httptest.NewRequest(http.MethodPost, "/api/v1/recognize", strings.NewReader(body))
+				r.Header.Set("Content-Type", "application/json")
+				return r
+			},
+			"data URL": func(image []byte) *http.Request {
+				body := `{"image":"data:image/png;base64,` + base64.StdEncoding.EncodeToString(image) + `"}`
+				r := httptest.NewRequest(http.MethodPost, "/api/v1/recognize", strings.NewReader(body))
+				r.Header.Set("Content-Type", "application/json")
+				return r
+			},
+		}
+		for name, request := range requests {
+			input, apiErr := readRecognitionInput(httptest.NewRecorder(), request(pngOfSize(limit)))
+			if apiErr != nil || len(input.Image) != limit {
+				t.Errorf("%s, limit %d: image at the limit refused: %v", name, limit, apiErr)
+			}
+			_, apiErr = readRecognitionInput(httptest.NewRecorder(), request(pngOfSize(limit+1)))
+			if code := errorCode(apiErr); code != CodePayloadTooLarge {
+				t.Errorf("%s, limit %d: one byte over: code = %q, want %q", name, limit, code, CodePayloadTooLarge)
+			}
+		}
+	}
+}
+
+func TestNewRecognitionInputFilename(t *testing.T) {
+	png := pngOfSize(64)
+	tests := []struct {
+		filename string
+		image    []byte
+		want     string
+	}{
+		{"scan.png", png, "scan.png"},
+		{"Scan.JPG", png, "Scan.JPG"},
+		{"scan", png, "scan.png"},
+		{"", png, "upload.png"},
+		{"notes.txt", png, "notes.png"},
+		{"../../etc/scan.png", png, "scan.png"},
+		{"/", png, "upload.png"},
+		{"photo", []byte("\xff\xd8\xff\xe0rest"), "photo.jpg"},
+		{"page", []byte("II*\x00rest"), "page.tiff"},
+		{"page", []byte("GIF89arest"), "page.gif"},
+		{"page", []byte("%PDF-1.7"), ""},
+	}
+	for _, tt := range tests {
+		input, apiErr := newRecognitionInput(tt.filename, tt.image, "", "", "", "", nil, nil, "")
+		if tt.want == "" {
+			if errorCode(apiErr) != CodeUnsupportedMedia {
+				t.Errorf("%q: error = %v, want %s", tt.filename, apiErr, CodeUnsupportedMedia)
+			}
+			continue
+		}
+		if apiErr != nil || input.Filename != tt.want {
+			t.Errorf("%q: filename %q (%v), want %q", tt.filename, input.Filename, apiErr, tt.want)
+		}
+	}
+}
+
+func TestNewRecognitionInputOptions(t *testing.T) {
+	png := pngOfSize(64)
+	tests := []struct {
+		lang, psm, store string
+		code             string
+		wantStore        bool
+	}{
+		{"", "", "", "", true},
+		{"eng", "6", "false", "", false},
+		{"eng", "99", "", CodeInvalidRequest, false},
+		{"eng;ls", "", "", CodeInvalidRequest, false},
+		{"", "", "maybe", CodeInvalidRequest, false},
+	}
+	for _, tt := range tests {
+		input, apiErr := newRecognitionInput("scan.png", png, tt.lang, tt.psm, "", "", nil, nil, tt.store)
+		if code := errorCode(apiErr); code != tt.code {
+			t.Errorf("%q %q %q: code = %q, want %q", tt.lang, tt.psm, tt.store, code, tt.code)
+			continue
+		}
+		if apiErr == nil && input.Store != tt.wantStore {
+			t.Errorf("%q %q %q: store = %v", tt.lang, tt.psm, tt.store, input.Store)
+		}
+	}
+}
+
+func errorCode(err *APIError) string {
+	if err == nil {
+		return ""
+	}
+	return err.Code
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Job states
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+const (
+	// How long finished jobs can still be polled
+	jobRetention = time.Hour
+	// Upper bound on unfinished jobs so a client cannot queue unbounded work
+	maxPendingJobs = 100
+)
+
+// Job is an asynchronous recognition request
+type Job struct {
+	ID         string       `json:"id"`
+	Status     string       `json:"status"`
+	Filename   string       `json:"filename"`
+	CreatedAt  time.Time    `json:"created_at"`
+	StartedAt  *time.Time   `json:"started_at,omitempty"`
+	FinishedAt *time.Time   `json:"finished_at,omitempty"`
+	Result     *Recognition `json:"result,omitempty"`
+	Error      *APIError    `json:"error,omitempty"`
+	KeyID      string       `json:"-"` // API key that created the job
+}
+
+// JobStore keeps jobs in memory; they do not survive a restart
+type JobStore struct {
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+var jobStore = &JobStore{jobs: make(map[string]*Job)}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Create registers a queued job, returning false when too many jobs are pending
+func (s *JobStore) Create(filename, keyID string) (Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending := 0
+	for id, job := range s.jobs {
+		switch {
+		case job.FinishedAt != nil && time.Since(*job.FinishedAt) > jobRetention:
+			delete(s.jobs, id)
+		case job.FinishedAt == nil:
+			pending++
+		}
+	}
+	if pending >= maxPendingJobs {
+		return Job{}, false
+	}
+
+	job := &Job{
+		ID:        newJobID(),
+		Status:    JobQueued,
+		Filename:  filename,
+		CreatedAt: time.Now().UTC(),
+		KeyID:     keyID,
+	}
+	s.jobs[job.ID] = job
+	return *job, true
+}
+
+// Get returns a copy of the job
+func (s *JobStore) Get(id string) (Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// start marks a job running once a worker picks it up; a worker that only
+// gets to it after the job timed out leaves it finished
+func (s *JobStore) start(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if job, ok := s.jobs[id]; ok && job.FinishedAt == nil {
+		now := time.Now().UTC()
+		job.Status = JobRunning
+		job.StartedAt = &now
+	}
+}
+
+func (s *JobStore) finish(id string, result *Recognition, apiErr *APIError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if job, ok := s.jobs[id]; ok {
+		now := time.Now().UTC()
+		job.FinishedAt = &now
+		job.Result = result
+		job.Error = apiErr
+		job.Status = JobSucceeded
+		if apiErr != nil {
+			job.Status = JobFailed
+		}
+	}
+}
+
+// Run processes the job in the background. The job stays queued until a
+// worker picks it up; ctx only carries the trace of the request that created
+// the job
+func (s *JobStore) Run(ctx context.Context, id string, input recognitionInput) {
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		ctx, span := tracer.Start(ctx, "ocr.job", trace.WithAttributes(attribute.String("job.id", id)))
+		defer span.End()
+
+		ctx = withOCRStarted(ctx, func() { s.start(id) })
+		result, apiErr := recognize(ctx, input, runOCRWithRetry)
+		s.finish(id, result, apiErr)
+	}()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// waitForJob polls the job until cond holds
+func waitForJob(t *testing.T, id string, cond func(Job) bool) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, _ := jobStore.Get(id)
+		if cond(job) {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s stuck at %+v", id, job)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// A job only counts as running once a worker picks it up
+func TestJobStaysQueuedUntilWorkerPicksItUp(t *testing.T) {
+	tesseract := fakeTesseract(t)
+	ocrMutex.Lock()
+	oldPath, oldFound, oldVersion := tesseractPath, tesseractFound, tesseractVersion
+	tesseractPath, tesseractFound, tesseractVersion = tesseract, true, "5.3.0"
+	ocrMutex.Unlock()
+
+	// A queue without workers yet, so the job has to wait
+	oldPool := ocrWorkerPool
+	ocrWorkerPool = make(chan OCRRequest, 1)
+	t.Cleanup(func() {
+		close(ocrWorkerPool)
+		ocrWorkerPool = oldPool
+		ocrMutex.Lock()
+		tesseractPath, tesseractFound, tesseractVersion = oldPath, oldFound, oldVersion
+		ocrMutex.Unlock()
+	})
+
+	job, ok := jobStore.Create("antre.png", "")
+	if !ok {
+		t.Fatal("job not created")
+	}
+	image := append(append([]byte{}, testPNG[:8]...), "\nantre\n"...)
+	jobStore.Run(context.Background(), job.ID, recognitionInput{Filename: "antre.png", Image: image})
+
+	for len(ocrWorkerPool) == 0 {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if job, _ := jobStore.Get(job.ID); job.Status != JobQueued || job.StartedAt != nil {
+		t.Fatalf("waiting job = %s, started %v; want queued", job.Status, job.StartedAt)
+	}
+
+	go ocrWorker(ocrWorkerPool)
+	done := waitForJob(t, job.ID, func(job Job) bool { return job.FinishedAt != nil })
+	if done.Status != JobSucceeded || done.StartedAt == nil || done.Result.Text != "antre" {
+		t.Errorf("finished job = %+v", done)
+	}
+	if done.StartedAt.Before(done.CreatedAt) || done.FinishedAt.Before(*done.StartedAt) {
+		t.Errorf("created %v, started %v, finished %v", done.CreatedAt, done.StartedAt, done.FinishedAt)
+	}
+	if got := recognised(t, tesseract); len(got) != 1 {
+		t.Errorf("recognised %v", got)
+	}
+}
+
+// A worker that reaches a job after it gave up does not reopen it
+func TestJobStartAfterFinish(t *testing.T) {
+	job, _ := jobStore.Create("telat.png", "")
+	jobStore.finish(job.ID, nil, ocrError(errOCRTimeout))
+	jobStore.start(job.ID)
+	if got, _ := jobStore.Get(job.ID); got.Status != JobFailed || got.StartedAt != nil {
+		t.Errorf("job = %s, started %v; want failed", got.Status, got.StartedAt)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// How long a fetched key set is used before it is fetched again
+	jwksRefreshInterval = time.Hour
+	// A token with an unknown kid triggers a refetch at most this often
+	jwksMinRefetch = time.Minute
+)
+
+// jsonWebKey is the wire form of a key in a JWKS document
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// verificationKey is a parsed public key of a key set
+type verificationKey struct {
+	ID  string
+	Alg string // "" when the JWK does not restrict the algorithm
+	Key crypto.PublicKey
+}
+
+// parseJWKS parses a JWKS document, skipping keys that are not for
+// signatures or of an unsupported type
+func parseJWKS(data []byte) ([]verificationKey, error) {
+	var doc struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %v", err)
+	}
+
+	var keys []verificationKey
+	for _, jwk := range doc.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		pub, err := jwk.publicKey()
+		if err != nil {
+			slog.Warn("ignoring JWKS key", "kid", jwk.Kid, "err", err)
+			continue
+		}
+		keys = append(keys, verificationKey{ID: jwk.Kid, Alg: jwk.Alg, Key: pub})
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS contains no usable signing keys")
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	b64 := base64.RawURLEncoding.DecodeString
+
+	switch k.Kty {
+	case "RSA":
+		n, err := b64(k.N)
+		if err != nil || len(n) == 0 {
+			return nil, errors.New("invalid RSA modulus")
+		}
+		e, err := b64(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if pub.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA key of %d bits is too small", pub.N.BitLen())
+		}
+		return pub, nil
+
+	case "EC":
+		var (
+			curve elliptic.Curve
+			check ecdh.Curve
+		)
+		switch k.Crv {
+		case "P-256":
+			curve, check = elliptic.P256(), ecdh.P256()
+		case "P-384":
+			curve, check = elliptic.P384(), ecdh.P384()
+		case "P-521":
+			curve, check = elliptic.P521(), ecdh.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, errX := b64(k.X)
+		y, errY := b64(k.Y)
+		size := (curve.Params().BitSize + 7) / 8
+		if errX != nil || errY != nil || len(x) != size || len(y) != size {
+			return nil, errors.New("invalid EC coordinates")
+		}
+		// crypto/ecdh rejects points that are not on the curve
+		point := append(append([]byte{4}, x...), y...)
+		if _, err := check.NewPublicKey(point); err != nil {
+			return nil, errors.New("EC point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+
+	case "OKP":
+		x, err := b64(k.X)
+		if k.Crv != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("only Ed25519 OKP keys are supported")
+		}
+		return ed25519.PublicKey(x), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// jwksSource loads a key set from a URL or a local file and keeps it
+// current: URLs are refetched hourly and when a token names an unknown
+// key, files when they change
+type jwksSource struct {
+	url  string
+	file string
+
+	mu          sync.Mutex
+	keys        []verificationKey
+	loadedAt    time.Time
+	lastAttempt time.Time
+	modTime     time.Time
+}
+
+var jwksClient = &http.Client{Timeout: 10 * time.Second}
+
+// Key returns the key for a token header
+func (s *jwksSource) Key(kid, alg string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.refreshLocked(false); err != nil && len(s.keys) == 0 {
+		return nil, err
+	}
+	if key, ok := s.findLocked(kid, alg); ok {
+		return key, nil
+	}
+	// The identity provider may have rotated its keys
+	if s.url != "" && time.Since(s.lastAttempt) > jwksMinRefetch {
+		if err := s.refreshLocked(true); err != nil {
+			return nil, err
+		}
+		if key, ok := s.findLocked(kid, alg); ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("no key %q in the key set", kid)
+}
+
+func (s *jwksSource) findLocked(kid, alg string) (crypto.PublicKey, bool) {
+	for _, k := range s.keys {
+		if (k.ID == kid || (kid == "" && len(s.keys) == 1)) && (k.Alg == "" || k.Alg == alg) {
+			return k.Key, true
+		}
+	}
+	return nil, false
+}
+
+// refreshLocked reloads the key set when it is stale, or always with force
+func (s *jwksSource) refreshLocked(force bool) error {
+	var (
+		data []byte
+		err  error
+	)
+	if s.file != "" {
+		info, err := os.Stat(s.file)
+		if err != nil {
+			return err
+		}
+		if !force && len(s.keys) > 0 && info.ModTime().Equal(s.modTime) {
+			return nil
+		}
+		if data, err = os.ReadFile(s.file); err != nil {
+			return err
+		}
+		s.modTime = info.ModTime()
+	} else {
+		if !force && len(s.keys) > 0 && time.Since(s.loadedAt) < jwksRefreshInterval {
+			return nil
+		}
+		if !force && time.Since(s.lastAttempt) < jwksMinRefetch {
+			return errors.New("key set unavailable")
+		}
+		s.lastAttempt = time.Now()
+		if data, err = fetchJSON(s.url); err != nil {
+			slog.Warn("fetching JWKS failed", "url", s.url, "err", err)
+			return fmt.Errorf("key set unavailable")
+		}
+	}
+
+	keys, err := parseJWKS(data)
+	if err != nil {
+		slog.Warn("invalid JWKS", "err", err)
+		return err
+	}
+	s.keys, s.loadedAt = keys, time.Now()
+	return nil
+}
+
+// fetchJSON downloads a small JSON document such as a JWKS or OIDC
+// discovery document
+func fetchJSON(url string) ([]byte, error) {
+	resp, err := jwksClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s answered %s", url, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// discoverJWKSURL reads the jwks_uri from the OIDC discovery document of issuer
+func discoverJWKSURL(issuer string) (string, error) {
+	data, err := fetchJSON(strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return "", err
+	}
+	var doc struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil || doc.JWKSURI == "" {
+		return "", fmt.Errorf("no jwks_uri in the discovery document of %s", issuer)
+	}
+	return doc.JWKSURI, nil
+}
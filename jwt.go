@@ -0,0 +1,475 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	_ "crypto/sha512" // SHA-384 and SHA-512 for crypto.Hash
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Allowed difference between our clock and the identity provider's
+const jwtLeeway = time.Minute
+
+// jwtAlgorithms are the accepted asymmetric JWS algorithms; "none" and the
+// HMAC algorithms are rejected since the key set is public
+var jwtAlgorithms = map[string]bool{
+	"RS256": true, "RS384": true, "RS512": true,
+	"PS256": true, "PS384": true, "PS512": true,
+	"ES256": true, "ES384": true, "ES512": true,
+	"EdDSA": true,
+}
+
+// JWTVerifier validates bearer tokens issued by an identity provider and
+// maps a claim of the token to scopes. It is configured with:
+//
+//	OCR_JWT_ISSUER       accepted "iss" values, comma separated (enables JWT)
+//	OCR_JWT_AUDIENCE     required "aud" value, optional
+//	OCR_JWKS_URL         key set URL; default from OIDC discovery of the first issuer
+//	OCR_JWKS_FILE        local key set instead of a URL
+//	OCR_JWT_ROLES_CLAIM  claim holding the roles, e.g. "groups" or
+//	                     "realm_access.roles"; default "roles"
+//	OCR_JWT_ROLE_MAP     role to scopes, e.g. "ocr-users=ocr,read;ocr-admins=admin";
+//	                     roles named like a scope grant that scope
+type JWTVerifier struct {
+	issuers    []string
+	audience   string
+	rolesClaim string
+	roleMap    map[string][]string
+	keys       *jwksSource
+}
+
+var jwtVerifier *JWTVerifier
+
+// newJWTVerifier returns nil when jwt.issuer is not set
+func newJWTVerifier(c *Config) (*JWTVerifier, error) {
+	issuers := splitList(c.JWTIssuer, ",")
+	if len(issuers) == 0 {
+		return nil, nil
+	}
+
+	v := &JWTVerifier{
+		issuers:    issuers,
+		audience:   c.JWTAudience,
+		rolesClaim: c.JWTRolesClaim,
+		roleMap:    map[string][]string{},
+		keys:       &jwksSource{url: c.JWKSURL, file: c.JWKSFile},
+	}
+	if v.rolesClaim == "" {
+		v.rolesClaim = "roles"
+	}
+
+	for _, entry := range splitList(c.JWTRoleMap, ";") {
+		role, scopes, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("OCR_JWT_ROLE_MAP: expected role=scope,..., got %q", entry)
+		}
+		normalized, err := normalizeScopes(strings.Split(scopes, ","))
+		if err != nil {
+			return nil, fmt.Errorf("OCR_JWT_ROLE_MAP: %v", err)
+		}
+		v.roleMap[strings.TrimSpace(role)] = normalized
+	}
+
+	switch {
+	case v.keys.url != "" && v.keys.file != "":
+		return nil, errors.New("set either OCR_JWKS_URL or OCR_JWKS_FILE, not both")
+	case v.keys.file != "":
+		// A broken local file is a configuration error, fail at start
+		if err := v.keys.refreshLocked(true); err != nil {
+			return nil, fmt.Errorf("OCR_JWKS_FILE: %v", err)
+		}
+	case v.keys.url == "":
+		url, err := discoverJWKSURL(issuers[0])
+		if err != nil {
+			return nil, fmt.Errorf("OIDC discovery: %v (set OCR_JWKS_URL or OCR_JWKS_FILE)", err)
+		}
+		v.keys.url = url
+	}
+	return v, nil
+}
+
+func splitList(s, sep string) []string {
+	var out []string
+	for _, item := range strings.Split(s, sep) {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// looksLikeJWT tells tokens apart from API keys
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2 && !strings.HasPrefix(token, "ocr_")
+}
+
+// Verify checks the signature and standard claims of token and returns the
+// caller as an APIKey without quotas, so the rest of the server treats it
+// like any other authenticated request
+func (v *JWTVerifier) Verify(token string) (*APIKey, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, errors.New("malformed token header")
+	}
+	if !jwtAlgorithms[header.Alg] {
+		return nil, fmt.Errorf("unsupported algorithm %q", header.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed token signature")
+	}
+
+	key, err := v.keys.Key(header.Kid, header.Alg)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyJWTSignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	dec := json.NewDecoder(base64.NewDecoder(base64.RawURLEncoding, strings.NewReader(parts[1])))
+	dec.UseNumber()
+	if err := dec.Decode(&claims); err != nil {
+		return nil, errors.New("malformed token claims")
+	}
+	if err := v.checkClaims(claims, time.Now()); err != nil {
+		return nil, err
+	}
+
+	sub, _ := claims["sub"].(string)
+	name := sub
+	for _, c := range []string{"email", "preferred_username", "name"} {
+		if s, ok := claims[c].(string); ok && s != "" {
+			name = s
+			break
+		}
+	}
+
+	var scopes []string
+	seen := map[string]bool{}
+	for _, role := range claimStrings(claims, v.rolesClaim) {
+		mapped, ok := v.roleMap[role]
+		if !ok {
+			mapped = []string{role}
+		}
+		for _, scope := range mapped {
+			for _, valid := range validScopes {
+				if scope == valid && !seen[scope] {
+					seen[scope] = true
+					scopes = append(scopes, scope)
+				}
+			}
+		}
+	}
+
+	exp, _ := numericClaim(claims, "exp")
+	return &APIKey{ID: "jwt:" + sub, Name: name, Scopes: scopes, expiresAt: exp}, nil
+}
+
+func (v *JWTVerifier) checkClaims(claims map[string]interface{}, now time.Time) error {
+	iss, _ := claims["iss"].(string)
+	issuerOK := false
+	for _, allowed := range v.issuers {
+		issuerOK = issuerOK || iss == allowed
+	}
+	if !issuerOK {
+		return fmt.Errorf("issuer %q is not accepted", iss)
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return errors.New("token has no subject")
+	}
+
+	exp, ok := numericClaim(claims, "exp")
+	if !ok {
+		return errors.New("token has no expiry")
+	}
+	if now.After(exp.Add(jwtLeeway)) {
+		return errors.New("token expired")
+	}
+	if nbf, ok := numericClaim(claims, "nbf"); ok && now.Add(jwtLeeway).Before(nbf) {
+		return errors.New("token not valid yet")
+	}
+
+	if v.audience != "" {
+		audOK := false
+		for _, aud := range claimStrings(claims, "aud") {
+			audOK = audOK || aud == v.audience
+		}
+		if !audOK {
+			return fmt.Errorf("token is not for audience %q", v.audience)
+		}
+	}
+	return nil
+}
+
+func numericClaim(claims map[string]interface{}, name string) (time.Time, bool) {
+	n, ok := claims[name].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(f), 0), true
+}
+
+// claimStrings reads a claim that is a list of strings or a space or comma
+// separated string, following dots into nested objects
+func claimStrings(claims map[string]interface{}, path string) []string {
+	var value interface{} = claims
+	for _, part := range strings.Split(path, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = obj[part]
+	}
+
+	switch v := value.(type) {
+	case string:
+		return strings.FieldsFunc(v, func(r rune) bool { return r == ' ' || r == ',' })
+	case []interface{}:
+		var out []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// verifyJWTSignature checks sig with one of jwtAlgorithms
+func verifyJWTSignature(alg string, key crypto.PublicKey, signed, sig []byte) error {
+	hashFor := map[string]crypto.Hash{"256": crypto.SHA256, "384": crypto.SHA384, "512": crypto.SHA512}
+	errSig := errors.New("invalid token signature")
+
+	if alg == "EdDSA" {
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok || !ed25519.Verify(pub, signed, sig) {
+			return errSig
+		}
+		return nil
+	}
+
+	if len(alg) != 5 {
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	hash, ok := hashFor[alg[2:]]
+	if !ok {
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch alg[:2] {
+	case "RS", "PS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errSig
+		}
+		var err error
+		if alg[:2] == "RS" {
+			err = rsa.VerifyPKCS1v15(pub, hash, digest, sig)
+		} else {
+			err = rsa.VerifyPSS(pub, hash, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+		if err != nil {
+			return errSig
+		}
+		return nil
+	case "ES":
+		// ES512 uses P-521, not a 512-bit curve
+		curveFor := map[string]elliptic.Curve{"256": elliptic.P256(), "384": elliptic.P384(), "512": elliptic.P521()}
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || pub.Curve != curveFor[alg[2:]] {
+			return errSig
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return errSig
+		}
+		r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errSig
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported algorithm %q", alg)
+}
+
+// runJWTCommand implements `ocr-simple jwt keygen|sign`, which create a
+// local key set and tokens to try JWT authentication without an identity
+// provider
+func runJWTCommand(args []string) int {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, `Usage:
+  ocr-simple jwt keygen [-dir DIR]
+  ocr-simple jwt sign -key DIR/jwt-private.pem -iss ISSUER -sub SUBJECT [-aud AUD] [-roles ocr,read] [-ttl 1h]`)
+	}
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+
+	switch args[0] {
+	case "keygen":
+		fs := flag.NewFlagSet("jwt keygen", flag.ContinueOnError)
+		dir := fs.String("dir", ".", "directory for jwks.json and jwt-private.pem")
+		if err := fs.Parse(args[1:]); err != nil {
+			return 2
+		}
+		if err := writeLocalKeySet(*dir); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("✅ Kunci dibuat: %s (publik, untuk OCR_JWKS_FILE) dan %s (privat)\n",
+			filepath.Join(*dir, "jwks.json"), filepath.Join(*dir, "jwt-private.pem"))
+
+	case "sign":
+		fs := flag.NewFlagSet("jwt sign", flag.ContinueOnError)
+		keyFile := fs.String("key", "jwt-private.pem", "private key written by keygen")
+		iss := fs.String("iss", "", "issuer")
+		sub := fs.String("sub", "", "subject")
+		aud := fs.String("aud", "", "audience")
+		roles := fs.String("roles", ScopeOCR, "comma separated roles")
+		ttl := fs.Duration("ttl", time.Hour, "validity")
+		if err := fs.Parse(args[1:]); err != nil {
+			return 2
+		}
+		if *iss == "" || *sub == "" {
+			usage()
+			return 2
+		}
+		claims := map[string]interface{}{
+			"iss":   *iss,
+			"sub":   *sub,
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(*ttl).Unix(),
+			"roles": splitList(*roles, ","),
+		}
+		if *aud != "" {
+			claims["aud"] = *aud
+		}
+		token, err := signLocalJWT(*keyFile, claims)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Error: %v\n", err)
+			return 1
+		}
+		fmt.Println(token)
+
+	default:
+		usage()
+		return 2
+	}
+	return 0
+}
+
+// localKeyID identifies the key written by keygen
+func localKeyID(pub *ecdsa.PublicKey) string {
+	der, _ := x509.MarshalPKIXPublicKey(pub)
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:8])
+}
+
+func writeLocalKeySet(dir string) error {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return err
+	}
+
+	pad := func(b []byte) string {
+		return base64.RawURLEncoding.EncodeToString(append(make([]byte, 32-len(b)), b...))
+	}
+	jwks, _ := json.MarshalIndent(map[string][]jsonWebKey{"keys": {{
+		Kty: "EC",
+		Kid: localKeyID(&priv.PublicKey),
+		Use: "sig",
+		Alg: "ES256",
+		Crv: "P-256",
+		X:   pad(priv.PublicKey.X.Bytes()),
+		Y:   pad(priv.PublicKey.Y.Bytes()),
+	}}}, "", "  ")
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "jwt-private.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "jwks.json"), jwks, 0o644)
+}
+
+func signLocalJWT(keyFile string, claims map[string]interface{}) (string, error) {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return "", err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return "", errors.New("no PEM key in " + keyFile)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", err
+	}
+	priv, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok || priv.Curve != elliptic.P256() {
+		return "", errors.New("expected a P-256 key written by `jwt keygen`")
+	}
+
+	enc := func(v interface{}) string {
+		b, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signed := enc(map[string]string{"alg": "ES256", "typ": "JWT", "kid": localKeyID(&priv.PublicKey)}) + "." + enc(claims)
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, priv, digest[:])
+	if err != nil {
+		return "", err
+	}
+	var sig bytes.Buffer
+	sig.Write(append(make([]byte, 32-len(r.Bytes())), r.Bytes()...))
+	sig.Write(append(make([]byte, 32-len(s.Bytes())), s.Bytes()...))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig.Bytes()), nil
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSigner signs tokens with a key generated for the test
+type testSigner struct {
+	kid string
+	alg string
+	key crypto.Signer
+}
+
+func newTestSigners(t *testing.T) (rs, es testSigner) {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testSigner{kid: "rsa-1", alg: "RS256", key: rsaKey}, testSigner{kid: "ec-1", alg: "ES256", key: ecKey}
+}
+
+func (s testSigner) jwk() jsonWebKey {
+	b64 := base64.RawURLEncoding.EncodeToString
+	switch pub := s.key.Public().(type) {
+	case *rsa.PublicKey:
+		return jsonWebKey{Kty: "RSA", Kid: s.kid, Use: "sig", Alg: s.alg, N: b64(pub.N.Bytes()), E: b64(big.NewInt(int64(pub.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		return jsonWebKey{Kty: "EC", Kid: s.kid, Use: "sig", Alg: s.alg, Crv: "P-256", X: b64(pub.X.FillBytes(make([]byte, 32))), Y: b64(pub.Y.FillBytes(make([]byte, 32)))}
+	}
+	panic("unexpected key type")
+}
+
+func jwtSegment(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (s testSigner) sign(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+	signed := jwtSegment(map[string]string{"alg": s.alg, "typ": "JWT", "kid": s.kid}) + "." + jwtSegment(claims)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch key := s.key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// newTestVerifier serves the signers' keys from an identity provider that
+// supports OIDC discovery and returns a verifier for it
+func newTestVerifier(t *testing.T, c Config, signers ...testSigner) (*JWTVerifier, string) {
+	t.Helper()
+	var keys []jsonWebKey
+	for _, s := range signers {
+		keys = append(keys, s.jwk())
+	}
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"issuer": srv.URL, "jwks_uri": srv.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string][]jsonWebKey{"keys": keys})
+	})
+
+	c.JWTIssuer = srv.URL
+	v, err := newJWTVerifier(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v, srv.URL
+}
+
+func validClaims(issuer string) map[string]interface{} {
+	return map[string]interface{}{
+		"iss":   issuer,
+		"sub":   "user-1",
+		"aud":   "ocr-api",
+		"email": "budi@example.com",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"roles": []string{ScopeOCR},
+	}
+}
+
+func TestJWTVerifyValidToken(t *testing.T) {
+	rs, es := newTestSigners(t)
+	v, issuer := newTestVerifier(t, Config{JWTAudience: "ocr-api"}, rs, es)
+
+	for _, s := range []testSigner{rs, es} {
+		key, err := v.Verify(s.sign(t, validClaims(issuer)))
+		if err != nil {
+			t.Errorf("%s: %v", s.alg, err)
+			continue
+		}
+		if key.ID != "jwt:user-1" || key.Name != "budi@example.com" || !reflect.DeepEqual(key.Scopes, []string{ScopeOCR}) {
+			t.Errorf("%s: key = %+v", s.alg, key)
+		}
+	}
+}
+
+func TestJWTVerifyRejectsForgedTokens(t *testing.T) {
+	rs, es := newTestSigners(t)
+	v, issuer := newTestVerifier(t, Config{}, rs, es)
+	claims := validClaims(issuer)
+
+	// The same kid, signed by a key the provider never published
+	impostor, _ := newTestSigners(t)
+	impostor.kid = rs.kid
+
+	// Claims swapped after signing
+	signed := strings.Split(es.sign(t, claims), ".")
+	admin := validClaims(issuer)
+	admin["roles"] = []string{ScopeAdmin}
+	tampered := signed[0] + "." + jwtSegment(admin) + "." + signed[2]
+
+	unknown := es
+	unknown.kid = "ec-2"
+
+	// An RS256 header on a key published for ES256
+	mismatched := rs
+	mismatched.kid = es.kid
+
+	header := func(alg string) string {
+		return jwtSegment(map[string]string{"alg": alg, "typ": "JWT", "kid": rs.kid})
+	}
+	body := jwtSegment(claims)
+	none := header("none") + "." + body + "."
+	// HS256 keyed with the public RSA modulus, the classic confusion attack
+	mac := hmac.New(sha256.New, []byte(rs.jwk().N))
+	mac.Write([]byte(header("HS256") + "." + body))
+	hs256 := header("HS256") + "." + body + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	tests := map[string]string{
+		"bad signature":       impostor.sign(t, claims),
+		"tampered claims":     tampered,
+		"unknown kid":         unknown.sign(t, claims),
+		"algorithm mismatch":  mismatched.sign(t, claims),
+		"alg none":            none,
+		"HS256":               hs256,
+		"two segments":        header("RS256") + "." + body,
+		"signature not b64":   header("RS256") + "." + body + ".!!",
+		"header not json":     "bm90IGpzb24." + body + ".c2ln",
+		"empty token":         "",
+		"api key lookalike":   "ocr_a.b.c",
+		"truncated signature": rs.sign(t, claims)[:100],
+	}
+	for name, token := range tests {
+		if key, err := v.Verify(token); err == nil {
+			t.Errorf("%s: accepted as %+v", name, key)
+		}
+	}
+}
+
+func TestJWTVerifyClaims(t *testing.T) {
+	rs, _ := newTestSigners(t)
+	v, issuer := newTestVerifier(t, Config{JWTAudience: "ocr-api"}, rs)
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		modify func(claims map[string]interface{})
+		ok     bool
+	}{
+		{"valid", func(map[string]interface{}) {}, true},
+		{"wrong issuer", func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" }, false},
+		{"no issuer", func(c map[string]interface{}) { delete(c, "iss") }, false},
+		{"wrong audience", func(c map[string]interface{}) { c["aud"] = "other-api" }, false},
+		{"no audience", func(c map[string]interface{}) { delete(c, "aud") }, false},
+		{"audience list", func(c map[string]interface{}) { c["aud"] = []string{"other-api", "ocr-api"} }, true},
+		{"no subject", func(c map[string]interface{}) { delete(c, "sub") }, false},
+		{"no expiry", func(c map[string]interface{}) { delete(c, "exp") }, false},
+		{"expired within leeway", func(c map[string]interface{}) { c["exp"] = now.Add(-jwtLeeway / 2).Unix() }, true},
+		{"expired", func(c map[string]interface{}) { c["exp"] = now.Add(-2 * jwtLeeway).Unix() }, false},
+		{"not before within leeway", func(c map[string]interface{}) { c["nbf"] = now.Add(jwtLeeway / 2).Unix() }, true},
+		{"not valid yet", func(c map[string]interface{}) { c["nbf"] = now.Add(2 * jwtLeeway).Unix() }, false},
+	}
+	for _, tt := range tests {
+		claims := validClaims(issuer)
+		tt.modify(claims)
+		_, err := v.Verify(rs.sign(t, claims))
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: error = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestJWTRoleMapping(t *testing.T) {
+	rs, _ := newTestSigners(t)
+	v, issuer := newTestVerifier(t, Config{
+		JWTRolesClaim: "realm_access.roles",
+		JWTRoleMap:    "ocr-users=ocr,read; ocr-admins=admin",
+	}, rs)
+
+	tests := []struct {
+		roles interface{}
+		want  []string
+	}{
+		{[]string{"ocr-users"}, []string{ScopeOCR, ScopeRead}},
+		{[]string{"ocr-admins"}, []string{ScopeAdmin}},
+		// Roles named like a scope grant it, unknown roles are dropped
+		{[]string{"ocr-users", "write", "billing", "ocr"}, []string{ScopeOCR, ScopeRead, ScopeWrite}},
+		{"ocr-admins read", []string{ScopeAdmin, ScopeRead}},
+		{[]string{"billing"}, nil},
+		{nil, nil},
+	}
+	for _, tt := range tests {
+		claims := validClaims(issuer)
+		delete(claims, "roles")
+		claims["realm_access"] = map[string]interface{}{"roles": tt.roles}
+		key, err := v.Verify(rs.sign(t, claims))
+		if err != nil {
+			t.Errorf("roles %v: %v", tt.roles, err)
+			continue
+		}
+		if !reflect.DeepEqual(key.Scopes, tt.want) {
+			t.Errorf("roles %v: scopes = %v, want %v", tt.roles, key.Scopes, tt.want)
+		}
+	}
+}
+
+func TestNewJWTVerifierConfig(t *testing.T) {
+	if v, err := newJWTVerifier(&Config{}); v != nil || err != nil {
+		t.Errorf("without an issuer: %v, %v", v, err)
+	}
+	bad := []Config{
+		{JWTIssuer: "https://id.example.com", JWKSURL: "https://id.example.com/keys", JWKSFile: "jwks.json"},
+		{JWTIssuer: "https://id.example.com", JWKSURL: "https://id.example.com/keys", JWTRoleMap: "ocr-users"},
+		{JWTIssuer: "https://id.example.com", JWKSURL: "https://id.example.com/keys", JWTRoleMap: "ocr-users=superuser"},
+		{JWTIssuer: "https://id.example.com", JWKSFile: "does-not-exist.json"},
+	}
+	for _, c := range bad {
+		if _, err := newJWTVerifier(&c); err == nil {
+			t.Errorf("%+v: no error", c)
+		}
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	rs, es := newTestSigners(t)
+	enc := rs.jwk()
+	enc.Kid, enc.Use = "rsa-enc", "enc"
+	offCurve := es.jwk()
+	offCurve.Kid, offCurve.Y = "ec-bad", offCurve.X
+	small := rs.jwk()
+	small.Kid, small.N = "rsa-small", base64.RawURLEncoding.EncodeToString(big.NewInt(1<<40+1).Bytes())
+
+	data, _ := json.Marshal(map[string][]jsonWebKey{"keys": {rs.jwk(), es.jwk(), enc, offCurve, small, {Kty: "oct", Kid: "hmac"}}})
+	keys, err := parseJWKS(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, k := range keys {
+		ids = append(ids, k.ID)
+	}
+	if want := []string{"rsa-1", "ec-1"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("usable keys = %v, want %v", ids, want)
+	}
+
+	for _, doc := range []string{`not json`, `{"keys":[]}`, `{"keys":[{"kty":"oct"}]}`} {
+		if _, err := parseJWKS([]byte(doc)); err == nil {
+			t.Errorf("parseJWKS(%s): no error", doc)
+		}
+	}
+}
@@ -1,17 +1,16 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"html/template"
-	"io"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strconv"
@@ -19,7 +18,9 @@ import (
 	"sync"
 	"time"
 
-	"github.com/tiagomelo/go-ocr/ocr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type PageData struct {
@@ -31,41 +32,50 @@ type PageData struct {
 type OCRRequest struct {
 	ImageBytes []byte
 	Filename   string
+	Options    OCROptions
 	ResponseCh chan OCRResponse
+	Enqueued   time.Time
+	Ctx        context.Context // carries the trace of the caller
+	// Started, when set, is called once a worker picks the request up
+	Started func()
 }
 
 type OCRResponse struct {
-	Text string
-	Err  error
+	Text       string
+	Words      []OCRWord
+	Confidence float64
+	Options    OCROptions
+	// Tesseract version that produced the result, e.g. "5.3.0"
+	EngineVersion string
+	Err           error
 }
 
 var (
-	ocrClient      ocr.Ocr
-	ocrMutex       sync.RWMutex
-	bufferPool     sync.Pool
-	templateCache  map[string]*template.Template
-	templateMutex  sync.RWMutex
-	ocrWorkerPool  chan OCRRequest
-	tesseractPath  string
-	tesseractFound bool
-	initOnce       sync.Once
+	errOCRBusy    = errors.New("OCR service busy, please try again")
+	errOCRTimeout = errors.New("OCR processing timeout")
 )
 
-// Buffer pool for efficient memory reuse
-func init() {
-	bufferPool = sync.Pool{
-		New: func() interface{} {
-			return make([]byte, 0, 1024*1024) // 1MB initial capacity
-		},
-	}
+var (
+	ocrMutex         sync.RWMutex
+	templateCache    map[string]*template.Template
+	templateMutex    sync.RWMutex
+	ocrWorkerPool    chan OCRRequest
+	tesseractPath    string
+	tesseractFound   bool
+	tesseractVersion string
+)
 
+func init() {
 	// Initialize template cache
 	templateCache = make(map[string]*template.Template)
 
-	// Initialize OCR worker pool with 3 workers for concurrent processing
-	ocrWorkerPool = make(chan OCRRequest, 10)
-	for i := 0; i < 3; i++ {
-		go ocrWorker()
+}
+
+// startOCRWorkers creates the queue and the workers taking requests from it
+func startOCRWorkers() {
+	ocrWorkerPool = make(chan OCRRequest, config.QueueSize)
+	for i := 0; i < config.Workers; i++ {
+		go ocrWorker(ocrWorkerPool)
 	}
 }
 
@@ -83,139 +93,344 @@ func findAvailablePort(ports []int) (int, error) {
 }
 
 func main() {
-	// Initialize OCR once
-	initOnce.Do(initOCR)
+	// Key management runs without starting the server
+	if len(os.Args) > 1 && os.Args[1] == "apikey" {
+		os.Exit(runAPIKeyCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "jwt" {
+		os.Exit(runJWTCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(runConfigCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && (os.Args[1] == "--version" || os.Args[1] == "-version") {
+		printVersion()
+		return
+	}
+	// OCR from the shell, without the server
+	if len(os.Args) > 1 && os.Args[1] == "extract" {
+		os.Exit(runExtractCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "languages" {
+		os.Exit(runLanguagesCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		os.Exit(runDoctorCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "batch" {
+		os.Exit(runBatchCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "watch" {
+		os.Exit(runWatchCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		serve(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && (os.Args[1] == "help" || !strings.HasPrefix(os.Args[1], "-")) {
+		printUsage()
+		if os.Args[1] != "help" {
+			os.Exit(2)
+		}
+		return
+	}
+
+	// Without a command the server starts, as before
+	serve(os.Args[1:])
+}
+
+// serve runs the web and gRPC servers until they fail
+func serve(args []string) {
+	// Defaults, config file, environment and flags, in that order
+	cfg, err := loadConfig("ocr-simple", args)
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		os.Exit(0)
+	case errors.Is(err, errConfigUsage):
+		os.Exit(2)
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "❌ Invalid configuration:\n%v\n", err)
+		os.Exit(1)
+	}
+	config = cfg
+
+	if err := setupLogging(config.LogFormat, config.LogLevel); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error:", err)
+		os.Exit(1)
+	}
+	slog.Info("starting ocr-simple", "version", Version, "commit", GitCommit, "build_time", BuildTime, "go_version", runtime.Version())
+	if config.file != "" {
+		slog.Info("configuration loaded", "file", config.file)
+	}
+	trustedProxies = parseTrustedProxies(config.TrustedProxies)
+	fetchClient = newFetchClient(parseFetchAllowlist(config.FetchAllow))
+	startOCRWorkers()
+
+	// Find Tesseract; it is looked for again periodically and on request
+	initOCR()
+
+	// Hot folders of watch.dirs share the worker pool with the server
+	if err := startWatching(); err != nil {
+		fatal("startup failed", "err", err)
+	}
 
 	// Pre-compile templates for better performance
 	precompileTemplates()
 
-	// Daftar port yang akan dicoba secara berurutan
-	preferredPorts := []int{9000, 8000, 7000}
-	
-	// Cari port yang tersedia
-	port, err := findAvailablePort(preferredPorts)
+	// Open the document store so processed uploads can be searched later
+	docStore, err = newDocumentStore(documentsDir)
+	if err != nil {
+		fatal("startup failed", "err", err)
+	}
+	collectionStore, err = newCollectionStore(collectionsFile)
+	if err != nil {
+		fatal("startup failed", "err", err)
+	}
+	apiKeys, err = newAPIKeyStore(apiKeysFile)
+	if err != nil {
+		fatal("startup failed", "err", err)
+	}
+	apiKeys.flushEvery(apiKeyUsageFlushInterval)
+	atExit(apiKeys.Flush)
+	jwtVerifier, err = newJWTVerifier(config)
+	if err != nil {
+		fatal("configuring JWT validation failed", "err", err)
+	}
+	if jwtVerifier != nil {
+		slog.Info("JWT validation enabled", "issuers", strings.Join(jwtVerifier.issuers, ","))
+	}
+	if enabled, err := initTracing(); err != nil {
+		fatal("configuring tracing failed", "err", err)
+	} else if enabled {
+		slog.Info("OpenTelemetry tracing enabled")
+	}
+	if err := parseRateLimits(config.RateLimit); err != nil {
+		fatal("startup failed", "err", err)
+	}
+	if !authEnabled() {
+		slog.Warn("no API keys yet, every endpoint is open; create one with: ocr-simple apikey create -name admin -scopes admin")
+	}
+
+	// Cari port yang tersedia dari server.ports
+	port, err := findAvailablePort(config.Ports)
 	if err != nil {
-		log.Fatalf("❌ Error: %v", err)
+		fatal("startup failed", "err", err)
 	}
 
 	// Configure server with optimized settings
 	server := &http.Server{
 		Addr:         ":" + strconv.Itoa(port),
-		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 30 * time.Second,
-		IdleTimeout:  120 * time.Second,
+		ReadTimeout:  config.ReadTimeout,
+		WriteTimeout: config.WriteTimeout,
+		IdleTimeout:  config.IdleTimeout,
+		Handler:      withVersionHeaders(withRequestID(withTracing(withRequestLog(withMetrics(withAuth(withRateLimit(http.DefaultServeMux))))))),
 	}
 
 	http.HandleFunc("/", homeHandler)
 	http.HandleFunc("/upload", uploadHandler)
 	http.HandleFunc("/setup", setupHandler)
-
-	fmt.Printf("🚀 Server berhasil dimulai pada http://localhost:%d\n", port)
-	fmt.Printf("📋 Port yang dicoba: %v\n", preferredPorts)
-	fmt.Printf("✅ Menggunakan port: %d\n", port)
-	
-	if tesseractFound && ocrClient != nil {
-		fmt.Println("✅ Menggunakan mesin OCR Tesseract untuk pengenalan teks")
-		fmt.Printf("📊 OCR Worker Pool: %d workers siap\n", 3)
+	http.HandleFunc("/search", searchHandler)
+	http.HandleFunc("/api/search", apiSearchHandler)
+	http.HandleFunc("GET /documents", documentsHandler)
+	http.HandleFunc("GET /documents/{id}", documentHandler)
+	http.HandleFunc("GET /documents/{id}/image", documentImageHandler)
+	http.HandleFunc("GET /documents/{id}/thumbnail", documentThumbnailHandler)
+	http.HandleFunc("POST /documents/{id}/rerun", documentRerunHandler)
+	http.HandleFunc("POST /documents/{id}/delete", documentDeleteHandler)
+	http.HandleFunc("POST /documents/{id}/edit", documentEditHandler)
+	http.HandleFunc("GET /documents/{id}/diff", documentDiffHandler)
+	http.HandleFunc("POST /documents/reprocess", documentsReprocessHandler)
+	http.HandleFunc("GET /collections", collectionsHandler)
+	http.HandleFunc("POST /collections", createCollectionHandler)
+	http.HandleFunc("POST /collections/{id}/delete", deleteCollectionHandler)
+	http.HandleFunc("GET /api/collections", apiCollectionsHandler)
+	http.HandleFunc("POST /api/collections", apiCreateCollectionHandler)
+	http.HandleFunc("DELETE /api/collections/{id}", apiDeleteCollectionHandler)
+	http.HandleFunc("GET /api/documents", apiDocumentsHandler)
+	http.HandleFunc("GET /api/documents/{id}", apiDocumentHandler)
+	http.HandleFunc("PATCH /api/documents/{id}", apiUpdateDocumentHandler)
+	http.HandleFunc("GET /api/documents/{id}/versions", apiDocumentVersionsHandler)
+	http.HandleFunc("POST /api/documents/{id}/versions", apiReprocessDocumentHandler)
+	http.HandleFunc("GET /api/documents/{id}/diff", apiDocumentDiffHandler)
+	http.HandleFunc("POST /api/reprocess", apiReprocessHandler)
+	http.HandleFunc("GET /export", exportHandler)
+	http.HandleFunc("/login", loginHandler)
+	http.HandleFunc("/logout", logoutHandler)
+	http.HandleFunc("GET /api/keys", apiKeysHandler)
+	http.HandleFunc("POST /api/keys", apiCreateKeyHandler)
+	http.HandleFunc("DELETE /api/keys/{id}", apiRevokeKeyHandler)
+	http.HandleFunc("GET /healthz", healthzHandler)
+	http.HandleFunc("GET /readyz", readyzHandler)
+	http.HandleFunc("GET /api/diagnostics", apiDiagnosticsHandler)
+	http.HandleFunc("GET /api/version", apiVersionHandler)
+	http.HandleFunc("POST /api/engine/detect", apiDetectEngineHandler)
+	http.Handle("GET /metrics", metricsHandler)
+
+	// Versioned API, validated against openapi.json
+	handleAPI("POST /api/v1/recognize", apiV1RecognizeHandler)
+	handleAPI("POST /api/v1/jobs", apiV1CreateJobHandler)
+	handleAPI("GET /api/v1/jobs/{id}", apiV1JobHandler)
+	handleAPI("GET /api/v1/languages", apiV1LanguagesHandler)
+	handleAPI("GET /api/v1/health", apiV1HealthHandler)
+	handleAPI("GET /api/v1/openapi.json", openAPIHandler)
+
+	slog.Info("server started", "url", fmt.Sprintf("http://localhost:%d", port), "tried_ports", fmt.Sprint(config.Ports))
+	if engineAvailable() {
+		slog.Info("OCR workers ready", "engine", "tesseract", "workers", config.Workers)
 	} else {
-		fmt.Printf("⚠️  Tesseract OCR belum dikonfigurasi. Silakan kunjungi http://localhost:%d/setup untuk petunjuk\n", port)
+		slog.Warn("Tesseract is not configured, see the setup page", "url", fmt.Sprintf("http://localhost:%d/setup", port))
 	}
 
-	log.Fatal(server.ListenAndServe())
+	// gRPC API on its own port, sharing the OCR worker pool
+	startGRPCServer()
+
+	fatal("server stopped", "err", server.ListenAndServe())
 }
 
+// checkTesseractInstallation returns the first working Tesseract of
+// ocr.tesseract_paths; detectTesseract puts it to use
 func checkTesseractInstallation() (string, bool) {
-	// Cache check result to avoid repeated system calls
-	if tesseractPath != "" {
-		return tesseractPath, tesseractFound
-	}
-
-	// Common Tesseract executable names
-	paths := []string{"tesseract"}
-
-	// Add OS-specific paths
-	if runtime.GOOS == "windows" {
-		paths = append(paths,
-			"tesseract.exe",
-			"C:/Program Files/Tesseract-OCR/tesseract.exe",
-			"C:/Program Files (x86)/Tesseract-OCR/tesseract.exe",
-		)
-	} else {
-		paths = append(paths,
-			"/usr/bin/tesseract",
-			"/usr/local/bin/tesseract",
-			"/opt/homebrew/bin/tesseract",
-		)
-	}
-
-	// Check each path with timeout
-	for _, path := range paths {
-		if _, err := exec.LookPath(path); err == nil {
-			// Verify it works with timeout
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			cmd := exec.CommandContext(ctx, path, "--version")
-			if err := cmd.Run(); err == nil {
-				log.Printf("✅ Found Tesseract at: %s", path)
-				tesseractPath = path
-				tesseractFound = true
-				cancel()
-				return path, true
-			}
-			cancel()
+	for _, path := range config.TesseractPaths {
+		if probeTesseractPath(path).OK {
+			return path, true
 		}
 	}
-
-	tesseractFound = false
 	return "", false
 }
 
 func initOCR() {
-	path, found := checkTesseractInstallation()
+	if status := detectTesseract(); !status.Available {
+		slog.Warn("Tesseract is not available; install it and use re-check on the setup page", "err", status.Error)
+	}
+	watchTesseract(config.EngineCheckInterval)
+}
 
-	if !found {
-		log.Printf("⚠️  Tesseract OCR tidak ditemukan di system PATH")
-		log.Printf("Silakan install Tesseract OCR atau kunjungi halaman setup untuk petunjuk")
-		return
+// runOCR hands an image to the worker pool and waits for the result.
+// It returns errOCRBusy when the queue stays full and errOCRTimeout when
+// no worker answers in time.
+func runOCR(ctx context.Context, imageBytes []byte, filename string, opts OCROptions) OCRResponse {
+	responseCh := make(chan OCRResponse, 1)
+
+	select {
+	case ocrWorkerPool <- OCRRequest{
+		ImageBytes: imageBytes,
+		Filename:   filename,
+		Options:    opts,
+		ResponseCh: responseCh,
+		Enqueued:   time.Now(),
+		Ctx:        ctx,
+		Started:    ocrStartedFrom(ctx),
+	}:
+		// Request sent to worker pool
+	case <-time.After(config.QueueTimeout):
+		ocrTimeoutsTotal.WithLabelValues("queue").Inc()
+		trace.SpanFromContext(ctx).AddEvent("queue full")
+		return OCRResponse{Err: errOCRBusy}
 	}
 
-	var err error
-	if path == "tesseract" {
-		ocrClient, err = ocr.New()
-	} else {
-		ocrClient, err = ocr.New(ocr.TesseractPath(path))
+	select {
+	case result := <-responseCh:
+		return result
+	case <-time.After(config.ResultTimeout):
+		ocrTimeoutsTotal.WithLabelValues("result").Inc()
+		trace.SpanFromContext(ctx).AddEvent("no result from worker")
+		return OCRResponse{Err: errOCRTimeout}
 	}
+}
 
-	if err != nil {
-		log.Printf("❌ Inisialisasi OCR client gagal: %v", err)
-		log.Printf("Kunjungi halaman setup untuk bantuan")
-		ocrClient = nil
-		tesseractFound = false
-	} else {
-		log.Printf("✅ OCR client berhasil diinisialisasi dengan Tesseract")
+// withOCRStarted makes runOCR call started once a worker picks up the
+// request, so callers can tell waiting in the queue from being recognised
+func withOCRStarted(ctx context.Context, started func()) context.Context {
+	return context.WithValue(ctx, ocrStartedKey, started)
+}
+
+func ocrStartedFrom(ctx context.Context) func() {
+	started, _ := ctx.Value(ocrStartedKey).(func())
+	return started
+}
+
+// runOCRWithRetry is runOCR for background work, which should wait its turn
+// rather than give up when the queue is full
+func runOCRWithRetry(ctx context.Context, imageBytes []byte, filename string, opts OCROptions) OCRResponse {
+	result := runOCR(ctx, imageBytes, filename, opts)
+	for attempt := 0; errors.Is(result.Err, errOCRBusy) && attempt < 10; attempt++ {
+		time.Sleep(time.Duration(attempt+1) * time.Second)
+		result = runOCR(ctx, imageBytes, filename, opts)
 	}
+	return result
 }
 
-// OCR Worker for concurrent processing
-func ocrWorker() {
-	for req := range ocrWorkerPool {
-		result := processOCRRequest(req.ImageBytes, req.Filename)
+// OCR Worker for concurrent processing; pool is passed in so a worker keeps
+// the queue it was started for
+func ocrWorker(pool <-chan OCRRequest) {
+	for req := range pool {
+		wait := time.Since(req.Enqueued)
+		ocrQueueWait.Observe(wait.Seconds())
+		slog.DebugContext(req.Ctx, "ocr request picked up", "filename", req.Filename, "queue_wait_ms", wait.Milliseconds())
+		_, queueSpan := tracer.Start(req.Ctx, "ocr.queue", trace.WithTimestamp(req.Enqueued))
+		queueSpan.End()
+		if req.Started != nil {
+			req.Started()
+		}
+
+		busyWorkers.Add(1)
+		result := processOCRRequest(req.Ctx, req.ImageBytes, req.Filename, req.Options)
+		busyWorkers.Add(-1)
 		req.ResponseCh <- result
 	}
 }
 
-func processOCRRequest(imageBytes []byte, filename string) OCRResponse {
-	if ocrClient == nil {
+func processOCRRequest(ctx context.Context, imageBytes []byte, filename string, opts OCROptions) (resp OCRResponse) {
+	start := time.Now()
+	ocrBytesTotal.Add(float64(len(imageBytes)))
+
+	ctx, span := tracer.Start(ctx, "ocr.process", trace.WithAttributes(
+		attribute.Int("ocr.file.size", len(imageBytes)),
+		attribute.String("ocr.language", metricsLanguage(opts)),
+	))
+	defer func() {
+		if resp.Err != nil {
+			span.RecordError(resp.Err)
+			span.SetStatus(codes.Error, resp.Err.Error())
+			slog.WarnContext(ctx, "ocr failed", "filename", filename, "duration_ms", time.Since(start).Milliseconds(), "err", resp.Err)
+		} else {
+			slog.InfoContext(ctx, "ocr finished", "filename", filename, "language", metricsLanguage(opts),
+				"pages", pageCount(resp.Words), "words", len(resp.Words), "duration_ms", time.Since(start).Milliseconds())
+		}
+		span.End()
+	}()
+
+	if !engineAvailable() {
+		ocrResultsTotal.WithLabelValues("error").Inc()
 		return OCRResponse{
 			Text: "",
 			Err:  fmt.Errorf("Tesseract OCR not initialized"),
 		}
 	}
 
-	// Create unique temporary file name with timestamp
-	tempFile := fmt.Sprintf("temp_%d_%s", time.Now().UnixNano(), filename)
+	// Clean up the image first when requested; the result is always a PNG
+	if opts.Preprocess != PreprocessNone {
+		_, preSpan := tracer.Start(ctx, "ocr.preprocess", trace.WithAttributes(attribute.String("ocr.preprocess", opts.Preprocess)))
+		processed, err := preprocessImage(imageBytes, opts.Preprocess)
+		preSpan.End()
+		if err != nil {
+			ocrResultsTotal.WithLabelValues("error").Inc()
+			return OCRResponse{
+				Text: "",
+				Err:  fmt.Errorf("image preprocessing failed: %v", err),
+			}
+		}
+		imageBytes = processed
+		filename = strings.TrimSuffix(filename, filepath.Ext(filename)) + ".png"
+	}
 
-	// Write bytes to temporary file efficiently
-	if err := writeImageFileOptimized(tempFile, imageBytes); err != nil {
+	// Tesseract reads the image from a file with a random name in the
+	// system temp directory
+	_, writeSpan := tracer.Start(ctx, "ocr.write_temp_file", trace.WithAttributes(attribute.Int("ocr.file.size", len(imageBytes))))
+	tempFile, err := writeTempImage(imageBytes, filepath.Ext(filename))
+	writeSpan.End()
+	if err != nil {
+		ocrResultsTotal.WithLabelValues("error").Inc()
 		return OCRResponse{
 			Text: "",
 			Err:  fmt.Errorf("failed to create temporary file: %v", err),
@@ -225,21 +440,32 @@ func processOCRRequest(imageBytes []byte, filename string) OCRResponse {
 	// Clean up temporary file
 	defer func() {
 		if err := os.Remove(tempFile); err != nil {
-			log.Printf("Warning: failed to remove temporary file %s: %v", tempFile, err)
+			slog.WarnContext(ctx, "removing temporary file failed", "file", tempFile, "err", err)
 		}
 	}()
 
-	// Perform OCR with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// Perform OCR with timeout; the caller going away does not stop it
+	runCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), config.OCRTimeout)
 	defer cancel()
 
 	// Create a channel for OCR result
 	resultCh := make(chan OCRResponse, 1)
 
 	go func() {
+		_, tessSpan := tracer.Start(runCtx, "ocr.tesseract", trace.WithAttributes(
+			attribute.String("ocr.language", metricsLanguage(opts)),
+			attribute.Int("ocr.psm", opts.PSM),
+		))
+		// The engine may be swapped by detectTesseract, but not during a run
 		ocrMutex.RLock()
-		text, err := ocrClient.TextFromImageFile(tempFile)
+		version := tesseractVersion
+		text, words, err := recognizeImageFile(runCtx, tesseractPath, tempFile, opts)
 		ocrMutex.RUnlock()
+		tessSpan.SetAttributes(attribute.Int("ocr.pages", pageCount(words)), attribute.Int("ocr.words", len(words)))
+		if err != nil {
+			tessSpan.SetStatus(codes.Error, err.Error())
+		}
+		tessSpan.End()
 
 		if err != nil {
 			resultCh <- OCRResponse{
@@ -252,17 +478,32 @@ func processOCRRequest(imageBytes []byte, filename string) OCRResponse {
 		// Clean up the text
 		text = strings.TrimSpace(text)
 		if text == "" {
-			text = "No text detected in the image."
+			text = noTextMessage
 		}
 
-		resultCh <- OCRResponse{Text: text, Err: nil}
+		resultCh <- OCRResponse{
+			Text:          text,
+			Words:         words,
+			Confidence:    meanConfidence(words),
+			Options:       opts,
+			EngineVersion: version,
+			Err:           nil,
+		}
 	}()
 
 	// Wait for result or timeout
 	select {
 	case result := <-resultCh:
+		if result.Err != nil {
+			ocrResultsTotal.WithLabelValues("error").Inc()
+		} else {
+			ocrResultsTotal.WithLabelValues("success").Inc()
+			ocrDuration.WithLabelValues(metricsLanguage(opts), metricsPages(result.Words)).Observe(time.Since(start).Seconds())
+		}
 		return result
-	case <-ctx.Done():
+	case <-runCtx.Done():
+		ocrResultsTotal.WithLabelValues("timeout").Inc()
+		ocrTimeoutsTotal.WithLabelValues("tesseract").Inc()
 		return OCRResponse{
 			Text: "",
 			Err:  fmt.Errorf("OCR processing timeout"),
@@ -270,7 +511,7 @@ func processOCRRequest(imageBytes []byte, filename string) OCRResponse {
 	}
 }
 
-// Optimized file writing with buffer reuse
+// writeImageFileOptimized writes data to filename in a single write
 func writeImageFileOptimized(filename string, data []byte) error {
 	file, err := os.Create(filename)
 	if err != nil {
@@ -278,20 +519,35 @@ func writeImageFileOptimized(filename string, data []byte) error {
 	}
 	defer file.Close()
 
-	// Use buffered writer for better performance
-	writer := io.Writer(file)
-	if len(data) > 32*1024 { // Use buffer for larger files
-		buf := bufferPool.Get().([]byte)
-		defer bufferPool.Put(buf[:0])
+	_, err = file.Write(data)
+	return err
+}
 
-		bufferedWriter := &bytes.Buffer{}
-		bufferedWriter.Write(data)
-		_, err = bufferedWriter.WriteTo(writer)
-	} else {
-		_, err = writer.Write(data)
+// writeTempImage writes data to a new file in the system temp directory
+// and returns its path; ext keeps the image type visible to Tesseract
+func writeTempImage(data []byte, ext string) (string, error) {
+	file, err := os.CreateTemp("", "ocr-*"+ext)
+	if err != nil {
+		return "", err
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
 	}
+	return file.Name(), nil
+}
 
-	return err
+// cachedTemplate returns a precompiled template, counting cache hits and misses
+func cachedTemplate(name string) (*template.Template, bool) {
+	templateMutex.RLock()
+	tmpl, ok := templateCache[name]
+	templateMutex.RUnlock()
+	recordCacheLookup("template", ok)
+	return tmpl, ok
 }
 
 // Template precompilation for faster rendering
@@ -305,7 +561,7 @@ func precompileTemplates() {
 <html>
 <head>
     <meta charset="UTF-8">
-    <title>OCR Simple - Setup Instructions</title>
+    <title>OCR Simple - Setup</title>
     <style>
         * { box-sizing: border-box; }
         body { font-family: Arial, sans-serif; padding: 20px; background: #f5f5f5; margin: 0; line-height: 1.6; }
@@ -313,155 +569,101 @@ func precompileTemplates() {
         h1 { color: #333; border-bottom: 2px solid #007bff; padding-bottom: 10px; }
         h2 { color: #007bff; margin-top: 30px; }
         .step { background: #f8f9fa; padding: 15px; margin: 15px 0; border-left: 4px solid #007bff; border-radius: 4px; }
-        .step-number { background: #007bff; color: white; border-radius: 50%; padding: 5px 10px; margin-right: 10px; font-weight: bold; }
         .download-link { background: #007bff; color: white; padding: 10px 20px; text-decoration: none; border-radius: 5px; display: inline-block; margin: 10px 0; }
         .download-link:hover { background: #0056b3; }
-        .code { background: #f4f4f4; padding: 10px; border-radius: 4px; font-family: monospace; margin: 10px 0; }
+        .code { background: #f4f4f4; padding: 10px; border-radius: 4px; font-family: monospace; margin: 10px 0; white-space: pre-wrap; }
         .warning { background: #fff3cd; border: 1px solid #ffeaa7; color: #856404; padding: 15px; border-radius: 4px; margin: 15px 0; }
         .success { background: #d4edda; border: 1px solid #c3e6cb; color: #155724; padding: 15px; border-radius: 4px; margin: 15px 0; }
         ul { margin-left: 20px; }
         li { margin: 5px 0; }
-        .platform { background: #e9ecef; padding: 10px; margin: 10px 0; border-radius: 4px; }
+        table { width: 100%; border-collapse: collapse; margin: 10px 0; font-size: 0.9em; }
+        th, td { text-align: left; padding: 6px 8px; border-bottom: 1px solid #e9ecef; vertical-align: top; }
+        th { background: #f8f9fa; }
+        td code { background: #f4f4f4; padding: 1px 4px; border-radius: 3px; }
+        .ok { color: #28a745; font-weight: bold; }
+        .fail { color: #dc3545; font-weight: bold; }
+        .muted { color: #6c757d; font-size: 0.9em; }
+        .recheck-btn { background: #007bff; color: white; border: none; padding: 6px 14px; border-radius: 4px; cursor: pointer; margin-top: 10px; }
+        .recheck-btn:disabled { background: #6c757d; cursor: wait; }
     </style>
 </head>
 <body>
     <div class="container">
-        <h1>🚀 OCR Simple - Setup Instructions</h1>
-        
-        <div class="warning">
-            <strong>⚠️ Tesseract OCR Engine Not Found</strong><br>
-            To use this OCR application, you need to install Tesseract OCR on your system.
-        </div>
-
-        <h2>📥 Installation Instructions</h2>
-
-        <div class="platform">
-            <h3>🍎 macOS</h3>
-            <div class="step">
-                <span class="step-number">1</span>
-                <strong>Install using Homebrew (Recommended):</strong>
-                <div class="code">brew install tesseract</div>
-                <br>
-                <strong>Or install with additional language packs:</strong>
-                <div class="code">brew install tesseract tesseract-lang</div>
-            </div>
-        </div>
-
-        <div class="platform">
-            <h3>🐧 Linux (Ubuntu/Debian)</h3>
-            <div class="step">
-                <span class="step-number">1</span>
-                <strong>Install Tesseract:</strong>
-                <div class="code">sudo apt update<br>sudo apt install tesseract-ocr</div>
-                <br>
-                <strong>Install additional languages (optional):</strong>
-                <div class="code">sudo apt install tesseract-ocr-ind tesseract-ocr-eng</div>
-            </div>
-        </div>
-
-        <div class="platform">
-            <h3>🐧 Linux (CentOS/RHEL/Fedora)</h3>
-            <div class="step">
-                <span class="step-number">1</span>
-                <strong>Install Tesseract:</strong>
-                <div class="code">sudo dnf install tesseract</div>
-                <strong>or for older versions:</strong>
-                <div class="code">sudo yum install tesseract</div>
-            </div>
-        </div>
+        <h1>🚀 OCR Simple - Setup</h1>
 
-        <div class="platform">
-            <h3>🪟 Windows</h3>
-            <div class="step">
-                <span class="step-number">1</span>
-                <strong>Download and install Tesseract:</strong>
-                <br><br>
-                <a href="https://github.com/UB-Mannheim/tesseract/wiki" class="download-link" target="_blank">
-                    📦 Download Tesseract for Windows
-                </a>
-                <br><br>
-                <strong>Installation tips:</strong>
-                <ul>
-                    <li>Download the latest installer from the UB-Mannheim repository</li>
-                    <li>Run the installer as Administrator</li>
-                    <li>Make sure to check "Add to PATH" during installation</li>
-                    <li>Restart your command prompt after installation</li>
-                </ul>
-            </div>
+        <div class="{{if .Available}}success{{else}}warning{{end}}" id="engineStatus">
+            <strong id="engineStatusTitle">{{if .Available}}✅ Tesseract {{.Version}} is ready{{else}}⚠️ Tesseract OCR Engine Not Found{{end}}</strong><br>
+            <span id="engineStatusDetail">{{if .Available}}Using {{.Path}}.{{else}}None of the paths below gave a working Tesseract. Install it with the commands for this server, then re-check.{{end}}</span><br>
+            <button class="recheck-btn" id="recheckBtn" onclick="recheckEngine()">🔄 Re-check</button>
+            <span class="muted">The server also looks again every minute by itself.</span>
         </div>
 
-        <h2>🔧 Verification Steps</h2>
+        <h2>🔍 Tesseract Paths Probed</h2>
+        <p class="muted">From <code>ocr.tesseract_paths</code>, tried in order; the first that works is used.</p>
+        <table>
+            <tr><th>Path</th><th>Result</th></tr>
+            {{range .Probes}}
+            <tr>
+                <td><code>{{.Path}}</code>{{if and .Resolved (ne .Resolved .Path)}}<br><span class="muted">→ {{.Resolved}}</span>{{end}}</td>
+                <td>{{if .OK}}<span class="ok">✅ works</span>{{else}}<span class="fail">❌ {{.Error}}</span>{{end}}</td>
+            </tr>
+            {{end}}
+        </table>
+
+        {{if not .Available}}
+        <h2>📥 Install on {{.Platform.Name}}</h2>
         <div class="step">
-            <span class="step-number">2</span>
-            <strong>Verify the installation:</strong>
-            <br><br>
-            <p>Open a terminal/command prompt and run:</p>
+            <span class="muted">Detected from the server: {{.OS}}/{{.Arch}}</span>
+            {{if .Platform.Install}}<div class="code">{{range .Platform.Install}}{{.}}
+{{end}}</div>{{end}}
+            {{if .Platform.Link}}<a href="{{.Platform.Link}}" class="download-link" target="_blank">📦 Download Tesseract</a>{{end}}
+            <p>Check the installation in a terminal on the server, then press <strong>🔄 Re-check</strong>:</p>
             <div class="code">tesseract --version</div>
-            <br>
-            <p>You should see version information if Tesseract is properly installed.</p>
-        </div>
-
-        <h2>🎯 Test the Setup</h2>
-        <div class="step">
-            <span class="step-number">3</span>
-            <strong>Restart the OCR application and test:</strong>
-            <br><br>
-            <ol>
-                <li>Stop the current server (Ctrl+C in terminal)</li>
-                <li>Run the application again: <code>./ocr-app</code> or <code>go run main.go</code></li>
-                <li>Look for the success message: "✅ Using Tesseract OCR engine for text recognition"</li>
-                <li>Visit <a href="/">the main page</a> to test OCR functionality</li>
-            </ol>
-        </div>
-
-        <h2>🌍 Language Support</h2>
-        <div class="step">
-            <strong>Tesseract supports many languages:</strong>
-            <br><br>
-            <p><strong>Default:</strong> English (eng)</p>
-            <p><strong>Additional languages you can install:</strong></p>
-            <ul>
-                <li><strong>Indonesian:</strong> tesseract-ocr-ind</li>
-                <li><strong>Chinese:</strong> tesseract-ocr-chi-sim (Simplified), tesseract-ocr-chi-tra (Traditional)</li>
-                <li><strong>Japanese:</strong> tesseract-ocr-jpn</li>
-                <li><strong>Korean:</strong> tesseract-ocr-kor</li>
-                <li><strong>Arabic:</strong> tesseract-ocr-ara</li>
-                <li>And many more...</li>
-            </ul>
+            <p class="muted">Installed somewhere else? Add the path to <code>ocr.tesseract_paths</code> (env <code>OCR_TESSERACT_PATHS</code>).</p>
         </div>
+        {{end}}
+
+        <h2>🌍 Language Packs</h2>
+        {{if .Available}}
+        <p>Installed: {{range $i, $l := .Languages}}{{if $i}}, {{end}}<code>{{$l}}</code>{{else}}<span class="fail">none</span>{{end}}</p>
+        {{if .LanguageError}}<p class="fail">❌ tesseract --list-langs failed: {{.LanguageError}}</p>{{end}}
+        {{else}}
+        <p class="muted">Shown once Tesseract is found.</p>
+        {{end}}
+        <table>
+            <tr><th>Recommended</th><th>Status</th><th>Install</th></tr>
+            {{range .Recommended}}
+            <tr>
+                <td><code>{{.Code}}</code></td>
+                <td>{{if .Installed}}<span class="ok">✅ installed</span>{{else}}<span class="fail">❌ missing</span>{{end}}</td>
+                <td>{{if not .Installed}}{{if .Install}}<code>{{.Install}}</code>{{end}}{{end}}</td>
+            </tr>
+            {{end}}
+        </table>
+        <p>tessdata: {{if .Tessdata}}<code>{{.Tessdata}}</code>{{else}}<span class="muted">unknown</span>{{end}}
+            · TESSDATA_PREFIX: {{if .TessdataPrefix}}<code>{{.TessdataPrefix}}</code>{{else}}<span class="muted">not set</span>{{end}}</p>
+
+        <h2>📁 Write Permissions</h2>
+        <table>
+            <tr><th>Used for</th><th>Directory</th><th>Status</th></tr>
+            {{range .Dirs}}
+            <tr>
+                <td>{{.Purpose}}</td>
+                <td><code>{{.Dir}}</code></td>
+                <td>{{if .Writable}}<span class="ok">✅ writable</span>{{else}}<span class="fail">❌ {{.Error}}</span>{{end}}</td>
+            </tr>
+            {{end}}
+        </table>
 
         <h2>🚨 Troubleshooting</h2>
         <div class="step">
-            <strong>Common issues and solutions:</strong>
-            <br><br>
-            <strong>❌ "tesseract: command not found":</strong>
-            <ul>
-                <li>Make sure Tesseract is installed correctly</li>
-                <li>Check if it's added to your system PATH</li>
-                <li>Restart your terminal/command prompt</li>
-                <li>On Windows, make sure you checked "Add to PATH" during installation</li>
-            </ul>
-            <br>
-            <strong>❌ Poor OCR accuracy:</strong>
             <ul>
-                <li>Use high-resolution, clear images</li>
-                <li>Ensure good contrast between text and background</li>
-                <li>Try different image formats (PNG usually works best)</li>
-                <li>Install additional language packs if needed</li>
+                <li><strong>"not found"</strong>: Tesseract is not installed or not in the PATH of the server process; services often have a shorter PATH than your shell</li>
+                <li><strong>"--version failed"</strong>: the binary exists but cannot run, e.g. missing libraries or permissions</li>
+                <li><strong>Language missing</strong>: install the pack, or point <code>TESSDATA_PREFIX</code> at a tessdata folder that has it</li>
+                <li><strong>Not writable</strong>: run the server as a user that may write there, or start it from another directory</li>
+                <li>Check the server logs for detailed error messages</li>
             </ul>
-            <br>
-            <strong>❌ Application starts but OCR fails:</strong>
-            <ul>
-                <li>Check if the uploaded image format is supported</li>
-                <li>Verify Tesseract permissions</li>
-                <li>Check server logs for detailed error messages</li>
-            </ul>
-        </div>
-
-        <div class="success">
-            <strong>✅ Easy Setup!</strong><br>
-            Unlike PaddleOCR, Tesseract is much easier to install and configure. Most package managers 
-            include it, and it's widely supported across all operating systems.
         </div>
 
         <p style="text-align: center; margin-top: 30px;">
@@ -470,13 +672,40 @@ func precompileTemplates() {
             </a>
         </p>
     </div>
+
+    <script>
+        function recheckEngine() {
+            const btn = document.getElementById('recheckBtn');
+            const box = document.getElementById('engineStatus');
+            const title = document.getElementById('engineStatusTitle');
+            const detail = document.getElementById('engineStatusDetail');
+            btn.disabled = true;
+            fetch('/api/engine/detect', { method: 'POST' })
+                .then(r => r.json())
+                .then(d => {
+                    if (d.error && d.error.code) {
+                        box.className = 'warning';
+                        title.textContent = '⚠️ Re-check failed';
+                        detail.textContent = d.error.message + (d.error.status === 401 || d.error.status === 403 ? ' (log in with an admin key)' : '');
+                        btn.disabled = false;
+                        return;
+                    }
+                    // Reload so every check on the page is run again
+                    location.reload();
+                })
+                .catch(e => {
+                    detail.textContent = 'Error: ' + e.message;
+                    btn.disabled = false;
+                });
+        }
+    </script>
 </body>
 </html>`
 
 	var err error
 	templateCache["setup"], err = template.New("setup").Parse(setupTmpl)
 	if err != nil {
-		log.Printf("Error precompiling setup template: %v", err)
+		slog.Error("precompiling template failed", "template", "setup", "err", err)
 	}
 
 	// Precompile home template
@@ -514,6 +743,9 @@ func precompileTemplates() {
         .status-ok { background: #28a745; color: white; }
         .status-error { background: #dc3545; color: white; }
         .performance { background: #e3f2fd; padding: 4px 8px; border-radius: 3px; font-size: 0.8em; color: #1976d2; margin-left: 5px; }
+        .nav-link { font-size: 0.8em; color: #007bff; text-decoration: none; margin-left: 5px; }
+        .tags-input { padding: 5px 8px; border: 1px solid #ccc; border-radius: 3px; font-size: 13px; }
+        .footer { text-align: center; color: #999; font-size: 0.75em; margin-top: 6px; }
     </style>
 </head>
 <body>
@@ -523,10 +755,14 @@ func precompileTemplates() {
             <p class="subtitle">Powered by <span class="engine-badge">Tesseract OCR</span> - Reliable Text Recognition 
                 <span class="status-badge {{.StatusClass}}" id="statusBadge">{{.Status}}</span>
                 <span class="performance">⚡ Optimized</span>
+                <a href="/search" class="nav-link">🔍 Cari Dokumen</a>
+                <a href="/documents" class="nav-link">📚 Riwayat</a>
+                <a href="/collections" class="nav-link">🗂️ Koleksi</a>
+                {{if .LoggedIn}}<a href="/logout" class="nav-link">🚪 Keluar</a>{{end}}
             </p>
         </div>
         
-        {{.SetupWarning}}
+        <div class="setup-warning" id="setupWarning"{{if not .SetupWarning}} style="display: none;"{{end}}>⚠️ Tesseract OCR not installed. <a href="/setup">Click here for installation instructions</a></div>
         
         <div class="side-by-side">
             <div class="left-panel">
@@ -536,6 +772,19 @@ func precompileTemplates() {
                     <input type="file" id="fileInput" accept="image/*">
                     <button type="button" class="btn" onclick="document.getElementById('fileInput').click()">Browse</button>
                 </div>
+                <div style="display: flex; gap: 5px;">
+                    <select class="tags-input" id="collectionInput">
+                        <option value="">Tanpa koleksi</option>
+                        {{range .Collections}}<option value="{{.ID}}">{{.Name}}</option>{{end}}
+                    </select>
+                    <input type="text" class="tags-input" id="tagsInput" placeholder="Tag (opsional, pisahkan dengan koma)" style="flex: 1;">
+                    <select class="tags-input" id="langInput" title="Bahasa OCR">
+                        <option value="">Bahasa: default</option>
+                        <option value="ind">Indonesia</option>
+                        <option value="eng">English</option>
+                        <option value="ind+eng">Indonesia + English</option>
+                    </select>
+                </div>
             </div>
             
             <div class="right-panel">
@@ -550,6 +799,7 @@ func precompileTemplates() {
             </div>
         </div>
     </div>
+    <div class="footer">ocr-simple {{.Version.Version}} ({{.Commit}}) · Tesseract {{if .Version.TesseractVersion}}{{.Version.TesseractVersion}}{{else}}tidak terdeteksi{{end}}</div>
 
     <script>
         let currentFile = null;
@@ -559,6 +809,23 @@ func precompileTemplates() {
         const extractedText = document.getElementById('extractedText');
         const copyBtn = document.getElementById('copyBtn');
         const processingTime = document.getElementById('processingTime');
+        const statusBadge = document.getElementById('statusBadge');
+        const setupWarning = document.getElementById('setupWarning');
+
+        // Tesseract can be installed or removed while the page is open
+        function refreshEngineStatus() {
+            fetch('/api/v1/health')
+                .then(r => r.json())
+                .then(h => {
+                    const ok = h.tesseract && h.tesseract.available;
+                    statusBadge.textContent = ok ? 'Ready' : 'Not Configured';
+                    statusBadge.className = 'status-badge ' + (ok ? 'status-ok' : 'status-error');
+                    setupWarning.style.display = ok ? 'none' : '';
+                })
+                .catch(() => {});
+        }
+        setInterval(refreshEngineStatus, 15000);
+        document.addEventListener('visibilitychange', () => { if (!document.hidden) refreshEngineStatus(); });
 
         // Optimized paste handling
         document.addEventListener('paste', (e) => {
@@ -604,9 +871,9 @@ func precompileTemplates() {
         });
 
         function handleFile(file) {
-            // Validate file size (max 5MB)
-            if (file.size > 5 * 1024 * 1024) {
-                extractedText.textContent = 'Error: File too large. Maximum size is 5MB.';
+            // Validate file size against the server's upload.max_size
+            if (file.size > {{.MaxUploadSize}}) {
+                extractedText.textContent = 'Error: File too large. Maximum size is {{.MaxUploadLabel}}.';
                 return;
             }
 
@@ -640,6 +907,9 @@ func precompileTemplates() {
             
             const formData = new FormData();
             formData.append('image', currentFile);
+            formData.append('tags', document.getElementById('tagsInput').value);
+            formData.append('collection', document.getElementById('collectionInput').value);
+            formData.append('lang', document.getElementById('langInput').value);
             
             // Optimized fetch with timeout
             const controller = new AbortController();
@@ -662,8 +932,11 @@ func precompileTemplates() {
                 requestAnimationFrame(() => {
                     extractedText.className = 'extracted-text';
                     const text = d.text || 'No text detected by Tesseract OCR.';
-                    extractedText.textContent = d.error ? 'Error: ' + d.error : text;
+                    extractedText.textContent = d.error ? 'Error: ' + d.error.message + ' (' + d.error.code + ')' : text;
                     processingTime.textContent = '⏱️ ' + duration + 's';
+                    if (d.id) {
+                        processingTime.innerHTML += ' · <a href="/documents/' + encodeURIComponent(d.id) + '">📚 Riwayat</a>';
+                    }
                     
                     if (!d.error && d.text) {
                         copyBtn.style.display = 'inline-block';
@@ -699,36 +972,63 @@ func precompileTemplates() {
 
 	templateCache["home"], err = template.New("home").Parse(homeTmpl)
 	if err != nil {
-		log.Printf("Error precompiling home template: %v", err)
+		slog.Error("precompiling template failed", "template", "home", "err", err)
+	}
+
+	templateCache["search"], err = template.New("search").Parse(searchTmpl)
+	if err != nil {
+		slog.Error("precompiling template failed", "template", "search", "err", err)
+	}
+
+	templateCache["documents"], err = template.New("documents").Funcs(documentTemplateFuncs).Parse(documentsTmpl)
+	if err != nil {
+		slog.Error("precompiling template failed", "template", "documents", "err", err)
+	}
+
+	templateCache["document"], err = template.New("document").Funcs(documentTemplateFuncs).Parse(documentTmpl)
+	if err != nil {
+		slog.Error("precompiling template failed", "template", "document", "err", err)
+	}
+
+	templateCache["collections"], err = template.New("collections").Parse(collectionsTmpl)
+	if err != nil {
+		slog.Error("precompiling template failed", "template", "collections", "err", err)
+	}
+
+	templateCache["diff"], err = template.New("diff").Parse(diffTmpl)
+	if err != nil {
+		slog.Error("precompiling template failed", "template", "diff", "err", err)
+	}
+
+	templateCache["login"], err = template.New("login").Parse(loginTmpl)
+	if err != nil {
+		slog.Error("precompiling template failed", "template", "login", "err", err)
 	}
 }
 
 func setupHandler(w http.ResponseWriter, r *http.Request) {
 	// Use cached template
-	templateMutex.RLock()
-	tmpl, exists := templateCache["setup"]
-	templateMutex.RUnlock()
+	tmpl, exists := cachedTemplate("setup")
 
 	if !exists {
-		http.Error(w, "Template not found", http.StatusInternalServerError)
+		writeError(w, r, errTemplateNotFound)
 		return
 	}
 
-	// Set caching headers for static content
-	w.Header().Set("Cache-Control", "public, max-age=300") // 5 minutes
+	// The page reports the current environment, so it is not cached by
+	// the browser; the probes themselves are reused for setupReportTTL
+	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
-	tmpl.Execute(w, nil)
+	tmpl.Execute(w, cachedSetupReport())
 }
 
 func homeHandler(w http.ResponseWriter, r *http.Request) {
 	// Use cached template
-	templateMutex.RLock()
-	tmpl, exists := templateCache["home"]
-	templateMutex.RUnlock()
+	tmpl, exists := cachedTemplate("home")
 
 	if !exists {
-		http.Error(w, "Template not found", http.StatusInternalServerError)
+		writeError(w, r, errTemplateNotFound)
 		return
 	}
 
@@ -739,19 +1039,31 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
 	data := struct {
 		Status         string
 		StatusClass    string
-		SetupWarning   string
+		SetupWarning   bool
 		InitialMessage string
+		Collections    []*Collection
+		LoggedIn       bool
+		Version        VersionInfo
+		Commit         string
+		MaxUploadSize  int
+		MaxUploadLabel string
 	}{
 		Status:         "Ready",
 		StatusClass:    "status-ok",
-		SetupWarning:   "",
+		SetupWarning:   false,
 		InitialMessage: "Belum ada gambar yang diproses...",
+		Collections:    collectionStore.List(),
+		LoggedIn:       apiKeyFrom(r.Context()) != nil,
+		Version:        versionInfo(),
+		Commit:         shortCommit(),
+		MaxUploadSize:  config.MaxUploadSize,
+		MaxUploadLabel: (*sizeValue)(&config.MaxUploadSize).String(),
 	}
 
-	if !tesseractFound || ocrClient == nil {
+	if !engineAvailable() {
 		data.Status = "Not Configured"
 		data.StatusClass = "status-error"
-		data.SetupWarning = `<div class="setup-warning">⚠️ Tesseract OCR not installed. <a href="/setup">Click here for installation instructions</a></div>`
+		data.SetupWarning = true
 		data.InitialMessage = "Tesseract OCR not installed. Please visit the setup page to install Tesseract OCR."
 	}
 
@@ -769,97 +1081,56 @@ func uploadHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Cache-Control", "no-cache")
 
 	// Check if OCR client is initialized
-	if !tesseractFound || ocrClient == nil {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		w.Write([]byte(`{"error": "Tesseract OCR not configured. Please visit /setup for installation instructions."}`))
+	if !engineAvailable() {
+		writeError(w, r, errEngineUnavailable)
 		return
 	}
 
-	// Optimized form parsing
-	err := r.ParseMultipartForm(5 << 20) // 5 MB max
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(`{"error": "File too large or invalid form data"}`))
+	// Multipart from the browser, or a raw image/* or JSON body from services
+	input, apiErr := readRecognitionInput(w, r)
+	if apiErr != nil {
+		writeError(w, r, apiErr)
 		return
 	}
-
-	// Get file from form
-	file, header, err := r.FormFile("image")
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(`{"error": "No file uploaded or invalid file"}`))
+	slog.DebugContext(r.Context(), "upload received", "filename", input.Filename, "size", len(input.Image))
+
+	// Use worker pool for concurrent OCR processing; the upload is kept so it
+	// shows up in the history and search pages
+	result, apiErr := recognize(r.Context(), input, runOCR)
+	if r.Context().Err() != nil {
+		// The client is gone; the result only lands in the history
+		ocrCancellationsTotal.Inc()
 		return
 	}
-	defer file.Close()
-
-	// Fast file type validation
-	if !isValidImageType(header.Filename) {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(`{"error": "Please upload a valid image file (PNG, JPG, JPEG, GIF, BMP, TIFF)"}`))
+	if apiErr != nil {
+		writeError(w, r, apiErr)
 		return
 	}
 
-	// Efficient file reading with buffer reuse
-	buf := bufferPool.Get().([]byte)
-	defer bufferPool.Put(buf[:0])
-
-	fileBytes, err := io.ReadAll(file)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(`{"error": "Failed to read uploaded file"}`))
-		return
-	}
-
-	// Use worker pool for concurrent OCR processing
-	responseCh := make(chan OCRResponse, 1)
-
-	select {
-	case ocrWorkerPool <- OCRRequest{
-		ImageBytes: fileBytes,
-		Filename:   header.Filename,
-		ResponseCh: responseCh,
-	}:
-		// Request sent to worker pool
-	case <-time.After(5 * time.Second):
-		w.WriteHeader(http.StatusServiceUnavailable)
-		w.Write([]byte(`{"error": "OCR service busy, please try again"}`))
-		return
+	// Pre-allocated response structure for better performance
+	response := struct {
+		ID         string  `json:"id,omitempty"`
+		Text       string  `json:"text"`
+		Filename   string  `json:"filename"`
+		Engine     string  `json:"engine"`
+		Confidence float64 `json:"confidence"`
+	}{
+		ID:         result.DocumentID,
+		Text:       result.Text,
+		Filename:   result.Filename,
+		Engine:     "Tesseract OCR",
+		Confidence: result.Confidence,
 	}
 
-	// Wait for result
-	select {
-	case result := <-responseCh:
-		if result.Err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(fmt.Sprintf(`{"error": "OCR failed: %v"}`, result.Err)))
-			return
-		}
-
-		// Pre-allocated response structure for better performance
-		response := struct {
-			Text     string `json:"text"`
-			Filename string `json:"filename"`
-			Engine   string `json:"engine"`
-		}{
-			Text:     result.Text,
-			Filename: header.Filename,
-			Engine:   "Tesseract OCR",
-		}
-
-		// Use optimized JSON encoding
-		encoder := json.NewEncoder(w)
-		encoder.Encode(response)
-
-	case <-time.After(35 * time.Second):
-		w.WriteHeader(http.StatusRequestTimeout)
-		w.Write([]byte(`{"error": "OCR processing timeout"}`))
-	}
+	// Use optimized JSON encoding
+	encoder := json.NewEncoder(w)
+	encoder.Encode(response)
 }
 
 func isValidImageType(filename string) bool {
 	ext := strings.ToLower(filepath.Ext(filename))
 	// Pre-defined slice for better performance
-	validExts := [6]string{".png", ".jpg", ".jpeg", ".gif", ".bmp", ".tiff"}
+	validExts := [7]string{".png", ".jpg", ".jpeg", ".gif", ".bmp", ".tif", ".tiff"}
 	for _, validExt := range validExts {
 		if ext == validExt {
 			return true
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metricsRegistry holds the metrics served on /metrics; a registry of our
+// own keeps the output free of metrics registered by dependencies
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	httpRequestsTotal = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "ocr_http_requests_total",
+		Help: "HTTP requests by route pattern, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	httpRequestDuration = promauto.With(metricsRegistry).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ocr_http_request_duration_seconds",
+		Help:    "Time to answer HTTP requests by route pattern.",
+		Buckets: []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"route"})
+
+	ocrDuration = promauto.With(metricsRegistry).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ocr_duration_seconds",
+		Help:    "Time a worker spent on a successful recognition, including preprocessing, by language and page count.",
+		Buckets: []float64{.1, .25, .5, 1, 2, 5, 10, 20, 30},
+	}, []string{"language", "pages"})
+
+	ocrQueueWait = promauto.With(metricsRegistry).NewHistogram(prometheus.HistogramOpts{
+		Name:    "ocr_queue_wait_seconds",
+		Help:    "Time requests waited in the queue before a worker picked them up.",
+		Buckets: []float64{.001, .01, .1, .5, 1, 2.5, 5, 10, 30},
+	})
+
+	ocrResultsTotal = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "ocr_recognitions_total",
+		Help: "Recognitions run by the workers by result: success, error or timeout.",
+	}, []string{"result"})
+
+	ocrTimeoutsTotal = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "ocr_timeouts_total",
+		Help: "Timeouts by stage: queue (no free slot in time), result (no answer from a worker in time) or tesseract (the run was killed).",
+	}, []string{"stage"})
+
+	ocrCancellationsTotal = promauto.With(metricsRegistry).NewCounter(prometheus.CounterOpts{
+		Name: "ocr_cancellations_total",
+		Help: "Uploads whose client went away before the OCR result was ready.",
+	})
+
+	ocrBytesTotal = promauto.With(metricsRegistry).NewCounter(prometheus.CounterOpts{
+		Name: "ocr_processed_bytes_total",
+		Help: "Size of the images handed to the workers.",
+	})
+
+	watchFilesTotal = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "ocr_watch_files_total",
+		Help: "Files taken from hot folders by result: processed or failed.",
+	}, []string{"result"})
+
+	cacheHitsTotal = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "ocr_cache_hits_total",
+		Help: "Cache lookups that found an entry, by cache.",
+	}, []string{"cache"})
+
+	cacheMissesTotal = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "ocr_cache_misses_total",
+		Help: "Cache lookups that did not find an entry, by cache.",
+	}, []string{"cache"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "ocr_queue_length",
+			Help: "Requests waiting in the OCR queue.",
+		}, func() float64 { return float64(len(ocrWorkerPool)) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "ocr_queue_capacity",
+			Help: "Size of the OCR queue.",
+		}, func() float64 { return float64(cap(ocrWorkerPool)) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "ocr_workers_busy",
+			Help: "Workers currently running a recognition.",
+		}, func() float64 { return float64(busyWorkers.Load()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "ocr_workers",
+			Help: "Number of OCR workers.",
+		}, func() float64 { return float64(config.Workers) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "ocr_engine_available",
+			Help: "1 when Tesseract is installed and initialised.",
+		}, func() float64 {
+			if engineAvailable() {
+				return 1
+			}
+			return 0
+		}),
+	)
+}
+
+var metricsHandler = promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+
+// metricsLanguage is the language label of a recognition
+func metricsLanguage(opts OCROptions) string {
+	if opts.Language == "" {
+		return "default"
+	}
+	return opts.Language
+}
+
+// metricsPages buckets page counts so the label stays small
+func metricsPages(words []OCRWord) string {
+	switch n := pageCount(words); {
+	case n <= 1:
+		return "1"
+	case n <= 5:
+		return "2-5"
+	case n <= 20:
+		return "6-20"
+	default:
+		return "21+"
+	}
+}
+
+// recordCacheLookup counts a lookup in one of the server's caches
+func recordCacheLookup(cache string, hit bool) {
+	if hit {
+		cacheHitsTotal.WithLabelValues(cache).Inc()
+	} else {
+		cacheMissesTotal.WithLabelValues(cache).Inc()
+	}
+}
+
+// statusRecorder remembers the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter { return s.ResponseWriter }
+
+// withMetrics counts requests by the mux pattern they match, so that IDs in
+// paths do not create a series per document
+func withMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		route := "unmatched"
+		if _, pattern := http.DefaultServeMux.Handler(r); pattern != "" {
+			route = pattern
+		}
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		httpRequestsTotal.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Inc()
+		httpRequestDuration.WithLabelValues(route).Observe(time.Since(start).Seconds())
+	})
+}
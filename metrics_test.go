@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCachedTemplateCountsLookups(t *testing.T) {
+	hits, misses := cacheHitsTotal.WithLabelValues("template"), cacheMissesTotal.WithLabelValues("template")
+	beforeHits, beforeMisses := testutil.ToFloat64(hits), testutil.ToFloat64(misses)
+
+	precompileTemplates()
+	if _, ok := cachedTemplate("home"); !ok {
+		t.Fatal("home template missing")
+	}
+	if _, ok := cachedTemplate("no-such-page"); ok {
+		t.Fatal("unknown template found")
+	}
+	if got := testutil.ToFloat64(hits) - beforeHits; got != 1 {
+		t.Errorf("template hits grew by %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(misses) - beforeMisses; got != 1 {
+		t.Errorf("template misses grew by %v, want 1", got)
+	}
+}
@@ -0,0 +1,812 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: ocrpb/ocr.proto
+
+// gRPC interface of OCR Simple. It mirrors the REST API v1 (/api/v1): the
+// same options, limits and error codes, served by the same worker pool.
+
+package ocrpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Options struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Tesseract language codes, e.g. "eng" or "ind+eng". Default "eng".
+	Language string `protobuf:"bytes,1,opt,name=language,proto3" json:"language,omitempty"`
+	// Page segmentation mode 0-13; 0 keeps the Tesseract default.
+	Psm int32 `protobuf:"varint,2,opt,name=psm,proto3" json:"psm,omitempty"`
+	// "", "grayscale" or "threshold".
+	Preprocess    string `protobuf:"bytes,3,opt,name=preprocess,proto3" json:"preprocess,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Options) Reset() {
+	*x = Options{}
+	mi := &file_ocrpb_ocr_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Options) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Options) ProtoMessage() {}
+
+func (x *Options) ProtoReflect() protoreflect.Message {
+	mi := &file_ocrpb_ocr_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Options.ProtoReflect.Descriptor instead.
+func (*Options) Descriptor() ([]byte, []int) {
+	return file_ocrpb_ocr_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Options) GetLanguage() string {
+	if x != nil {
+		return x.Language
+	}
+	return ""
+}
+
+func (x *Options) GetPsm() int32 {
+	if x != nil {
+		return x.Psm
+	}
+	return 0
+}
+
+func (x *Options) GetPreprocess() string {
+	if x != nil {
+		return x.Preprocess
+	}
+	return ""
+}
+
+type RecognizeRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Source:
+	//
+	//	*RecognizeRequest_Image
+	//	*RecognizeRequest_Url
+	Source isRecognizeRequest_Source `protobuf_oneof:"source"`
+	// Name to store the image under; the extension is detected when missing.
+	Filename   string           `protobuf:"bytes,3,opt,name=filename,proto3" json:"filename,omitempty"`
+	Options    *Options         `protobuf:"bytes,4,opt,name=options,proto3" json:"options,omitempty"`
+	Collection string           `protobuf:"bytes,5,opt,name=collection,proto3" json:"collection,omitempty"`
+	Tags       []string         `protobuf:"bytes,6,rep,name=tags,proto3" json:"tags,omitempty"`
+	Metadata   *structpb.Struct `protobuf:"bytes,7,opt,name=metadata,proto3" json:"metadata,omitempty"`
+	// Keep the image and result as a document. Default true.
+	Store         *bool `protobuf:"varint,8,opt,name=store,proto3,oneof" json:"store,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RecognizeRequest) Reset() {
+	*x = RecognizeRequest{}
+	mi := &file_ocrpb_ocr_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RecognizeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RecognizeRequest) ProtoMessage() {}
+
+func (x *RecognizeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ocrpb_ocr_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RecognizeRequest.ProtoReflect.Descriptor instead.
+func (*RecognizeRequest) Descriptor() ([]byte, []int) {
+	return file_ocrpb_ocr_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *RecognizeRequest) GetSource() isRecognizeRequest_Source {
+	if x != nil {
+		return x.Source
+	}
+	return nil
+}
+
+func (x *RecognizeRequest) GetImage() []byte {
+	if x != nil {
+		if x, ok := x.Source.(*RecognizeRequest_Image); ok {
+			return x.Image
+		}
+	}
+	return nil
+}
+
+func (x *RecognizeRequest) GetUrl() string {
+	if x != nil {
+		if x, ok := x.Source.(*RecognizeRequest_Url); ok {
+			return x.Url
+		}
+	}
+	return ""
+}
+
+func (x *RecognizeRequest) GetFilename() string {
+	if x != nil {
+		return x.Filename
+	}
+	return ""
+}
+
+func (x *RecognizeRequest) GetOptions() *Options {
+	if x != nil {
+		return x.Options
+	}
+	return nil
+}
+
+func (x *RecognizeRequest) GetCollection() string {
+	if x != nil {
+		return x.Collection
+	}
+	return ""
+}
+
+func (x *RecognizeRequest) GetTags() []string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+func (x *RecognizeRequest) GetMetadata() *structpb.Struct {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+func (x *RecognizeRequest) GetStore() bool {
+	if x != nil && x.Store != nil {
+		return *x.Store
+	}
+	return false
+}
+
+type isRecognizeRequest_Source interface {
+	isRecognizeRequest_Source()
+}
+
+type RecognizeRequest_Image struct {
+	// PNG, JPG, GIF, BMP or TIFF content, at most upload.max_size (5 MB by default).
+	Image []byte `protobuf:"bytes,1,opt,name=image,proto3,oneof"`
+}
+
+type RecognizeRequest_Url struct {
+	// http or https URL the server downloads the image from.
+	Url string `protobuf:"bytes,2,opt,name=url,proto3,oneof"`
+}
+
+func (*RecognizeRequest_Image) isRecognizeRequest_Source() {}
+
+func (*RecognizeRequest_Url) isRecognizeRequest_Source() {}
+
+type UploadRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Part:
+	//
+	//	*UploadRequest_Header
+	//	*UploadRequest_Chunk
+	Part          isUploadRequest_Part `protobuf_oneof:"part"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UploadRequest) Reset() {
+	*x = UploadRequest{}
+	mi := &file_ocrpb_ocr_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UploadRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UploadRequest) ProtoMessage() {}
+
+func (x *UploadRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ocrpb_ocr_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UploadRequest.ProtoReflect.Descriptor instead.
+func (*UploadRequest) Descriptor() ([]byte, []int) {
+	return file_ocrpb_ocr_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *UploadRequest) GetPart() isUploadRequest_Part {
+	if x != nil {
+		return x.Part
+	}
+	return nil
+}
+
+func (x *UploadRequest) GetHeader() *RecognizeRequest {
+	if x != nil {
+		if x, ok := x.Part.(*UploadRequest_Header); ok {
+			return x.Header
+		}
+	}
+	return nil
+}
+
+func (x *UploadRequest) GetChunk() []byte {
+	if x != nil {
+		if x, ok := x.Part.(*UploadRequest_Chunk); ok {
+			return x.Chunk
+		}
+	}
+	return nil
+}
+
+type isUploadRequest_Part interface {
+	isUploadRequest_Part()
+}
+
+type UploadRequest_Header struct {
+	Header *RecognizeRequest `protobuf:"bytes,1,opt,name=header,proto3,oneof"`
+}
+
+type UploadRequest_Chunk struct {
+	Chunk []byte `protobuf:"bytes,2,opt,name=chunk,proto3,oneof"`
+}
+
+func (*UploadRequest_Header) isUploadRequest_Part() {}
+
+func (*UploadRequest_Chunk) isUploadRequest_Part() {}
+
+type Word struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Text          string                 `protobuf:"bytes,1,opt,name=text,proto3" json:"text,omitempty"`
+	Confidence    float64                `protobuf:"fixed64,2,opt,name=confidence,proto3" json:"confidence,omitempty"`
+	Page          int32                  `protobuf:"varint,3,opt,name=page,proto3" json:"page,omitempty"`
+	Line          int32                  `protobuf:"varint,4,opt,name=line,proto3" json:"line,omitempty"`
+	Left          int32                  `protobuf:"varint,5,opt,name=left,proto3" json:"left,omitempty"`
+	Top           int32                  `protobuf:"varint,6,opt,name=top,proto3" json:"top,omitempty"`
+	Width         int32                  `protobuf:"varint,7,opt,name=width,proto3" json:"width,omitempty"`
+	Height        int32                  `protobuf:"varint,8,opt,name=height,proto3" json:"height,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Word) Reset() {
+	*x = Word{}
+	mi := &file_ocrpb_ocr_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Word) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Word) ProtoMessage() {}
+
+func (x *Word) ProtoReflect() protoreflect.Message {
+	mi := &file_ocrpb_ocr_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Word.ProtoReflect.Descriptor instead.
+func (*Word) Descriptor() ([]byte, []int) {
+	return file_ocrpb_ocr_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Word) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *Word) GetConfidence() float64 {
+	if x != nil {
+		return x.Confidence
+	}
+	return 0
+}
+
+func (x *Word) GetPage() int32 {
+	if x != nil {
+		return x.Page
+	}
+	return 0
+}
+
+func (x *Word) GetLine() int32 {
+	if x != nil {
+		return x.Line
+	}
+	return 0
+}
+
+func (x *Word) GetLeft() int32 {
+	if x != nil {
+		return x.Left
+	}
+	return 0
+}
+
+func (x *Word) GetTop() int32 {
+	if x != nil {
+		return x.Top
+	}
+	return 0
+}
+
+func (x *Word) GetWidth() int32 {
+	if x != nil {
+		return x.Width
+	}
+	return 0
+}
+
+func (x *Word) GetHeight() int32 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+type Recognition struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Set when the document was stored.
+	DocumentId    string   `protobuf:"bytes,1,opt,name=document_id,json=documentId,proto3" json:"document_id,omitempty"`
+	Filename      string   `protobuf:"bytes,2,opt,name=filename,proto3" json:"filename,omitempty"`
+	Text          string   `protobuf:"bytes,3,opt,name=text,proto3" json:"text,omitempty"`
+	Words         []*Word  `protobuf:"bytes,4,rep,name=words,proto3" json:"words,omitempty"`
+	Confidence    float64  `protobuf:"fixed64,5,opt,name=confidence,proto3" json:"confidence,omitempty"`
+	Options       *Options `protobuf:"bytes,6,opt,name=options,proto3" json:"options,omitempty"`
+	EngineVersion string   `protobuf:"bytes,7,opt,name=engine_version,json=engineVersion,proto3" json:"engine_version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Recognition) Reset() {
+	*x = Recognition{}
+	mi := &file_ocrpb_ocr_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Recognition) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Recognition) ProtoMessage() {}
+
+func (x *Recognition) ProtoReflect() protoreflect.Message {
+	mi := &file_ocrpb_ocr_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Recognition.ProtoReflect.Descriptor instead.
+func (*Recognition) Descriptor() ([]byte, []int) {
+	return file_ocrpb_ocr_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Recognition) GetDocumentId() string {
+	if x != nil {
+		return x.DocumentId
+	}
+	return ""
+}
+
+func (x *Recognition) GetFilename() string {
+	if x != nil {
+		return x.Filename
+	}
+	return ""
+}
+
+func (x *Recognition) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *Recognition) GetWords() []*Word {
+	if x != nil {
+		return x.Words
+	}
+	return nil
+}
+
+func (x *Recognition) GetConfidence() float64 {
+	if x != nil {
+		return x.Confidence
+	}
+	return 0
+}
+
+func (x *Recognition) GetOptions() *Options {
+	if x != nil {
+		return x.Options
+	}
+	return nil
+}
+
+func (x *Recognition) GetEngineVersion() string {
+	if x != nil {
+		return x.EngineVersion
+	}
+	return ""
+}
+
+type PageResult struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Page       int32                  `protobuf:"varint,1,opt,name=page,proto3" json:"page,omitempty"`
+	PageCount  int32                  `protobuf:"varint,2,opt,name=page_count,json=pageCount,proto3" json:"page_count,omitempty"`
+	Text       string                 `protobuf:"bytes,3,opt,name=text,proto3" json:"text,omitempty"`
+	Words      []*Word                `protobuf:"bytes,4,rep,name=words,proto3" json:"words,omitempty"`
+	Confidence float64                `protobuf:"fixed64,5,opt,name=confidence,proto3" json:"confidence,omitempty"`
+	// Set on every page when the document was stored.
+	DocumentId    string `protobuf:"bytes,6,opt,name=document_id,json=documentId,proto3" json:"document_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PageResult) Reset() {
+	*x = PageResult{}
+	mi := &file_ocrpb_ocr_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PageResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PageResult) ProtoMessage() {}
+
+func (x *PageResult) ProtoReflect() protoreflect.Message {
+	mi := &file_ocrpb_ocr_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PageResult.ProtoReflect.Descriptor instead.
+func (*PageResult) Descriptor() ([]byte, []int) {
+	return file_ocrpb_ocr_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *PageResult) GetPage() int32 {
+	if x != nil {
+		return x.Page
+	}
+	return 0
+}
+
+func (x *PageResult) GetPageCount() int32 {
+	if x != nil {
+		return x.PageCount
+	}
+	return 0
+}
+
+func (x *PageResult) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *PageResult) GetWords() []*Word {
+	if x != nil {
+		return x.Words
+	}
+	return nil
+}
+
+func (x *PageResult) GetConfidence() float64 {
+	if x != nil {
+		return x.Confidence
+	}
+	return 0
+}
+
+func (x *PageResult) GetDocumentId() string {
+	if x != nil {
+		return x.DocumentId
+	}
+	return ""
+}
+
+type ListLanguagesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListLanguagesRequest) Reset() {
+	*x = ListLanguagesRequest{}
+	mi := &file_ocrpb_ocr_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListLanguagesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListLanguagesRequest) ProtoMessage() {}
+
+func (x *ListLanguagesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ocrpb_ocr_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListLanguagesRequest.ProtoReflect.Descriptor instead.
+func (*ListLanguagesRequest) Descriptor() ([]byte, []int) {
+	return file_ocrpb_ocr_proto_rawDescGZIP(), []int{6}
+}
+
+type ListLanguagesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Languages     []string               `protobuf:"bytes,1,rep,name=languages,proto3" json:"languages,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListLanguagesResponse) Reset() {
+	*x = ListLanguagesResponse{}
+	mi := &file_ocrpb_ocr_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListLanguagesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListLanguagesResponse) ProtoMessage() {}
+
+func (x *ListLanguagesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ocrpb_ocr_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListLanguagesResponse.ProtoReflect.Descriptor instead.
+func (*ListLanguagesResponse) Descriptor() ([]byte, []int) {
+	return file_ocrpb_ocr_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ListLanguagesResponse) GetLanguages() []string {
+	if x != nil {
+		return x.Languages
+	}
+	return nil
+}
+
+var File_ocrpb_ocr_proto protoreflect.FileDescriptor
+
+const file_ocrpb_ocr_proto_rawDesc = "" +
+	"\n" +
+	"\x0focrpb/ocr.proto\x12\x06ocr.v1\x1a\x1cgoogle/protobuf/struct.proto\"W\n" +
+	"\aOptions\x12\x1a\n" +
+	"\blanguage\x18\x01 \x01(\tR\blanguage\x12\x10\n" +
+	"\x03psm\x18\x02 \x01(\x05R\x03psm\x12\x1e\n" +
+	"\n" +
+	"preprocess\x18\x03 \x01(\tR\n" +
+	"preprocess\"\x9d\x02\n" +
+	"\x10RecognizeRequest\x12\x16\n" +
+	"\x05image\x18\x01 \x01(\fH\x00R\x05image\x12\x12\n" +
+	"\x03url\x18\x02 \x01(\tH\x00R\x03url\x12\x1a\n" +
+	"\bfilename\x18\x03 \x01(\tR\bfilename\x12)\n" +
+	"\aoptions\x18\x04 \x01(\v2\x0f.ocr.v1.OptionsR\aoptions\x12\x1e\n" +
+	"\n" +
+	"collection\x18\x05 \x01(\tR\n" +
+	"collection\x12\x12\n" +
+	"\x04tags\x18\x06 \x03(\tR\x04tags\x123\n" +
+	"\bmetadata\x18\a \x01(\v2\x17.google.protobuf.StructR\bmetadata\x12\x19\n" +
+	"\x05store\x18\b \x01(\bH\x01R\x05store\x88\x01\x01B\b\n" +
+	"\x06sourceB\b\n" +
+	"\x06_store\"c\n" +
+	"\rUploadRequest\x122\n" +
+	"\x06header\x18\x01 \x01(\v2\x18.ocr.v1.RecognizeRequestH\x00R\x06header\x12\x16\n" +
+	"\x05chunk\x18\x02 \x01(\fH\x00R\x05chunkB\x06\n" +
+	"\x04part\"\xb6\x01\n" +
+	"\x04Word\x12\x12\n" +
+	"\x04text\x18\x01 \x01(\tR\x04text\x12\x1e\n" +
+	"\n" +
+	"confidence\x18\x02 \x01(\x01R\n" +
+	"confidence\x12\x12\n" +
+	"\x04page\x18\x03 \x01(\x05R\x04page\x12\x12\n" +
+	"\x04line\x18\x04 \x01(\x05R\x04line\x12\x12\n" +
+	"\x04left\x18\x05 \x01(\x05R\x04left\x12\x10\n" +
+	"\x03top\x18\x06 \x01(\x05R\x03top\x12\x14\n" +
+	"\x05width\x18\a \x01(\x05R\x05width\x12\x16\n" +
+	"\x06height\x18\b \x01(\x05R\x06height\"\xf4\x01\n" +
+	"\vRecognition\x12\x1f\n" +
+	"\vdocument_id\x18\x01 \x01(\tR\n" +
+	"documentId\x12\x1a\n" +
+	"\bfilename\x18\x02 \x01(\tR\bfilename\x12\x12\n" +
+	"\x04text\x18\x03 \x01(\tR\x04text\x12\"\n" +
+	"\x05words\x18\x04 \x03(\v2\f.ocr.v1.WordR\x05words\x12\x1e\n" +
+	"\n" +
+	"confidence\x18\x05 \x01(\x01R\n" +
+	"confidence\x12)\n" +
+	"\aoptions\x18\x06 \x01(\v2\x0f.ocr.v1.OptionsR\aoptions\x12%\n" +
+	"\x0eengine_version\x18\a \x01(\tR\rengineVersion\"\xb8\x01\n" +
+	"\n" +
+	"PageResult\x12\x12\n" +
+	"\x04page\x18\x01 \x01(\x05R\x04page\x12\x1d\n" +
+	"\n" +
+	"page_count\x18\x02 \x01(\x05R\tpageCount\x12\x12\n" +
+	"\x04text\x18\x03 \x01(\tR\x04text\x12\"\n" +
+	"\x05words\x18\x04 \x03(\v2\f.ocr.v1.WordR\x05words\x12\x1e\n" +
+	"\n" +
+	"confidence\x18\x05 \x01(\x01R\n" +
+	"confidence\x12\x1f\n" +
+	"\vdocument_id\x18\x06 \x01(\tR\n" +
+	"documentId\"\x16\n" +
+	"\x14ListLanguagesRequest\"5\n" +
+	"\x15ListLanguagesResponse\x12\x1c\n" +
+	"\tlanguages\x18\x01 \x03(\tR\tlanguages2\x89\x02\n" +
+	"\x03OCR\x12:\n" +
+	"\tRecognize\x12\x18.ocr.v1.RecognizeRequest\x1a\x13.ocr.v1.Recognition\x126\n" +
+	"\x06Upload\x12\x15.ocr.v1.UploadRequest\x1a\x13.ocr.v1.Recognition(\x01\x12@\n" +
+	"\x0eRecognizePages\x12\x18.ocr.v1.RecognizeRequest\x1a\x12.ocr.v1.PageResult0\x01\x12L\n" +
+	"\rListLanguages\x12\x1c.ocr.v1.ListLanguagesRequest\x1a\x1d.ocr.v1.ListLanguagesResponseB\x18Z\x16ocr-simple/ocrpb;ocrpbb\x06proto3"
+
+var (
+	file_ocrpb_ocr_proto_rawDescOnce sync.Once
+	file_ocrpb_ocr_proto_rawDescData []byte
+)
+
+func file_ocrpb_ocr_proto_rawDescGZIP() []byte {
+	file_ocrpb_ocr_proto_rawDescOnce.Do(func() {
+		file_ocrpb_ocr_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_ocrpb_ocr_proto_rawDesc), len(file_ocrpb_ocr_proto_rawDesc)))
+	})
+	return file_ocrpb_ocr_proto_rawDescData
+}
+
+var file_ocrpb_ocr_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_ocrpb_ocr_proto_goTypes = []any{
+	(*Options)(nil),               // 0: ocr.v1.Options
+	(*RecognizeRequest)(nil),      // 1: ocr.v1.RecognizeRequest
+	(*UploadRequest)(nil),         // 2: ocr.v1.UploadRequest
+	(*Word)(nil),                  // 3: ocr.v1.Word
+	(*Recognition)(nil),           // 4: ocr.v1.Recognition
+	(*PageResult)(nil),            // 5: ocr.v1.PageResult
+	(*ListLanguagesRequest)(nil),  // 6: ocr.v1.ListLanguagesRequest
+	(*ListLanguagesResponse)(nil), // 7: ocr.v1.ListLanguagesResponse
+	(*structpb.Struct)(nil),       // 8: google.protobuf.Struct
+}
+var file_ocrpb_ocr_proto_depIdxs = []int32{
+	0,  // 0: ocr.v1.RecognizeRequest.options:type_name -> ocr.v1.Options
+	8,  // 1: ocr.v1.RecognizeRequest.metadata:type_name -> google.protobuf.Struct
+	1,  // 2: ocr.v1.UploadRequest.header:type_name -> ocr.v1.RecognizeRequest
+	3,  // 3: ocr.v1.Recognition.words:type_name -> ocr.v1.Word
+	0,  // 4: ocr.v1.Recognition.options:type_name -> ocr.v1.Options
+	3,  // 5: ocr.v1.PageResult.words:type_name -> ocr.v1.Word
+	1,  // 6: ocr.v1.OCR.Recognize:input_type -> ocr.v1.RecognizeRequest
+	2,  // 7: ocr.v1.OCR.Upload:input_type -> ocr.v1.UploadRequest
+	1,  // 8: ocr.v1.OCR.RecognizePages:input_type -> ocr.v1.RecognizeRequest
+	6,  // 9: ocr.v1.OCR.ListLanguages:input_type -> ocr.v1.ListLanguagesRequest
+	4,  // 10: ocr.v1.OCR.Recognize:output_type -> ocr.v1.Recognition
+	4,  // 11: ocr.v1.OCR.Upload:output_type -> ocr.v1.Recognition
+	5,  // 12: ocr.v1.OCR.RecognizePages:output_type -> ocr.v1.PageResult
+	7,  // 13: ocr.v1.OCR.ListLanguages:output_type -> ocr.v1.ListLanguagesResponse
+	10, // [10:14] is the sub-list for method output_type
+	6,  // [6:10] is the sub-list for method input_type
+	6,  // [6:6] is the sub-list for extension type_name
+	6,  // [6:6] is the sub-list for extension extendee
+	0,  // [0:6] is the sub-list for field type_name
+}
+
+func init() { file_ocrpb_ocr_proto_init() }
+func file_ocrpb_ocr_proto_init() {
+	if File_ocrpb_ocr_proto != nil {
+		return
+	}
+	file_ocrpb_ocr_proto_msgTypes[1].OneofWrappers = []any{
+		(*RecognizeRequest_Image)(nil),
+		(*RecognizeRequest_Url)(nil),
+	}
+	file_ocrpb_ocr_proto_msgTypes[2].OneofWrappers = []any{
+		(*UploadRequest_Header)(nil),
+		(*UploadRequest_Chunk)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_ocrpb_ocr_proto_rawDesc), len(file_ocrpb_ocr_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   8,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_ocrpb_ocr_proto_goTypes,
+		DependencyIndexes: file_ocrpb_ocr_proto_depIdxs,
+		MessageInfos:      file_ocrpb_ocr_proto_msgTypes,
+	}.Build()
+	File_ocrpb_ocr_proto = out.File
+	file_ocrpb_ocr_proto_goTypes = nil
+	file_ocrpb_ocr_proto_depIdxs = nil
+}
@@ -0,0 +1,251 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: ocrpb/ocr.proto
+
+// gRPC interface of OCR Simple. It mirrors the REST API v1 (/api/v1): the
+// same options, limits and error codes, served by the same worker pool.
+
+package ocrpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	OCR_Recognize_FullMethodName      = "/ocr.v1.OCR/Recognize"
+	OCR_Upload_FullMethodName         = "/ocr.v1.OCR/Upload"
+	OCR_RecognizePages_FullMethodName = "/ocr.v1.OCR/RecognizePages"
+	OCR_ListLanguages_FullMethodName  = "/ocr.v1.OCR/ListLanguages"
+)
+
+// OCRClient is the client API for OCR service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type OCRClient interface {
+	// Recognize runs OCR on one image and returns the whole result.
+	Recognize(ctx context.Context, in *RecognizeRequest, opts ...grpc.CallOption) (*Recognition, error)
+	// Upload sends an image in chunks: the first message carries the request
+	// without image content, the following ones the image bytes in order.
+	Upload(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UploadRequest, Recognition], error)
+	// RecognizePages runs OCR and returns the result as one message per page,
+	// which suits multi-page TIFF files. Tesseract reads the whole file in one
+	// run, so the pages are sent together once recognition has finished, not
+	// as each page is done.
+	RecognizePages(ctx context.Context, in *RecognizeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[PageResult], error)
+	// ListLanguages returns the installed Tesseract languages.
+	ListLanguages(ctx context.Context, in *ListLanguagesRequest, opts ...grpc.CallOption) (*ListLanguagesResponse, error)
+}
+
+type oCRClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewOCRClient(cc grpc.ClientConnInterface) OCRClient {
+	return &oCRClient{cc}
+}
+
+func (c *oCRClient) Recognize(ctx context.Context, in *RecognizeRequest, opts ...grpc.CallOption) (*Recognition, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Recognition)
+	err := c.cc.Invoke(ctx, OCR_Recognize_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *oCRClient) Upload(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UploadRequest, Recognition], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &OCR_ServiceDesc.Streams[0], OCR_Upload_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[UploadRequest, Recognition]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type OCR_UploadClient = grpc.ClientStreamingClient[UploadRequest, Recognition]
+
+func (c *oCRClient) RecognizePages(ctx context.Context, in *RecognizeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[PageResult], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &OCR_ServiceDesc.Streams[1], OCR_RecognizePages_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[RecognizeRequest, PageResult]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type OCR_RecognizePagesClient = grpc.ServerStreamingClient[PageResult]
+
+func (c *oCRClient) ListLanguages(ctx context.Context, in *ListLanguagesRequest, opts ...grpc.CallOption) (*ListLanguagesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListLanguagesResponse)
+	err := c.cc.Invoke(ctx, OCR_ListLanguages_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// OCRServer is the server API for OCR service.
+// All implementations must embed UnimplementedOCRServer
+// for forward compatibility.
+type OCRServer interface {
+	// Recognize runs OCR on one image and returns the whole result.
+	Recognize(context.Context, *RecognizeRequest) (*Recognition, error)
+	// Upload sends an image in chunks: the first message carries the request
+	// without image content, the following ones the image bytes in order.
+	Upload(grpc.ClientStreamingServer[UploadRequest, Recognition]) error
+	// RecognizePages runs OCR and returns the result as one message per page,
+	// which suits multi-page TIFF files. Tesseract reads the whole file in one
+	// run, so the pages are sent together once recognition has finished, not
+	// as each page is done.
+	RecognizePages(*RecognizeRequest, grpc.ServerStreamingServer[PageResult]) error
+	// ListLanguages returns the installed Tesseract languages.
+	ListLanguages(context.Context, *ListLanguagesRequest) (*ListLanguagesResponse, error)
+	mustEmbedUnimplementedOCRServer()
+}
+
+// UnimplementedOCRServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedOCRServer struct{}
+
+func (UnimplementedOCRServer) Recognize(context.Context, *RecognizeRequest) (*Recognition, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Recognize not implemented")
+}
+func (UnimplementedOCRServer) Upload(grpc.ClientStreamingServer[UploadRequest, Recognition]) error {
+	return status.Errorf(codes.Unimplemented, "method Upload not implemented")
+}
+func (UnimplementedOCRServer) RecognizePages(*RecognizeRequest, grpc.ServerStreamingServer[PageResult]) error {
+	return status.Errorf(codes.Unimplemented, "method RecognizePages not implemented")
+}
+func (UnimplementedOCRServer) ListLanguages(context.Context, *ListLanguagesRequest) (*ListLanguagesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListLanguages not implemented")
+}
+func (UnimplementedOCRServer) mustEmbedUnimplementedOCRServer() {}
+func (UnimplementedOCRServer) testEmbeddedByValue()             {}
+
+// UnsafeOCRServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to OCRServer will
+// result in compilation errors.
+type UnsafeOCRServer interface {
+	mustEmbedUnimplementedOCRServer()
+}
+
+func RegisterOCRServer(s grpc.ServiceRegistrar, srv OCRServer) {
+	// If the following call pancis, it indicates UnimplementedOCRServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&OCR_ServiceDesc, srv)
+}
+
+func _OCR_Recognize_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RecognizeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OCRServer).Recognize(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OCR_Recognize_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OCRServer).Recognize(ctx, req.(*RecognizeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OCR_Upload_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(OCRServer).Upload(&grpc.GenericServerStream[UploadRequest, Recognition]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type OCR_UploadServer = grpc.ClientStreamingServer[UploadRequest, Recognition]
+
+func _OCR_RecognizePages_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(RecognizeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(OCRServer).RecognizePages(m, &grpc.GenericServerStream[RecognizeRequest, PageResult]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type OCR_RecognizePagesServer = grpc.ServerStreamingServer[PageResult]
+
+func _OCR_ListLanguages_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListLanguagesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OCRServer).ListLanguages(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OCR_ListLanguages_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OCRServer).ListLanguages(ctx, req.(*ListLanguagesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// OCR_ServiceDesc is the grpc.ServiceDesc for OCR service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var OCR_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ocr.v1.OCR",
+	HandlerType: (*OCRServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Recognize",
+			Handler:    _OCR_Recognize_Handler,
+		},
+		{
+			MethodName: "ListLanguages",
+			Handler:    _OCR_ListLanguages_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Upload",
+			Handler:       _OCR_Upload_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "RecognizePages",
+			Handler:       _OCR_RecognizePages_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "ocrpb/ocr.proto",
+}
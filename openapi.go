@@ -0,0 +1,500 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+// The subset of OpenAPI 3 that requests are validated against
+type openAPIDocument struct {
+	Paths      map[string]openAPIPathItem `json:"paths"`
+	Components struct {
+		Schemas    map[string]*openAPISchema   `json:"schemas"`
+		Parameters map[string]openAPIParameter `json:"parameters"`
+	} `json:"components"`
+}
+
+type openAPIPathItem struct {
+	Get    *openAPIOperation `json:"get"`
+	Post   *openAPIOperation `json:"post"`
+	Put    *openAPIOperation `json:"put"`
+	Patch  *openAPIOperation `json:"patch"`
+	Delete *openAPIOperation `json:"delete"`
+}
+
+type openAPIOperation struct {
+	OperationID string             `json:"operationId"`
+	Parameters  []openAPIParameter `json:"parameters"`
+	RequestBody *struct {
+		Required bool `json:"required"`
+		Content  map[string]struct {
+			Schema *openAPISchema `json:"schema"`
+		} `json:"content"`
+	} `json:"requestBody"`
+}
+
+type openAPIParameter struct {
+	Ref      string         `json:"$ref"`
+	Name     string         `json:"name"`
+	In       string         `json:"in"`
+	Required bool           `json:"required"`
+	Schema   *openAPISchema `json:"schema"`
+}
+
+type openAPISchema struct {
+	Ref        string                    `json:"$ref"`
+	Type       string                    `json:"type"`
+	Format     string                    `json:"format"`
+	Enum       []interface{}             `json:"enum"`
+	Pattern    string                    `json:"pattern"`
+	MaxLength  *int                      `json:"maxLength"`
+	Minimum    *float64                  `json:"minimum"`
+	Maximum    *float64                  `json:"maximum"`
+	Required   []string                  `json:"required"`
+	Properties map[string]*openAPISchema `json:"properties"`
+	Items      *openAPISchema            `json:"items"`
+
+	pattern *regexp.Regexp
+}
+
+// apiSpec is the parsed openapi.json, loaded once at startup
+var apiSpec = mustLoadOpenAPI(openAPISpec)
+
+func mustLoadOpenAPI(data []byte) *openAPIDocument {
+	var doc openAPIDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		fatal("invalid openapi.json", "err", err)
+	}
+	for name, schema := range doc.Components.Schemas {
+		if err := doc.compile(schema); err != nil {
+			fatal("invalid openapi.json schema", "schema", name, "err", err)
+		}
+	}
+	for path, item := range doc.Paths {
+		for _, op := range item.operations() {
+			for i, p := range op.Parameters {
+				if p.Ref != "" {
+					shared, ok := doc.Components.Parameters[strings.TrimPrefix(p.Ref, "#/components/parameters/")]
+					if !ok {
+						fatal("unknown reference in openapi.json", "path", path, "ref", p.Ref)
+					}
+					op.Parameters[i] = shared
+					p = shared
+				}
+				if err := doc.compile(p.Schema); err != nil {
+					fatal("invalid openapi.json parameter", "path", path, "parameter", p.Name, "err", err)
+				}
+			}
+			if op.RequestBody != nil {
+				for _, content := range op.RequestBody.Content {
+					if err := doc.compile(content.Schema); err != nil {
+						fatal("invalid openapi.json request body", "path", path, "err", err)
+					}
+				}
+			}
+		}
+	}
+	return &doc
+}
+
+// compile checks references and precompiles patterns
+func (d *openAPIDocument) compile(s *openAPISchema) error {
+	if s == nil {
+		return nil
+	}
+	if s.Ref != "" {
+		if d.resolve(s) == s {
+			return fmt.Errorf("unknown reference %s", s.Ref)
+		}
+		return nil
+	}
+	if s.Pattern != "" && s.pattern == nil {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return err
+		}
+		s.pattern = re
+	}
+	for _, prop := range s.Properties {
+		if err := d.compile(prop); err != nil {
+			return err
+		}
+	}
+	return d.compile(s.Items)
+}
+
+// resolve follows a #/components/schemas/ reference
+func (d *openAPIDocument) resolve(s *openAPISchema) *openAPISchema {
+	if s == nil || s.Ref == "" {
+		return s
+	}
+	if target, ok := d.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]; ok {
+		return target
+	}
+	return s
+}
+
+func (p openAPIPathItem) operations() []*openAPIOperation {
+	var ops []*openAPIOperation
+	for _, op := range []*openAPIOperation{p.Get, p.Post, p.Put, p.Patch, p.Delete} {
+		if op != nil {
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
+
+// operation returns the operation documented for a method and path template
+func (d *openAPIDocument) operation(method, path string) *openAPIOperation {
+	item, ok := d.Paths[path]
+	if !ok {
+		return nil
+	}
+	switch method {
+	case http.MethodGet:
+		return item.Get
+	case http.MethodPost:
+		return item.Post
+	case http.MethodPut:
+		return item.Put
+	case http.MethodPatch:
+		return item.Patch
+	case http.MethodDelete:
+		return item.Delete
+	}
+	return nil
+}
+
+// handleAPI registers a v1 route whose requests are validated against the
+// operation documented for the same method and path. Routes missing from
+// the document are a programming error and stop the server.
+func handleAPI(pattern string, handler http.HandlerFunc) {
+	method, path, _ := strings.Cut(pattern, " ")
+	op := apiSpec.operation(method, path)
+	if op == nil {
+		fatal("route is not documented in openapi.json", "route", pattern)
+	}
+
+	http.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxUploadBodySize())
+		if err := apiSpec.validateRequest(op, r); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		handler(w, r)
+	})
+}
+
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write(openAPISpec)
+}
+
+// validateRequest checks the parameters and body of r against op. Form
+// bodies are parsed here, so handlers can read r.FormValue afterwards.
+func (d *openAPIDocument) validateRequest(op *openAPIOperation, r *http.Request) *APIError {
+	errs := d.validateParameters(op, r)
+	if op.RequestBody != nil {
+		bodyErrs, err := d.validateBody(op, r)
+		if err != nil {
+			return err
+		}
+		errs = append(errs, bodyErrs...)
+	}
+	if len(errs) > 0 {
+		err := newAPIError(CodeInvalidRequest, "Request does not match the API specification")
+		err.Details = errs
+		return err
+	}
+	return nil
+}
+
+func (d *openAPIDocument) validateParameters(op *openAPIOperation, r *http.Request) []FieldError {
+	var errs []FieldError
+
+	for _, p := range op.Parameters {
+		var raw string
+		var present bool
+		switch p.In {
+		case "path":
+			raw = r.PathValue(p.Name)
+			present = raw != ""
+		case "query":
+			raw = r.URL.Query().Get(p.Name)
+			present = r.URL.Query().Has(p.Name)
+		case "header":
+			raw = r.Header.Get(p.Name)
+			present = raw != ""
+		default:
+			continue
+		}
+		if !present {
+			if p.Required {
+				errs = append(errs, FieldError{Field: p.Name, Message: "is required"})
+			}
+			continue
+		}
+		schema := d.resolve(p.Schema)
+		value, err := coerceParameter(schema, raw)
+		if err != nil {
+			errs = append(errs, FieldError{Field: p.Name, Message: err.Error()})
+			continue
+		}
+		errs = append(errs, d.validateValue(schema, value, p.Name)...)
+	}
+	return errs
+}
+
+// validateBody checks the request body. Problems that make the body
+// unreadable are returned as an error rather than field errors.
+func (d *openAPIDocument) validateBody(op *openAPIOperation, r *http.Request) ([]FieldError, *APIError) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	content, ok := op.RequestBody.Content[mediaType]
+	if !ok {
+		// Media ranges such as image/*
+		major, _, _ := strings.Cut(mediaType, "/")
+		content, ok = op.RequestBody.Content[major+"/*"]
+	}
+	if !ok {
+		if r.ContentLength == 0 && !op.RequestBody.Required {
+			return nil, nil
+		}
+		return nil, newAPIError(CodeUnsupportedMedia, "Unsupported content type %q, expected %s", mediaType, strings.Join(contentTypes(op), " or "))
+	}
+	schema := d.resolve(content.Schema)
+
+	switch mediaType {
+	case "application/json":
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, bodyReadError(err)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(data))
+		if len(bytes.TrimSpace(data)) == 0 {
+			if op.RequestBody.Required {
+				return []FieldError{{Field: "body", Message: "is required"}}, nil
+			}
+			return nil, nil
+		}
+		var value interface{}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&value); err != nil {
+			return nil, invalidField("body", "Invalid JSON body: %v", err)
+		}
+		return d.validateValue(schema, value, ""), nil
+
+	case "multipart/form-data", "application/x-www-form-urlencoded":
+		var err error
+		if mediaType == "multipart/form-data" {
+			err = r.ParseMultipartForm(int64(config.MultipartMemory))
+		} else {
+			err = r.ParseForm()
+		}
+		if err != nil {
+			return nil, bodyReadError(err)
+		}
+		return d.validateForm(schema, r), nil
+	}
+	return nil, nil
+}
+
+// bodyReadError reports a body that could not be read or parsed
+func bodyReadError(err error) *APIError {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return newAPIError(CodePayloadTooLarge, "Request body must be at most %d bytes", tooLarge.Limit)
+	}
+	return invalidField("body", "Invalid request body: %v", err)
+}
+
+// validateForm validates form fields, which are all strings on the wire,
+// against the properties of an object schema
+func (d *openAPIDocument) validateForm(schema *openAPISchema, r *http.Request) []FieldError {
+	var errs []FieldError
+	required := map[string]bool{}
+	for _, name := range schema.Required {
+		required[name] = true
+	}
+
+	for _, name := range sortedKeys(schema.Properties) {
+		prop := d.resolve(schema.Properties[name])
+		if prop.Format == "binary" {
+			if r.MultipartForm == nil || len(r.MultipartForm.File[name]) == 0 {
+				if required[name] {
+					errs = append(errs, FieldError{Field: name, Message: "file is required"})
+				}
+			}
+			continue
+		}
+
+		raw := r.FormValue(name)
+		if raw == "" {
+			if required[name] {
+				errs = append(errs, FieldError{Field: name, Message: "is required"})
+			}
+			continue
+		}
+		value, err := coerceParameter(prop, raw)
+		if err != nil {
+			errs = append(errs, FieldError{Field: name, Message: err.Error()})
+			continue
+		}
+		errs = append(errs, d.validateValue(prop, value, name)...)
+	}
+	return errs
+}
+
+var numberKinds = map[string]string{"integer": "an integer", "number": "a number"}
+
+// coerceParameter converts a string from a path, query or form field to the
+// JSON type its schema declares
+func coerceParameter(schema *openAPISchema, raw string) (interface{}, error) {
+	switch schema.Type {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(raw, 64); err != nil {
+			return nil, fmt.Errorf("must be %s", numberKinds[schema.Type])
+		}
+		return json.Number(raw), nil
+	case "boolean":
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("must be true or false")
+		}
+		return b, nil
+	}
+	return raw, nil
+}
+
+// validateValue checks a decoded JSON value against schema
+func (d *openAPIDocument) validateValue(schema *openAPISchema, value interface{}, field string) []FieldError {
+	schema = d.resolve(schema)
+	if schema == nil {
+		return nil
+	}
+	fail := func(format string, args ...interface{}) []FieldError {
+		name := field
+		if name == "" {
+			name = "body"
+		}
+		return []FieldError{{Field: name, Message: fmt.Sprintf(format, args...)}}
+	}
+
+	switch schema.Type {
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return fail("must be a string")
+		}
+		if schema.MaxLength != nil && len([]rune(s)) > *schema.MaxLength {
+			return fail("must be at most %d characters", *schema.MaxLength)
+		}
+		if schema.pattern != nil && !schema.pattern.MatchString(s) {
+			return fail("must match %s", schema.Pattern)
+		}
+
+	case "integer", "number":
+		n, ok := value.(json.Number)
+		if !ok {
+			return fail("must be %s", numberKinds[schema.Type])
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return fail("must be %s", numberKinds[schema.Type])
+		}
+		if schema.Type == "integer" {
+			if _, err := n.Int64(); err != nil {
+				return fail("must be an integer")
+			}
+		}
+		if schema.Minimum != nil && f < *schema.Minimum {
+			return fail("must be at least %v", *schema.Minimum)
+		}
+		if schema.Maximum != nil && f > *schema.Maximum {
+			return fail("must be at most %v", *schema.Maximum)
+		}
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fail("must be true or false")
+		}
+
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return fail("must be an array")
+		}
+		var errs []FieldError
+		for i, item := range items {
+			errs = append(errs, d.validateValue(schema.Items, item, fmt.Sprintf("%s[%d]", field, i))...)
+		}
+		return errs
+
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return fail("must be an object")
+		}
+		var errs []FieldError
+		for _, name := range schema.Required {
+			if _, ok := obj[name]; !ok {
+				errs = append(errs, FieldError{Field: joinField(field, name), Message: "is required"})
+			}
+		}
+		for _, name := range sortedKeys(schema.Properties) {
+			if v, ok := obj[name]; ok && v != nil {
+				errs = append(errs, d.validateValue(schema.Properties[name], v, joinField(field, name))...)
+			}
+		}
+		return errs
+	}
+
+	if len(schema.Enum) > 0 {
+		for _, allowed := range schema.Enum {
+			if fmt.Sprint(allowed) == fmt.Sprint(value) {
+				return nil
+			}
+		}
+		return fail("must be one of %v", schema.Enum)
+	}
+	return nil
+}
+
+func joinField(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+func contentTypes(op *openAPIOperation) []string {
+	var types []string
+	for t := range op.RequestBody.Content {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
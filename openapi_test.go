@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// validate runs the validation of the documented operation on a request
+func validate(t *testing.T, r *http.Request, pattern string) *APIError {
+	t.Helper()
+	method, path, _ := strings.Cut(pattern, " ")
+	op := apiSpec.operation(method, path)
+	if op == nil {
+		t.Fatalf("%s is not documented", pattern)
+	}
+	return apiSpec.validateRequest(op, r)
+}
+
+// errorFields lists the fields of a validation error, "" for success
+func errorFields(err *APIError) string {
+	if err == nil {
+		return ""
+	}
+	var fields []string
+	for _, d := range err.Details {
+		fields = append(fields, d.Field)
+	}
+	return err.Code + ":" + strings.Join(fields, ",")
+}
+
+func TestValidateRequestJSON(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`{"image":"aGVsbG8="}`, ""},
+		{`{"url":"https://example.com/a.png","language":"ind+eng","psm":6,"preprocess":"grayscale","tags":["a","b"],"metadata":{"x":1},"store":false}`, ""},
+		// null counts as absent
+		{`{"image":"aGVsbG8=","psm":null}`, ""},
+		{`{"psm":14}`, "invalid_request:psm"},
+		{`{"psm":-1}`, "invalid_request:psm"},
+		{`{"psm":6.5}`, "invalid_request:psm"},
+		{`{"psm":"6"}`, "invalid_request:psm"},
+		{`{"language":"eng;rm -rf"}`, "invalid_request:language"},
+		{`{"language":"` + strings.Repeat("a", 65) + `"}`, "invalid_request:language"},
+		{`{"preprocess":"sharpen"}`, "invalid_request:preprocess"},
+		{`{"url":"file:///etc/passwd"}`, "invalid_request:url"},
+		{`{"tags":["a",1,"b",{}]}`, "invalid_request:tags[1],tags[3]"},
+		{`{"tags":"a,b"}`, "invalid_request:tags"},
+		{`{"metadata":"{}"}`, "invalid_request:metadata"},
+		{`{"store":"yes"}`, "invalid_request:store"},
+		// Every problem is reported, in a stable order
+		{`{"psm":99,"preprocess":"x","language":"1"}`, "invalid_request:language,preprocess,psm"},
+		{`[]`, "invalid_request:body"},
+		{`"image"`, "invalid_request:body"},
+		{`{"image":`, "invalid_request:body"},
+		{``, "invalid_request:body"},
+		{"  \n", "invalid_request:body"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/recognize", strings.NewReader(tt.body))
+		r.Header.Set("Content-Type", "application/json; charset=utf-8")
+		if got := errorFields(validate(t, r, "POST /api/v1/recognize")); got != tt.want {
+			t.Errorf("body %s: %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestValidateRequestKeepsJSONBody(t *testing.T) {
+	body := `{"image":"aGVsbG8="}`
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/jobs", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	if err := validate(t, r, "POST /api/v1/jobs"); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	buf.ReadFrom(r.Body)
+	if buf.String() != body {
+		t.Errorf("handler reads %q, want %q", buf.String(), body)
+	}
+}
+
+func TestValidateRequestRawBody(t *testing.T) {
+	tests := []struct {
+		contentType string
+		query       string
+		want        string
+	}{
+		{"image/png", "", ""},
+		{"image/tiff", "?language=ind&psm=3&preprocess=threshold&store=false&tags=a,b&filename=scan.tif", ""},
+		{"image/png", "?psm=abc", "invalid_request:psm"},
+		{"image/png", "?psm=14", "invalid_request:psm"},
+		{"image/png", "?store=maybe", "invalid_request:store"},
+		{"image/png", "?preprocess=sharpen&language=ENG", "invalid_request:language,preprocess"},
+		{"image/png", "?filename=" + strings.Repeat("a", 256), "invalid_request:filename"},
+		{"text/plain", "", "unsupported_media:"},
+		{"", "", "unsupported_media:"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/recognize"+tt.query, bytes.NewReader(testPNG))
+		if tt.contentType != "" {
+			r.Header.Set("Content-Type", tt.contentType)
+		}
+		if got := errorFields(validate(t, r, "POST /api/v1/recognize")); got != tt.want {
+			t.Errorf("%s %s: %q, want %q", tt.contentType, tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestValidateRequestForm(t *testing.T) {
+	multipartBody := func(fields map[string]string) (*bytes.Buffer, string) {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		for _, name := range sortedKeys(fields) {
+			if name == "image" {
+				fw, _ := mw.CreateFormFile("image", "scan.png")
+				fw.Write(testPNG)
+				continue
+			}
+			mw.WriteField(name, fields[name])
+		}
+		mw.Close()
+		return &buf, mw.FormDataContentType()
+	}
+
+	tests := []struct {
+		fields map[string]string
+		want   string
+	}{
+		{map[string]string{"image": "", "psm": "6", "store": "false"}, ""},
+		// Empty form fields count as absent
+		{map[string]string{"image": "", "psm": "", "language": ""}, ""},
+		{map[string]string{"image": "", "psm": "20"}, "invalid_request:psm"},
+		{map[string]string{"image": "", "psm": "six", "store": "nope"}, "invalid_request:psm,store"},
+		{map[string]string{"url": "gopher://example.com"}, "invalid_request:url"},
+		{map[string]string{"collection": strings.Repeat("c", 65)}, "invalid_request:collection"},
+	}
+	for _, tt := range tests {
+		body, contentType := multipartBody(tt.fields)
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/recognize", body)
+		r.Header.Set("Content-Type", contentType)
+		got := errorFields(validate(t, r, "POST /api/v1/recognize"))
+		if got != tt.want {
+			t.Errorf("fields %v: %q, want %q", tt.fields, got, tt.want)
+		}
+		// The form is parsed for the handler
+		if got == "" && r.MultipartForm == nil {
+			t.Errorf("fields %v: form not parsed", tt.fields)
+		}
+	}
+}
+
+func TestValidateRequestPathParameter(t *testing.T) {
+	for id, want := range map[string]string{
+		"0123456789abcdef":   "",
+		"0123456789ABCDEF":   "invalid_request:id",
+		"0123":               "invalid_request:id",
+		"../../etc/passwd00": "invalid_request:id",
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/jobs/x", nil)
+		r.SetPathValue("id", id)
+		if got := errorFields(validate(t, r, "GET /api/v1/jobs/{id}")); got != want {
+			t.Errorf("id %q: %q, want %q", id, got, want)
+		}
+	}
+}
+
+func TestValidateRequestBodyTooLarge(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/recognize", strings.NewReader(`{"image":"`+strings.Repeat("A", 4096)+`"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Body = http.MaxBytesReader(w, r.Body, 1024)
+	if got := errorFields(validate(t, r, "POST /api/v1/recognize")); got != "payload_too_large:" {
+		t.Errorf("%q, want payload_too_large", got)
+	}
+}
+
+func TestValidateValueMessages(t *testing.T) {
+	lo, hi, length := 1.0, 5.0, 3
+	doc := &openAPIDocument{}
+	schema := &openAPISchema{Type: "object", Required: []string{"n", "s"}, Properties: map[string]*openAPISchema{
+		"n": {Type: "integer", Minimum: &lo, Maximum: &hi},
+		"s": {Type: "string", MaxLength: &length},
+	}}
+	got := doc.validateValue(schema, map[string]interface{}{"s": "ñandú"}, "options")
+	want := []FieldError{
+		{Field: "options.n", Message: "is required"},
+		{Field: "options.s", Message: "must be at most 3 characters"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("errors = %+v, want %+v", got, want)
+	}
+}
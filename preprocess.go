@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+)
+
+// Image preprocessing modes applied before Tesseract runs
+const (
+	PreprocessNone      = ""
+	PreprocessGrayscale = "grayscale"
+	PreprocessThreshold = "threshold"
+)
+
+// preprocessImage converts the image according to mode and returns it as PNG.
+// Grayscale removes colour noise; threshold additionally binarises the image
+// with Otsu's method, which helps with faded scans and coloured backgrounds.
+func preprocessImage(imageBytes []byte, mode string) ([]byte, error) {
+	src, _, err := image.Decode(bytes.NewReader(imageBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := src.Bounds()
+	gray := image.NewGray(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			gray.Set(x, y, src.At(x, y))
+		}
+	}
+
+	if mode == PreprocessThreshold {
+		level := otsuThreshold(gray)
+		for i, v := range gray.Pix {
+			if v > level {
+				gray.Pix[i] = 255
+			} else {
+				gray.Pix[i] = 0
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, gray); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// otsuThreshold picks the grey level that best separates text from background
+func otsuThreshold(img *image.Gray) uint8 {
+	var histogram [256]int
+	for _, v := range img.Pix {
+		histogram[v]++
+	}
+
+	total := len(img.Pix)
+	sum := 0
+	for i, n := range histogram {
+		sum += i * n
+	}
+
+	var (
+		sumBackground    int
+		weightBackground int
+		best             float64
+		level            uint8
+	)
+	for i, n := range histogram {
+		weightBackground += n
+		if weightBackground == 0 {
+			continue
+		}
+		weightForeground := total - weightBackground
+		if weightForeground == 0 {
+			break
+		}
+		sumBackground += i * n
+		meanBackground := float64(sumBackground) / float64(weightBackground)
+		meanForeground := float64(sum-sumBackground) / float64(weightForeground)
+		between := float64(weightBackground) * float64(weightForeground) * (meanBackground - meanForeground) * (meanBackground - meanForeground)
+		if between > best {
+			best = between
+			level = uint8(i)
+		}
+	}
+	return level
+}
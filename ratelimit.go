@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+)
+
+// Buckets idle for this long are full again and can be forgotten
+const rateLimitSweepInterval = time.Minute
+
+// rateLimitRule is a token bucket: Burst requests at once, refilled at Rate
+// requests per second
+type rateLimitRule struct {
+	Rate  float64
+	Burst int
+}
+
+// Route groups with their default rules. Every OCR request occupies a slot
+// of ocrWorkerPool, ocr.queue_size of them (10 by default), so the defaults
+// keep a single client from holding the queue; with a different queue size,
+// adjust the upload burst in rate_limit to match.
+var rateLimitRules = map[string]*rateLimitRule{
+	"upload":    {Rate: 1, Burst: 10},      // /upload, recognize, jobs, gRPC OCR
+	"reprocess": {Rate: 1.0 / 6, Burst: 3}, // re-running OCR on stored documents
+}
+
+// rateLimitGroup returns the route group of a request, or "" when the
+// request is not rate limited
+func rateLimitGroup(r *http.Request) string {
+	if r.Method != http.MethodPost {
+		return ""
+	}
+	path := r.URL.Path
+	switch {
+	case path == "/upload" || path == "/api/v1/recognize" || path == "/api/v1/jobs":
+		return "upload"
+	case path == "/documents/reprocess" || path == "/api/reprocess" ||
+		(strings.HasPrefix(path, "/documents/") && strings.HasSuffix(path, "/rerun")) ||
+		(strings.HasPrefix(path, "/api/documents/") && strings.HasSuffix(path, "/versions")):
+		return "reprocess"
+	}
+	return ""
+}
+
+// parseRateLimits applies OCR_RATE_LIMIT, e.g. "upload=30/m:5;reprocess=off",
+// to the default rules: a rate per second, minute or hour and a burst. "off"
+// disables a group, or all groups when given alone.
+func parseRateLimits(value string) error {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+	if value == "off" {
+		for group := range rateLimitRules {
+			delete(rateLimitRules, group)
+		}
+		return nil
+	}
+
+	for _, entry := range splitList(value, ";") {
+		group, spec, ok := strings.Cut(entry, "=")
+		group = strings.TrimSpace(group)
+		if _, known := rateLimitRules[group]; !ok || !known {
+			return fmt.Errorf("OCR_RATE_LIMIT: expected upload|reprocess=RATE/UNIT:BURST, got %q", entry)
+		}
+		if spec = strings.TrimSpace(spec); spec == "off" {
+			delete(rateLimitRules, group)
+			continue
+		}
+
+		rate, burst, _ := strings.Cut(spec, ":")
+		count, unit, _ := strings.Cut(rate, "/")
+		n, err := strconv.ParseFloat(count, 64)
+		per := map[string]float64{"s": 1, "m": 60, "h": 3600}[unit]
+		if err != nil || n <= 0 || per == 0 {
+			return fmt.Errorf("OCR_RATE_LIMIT: invalid rate %q, use e.g. 30/m", rate)
+		}
+		rule := &rateLimitRule{Rate: n / per, Burst: int(math.Ceil(n))}
+		if burst != "" {
+			if rule.Burst, err = strconv.Atoi(burst); err != nil || rule.Burst < 1 {
+				return fmt.Errorf("OCR_RATE_LIMIT: invalid burst %q", burst)
+			}
+		}
+		rateLimitRules[group] = rule
+	}
+	return nil
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter keeps a token bucket per route group and client
+type RateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+var rateLimiter = &RateLimiter{buckets: make(map[string]*tokenBucket)}
+
+// rateLimitResult describes a bucket after a request took, or failed to
+// take, a token
+type rateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until the next token, when not allowed
+	Policy     string
+}
+
+// Allow takes a token from the bucket of client in group
+func (l *RateLimiter) Allow(group, client string, now time.Time) rateLimitResult {
+	rule := rateLimitRules[group]
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > rateLimitSweepInterval {
+		l.sweepLocked(now)
+	}
+
+	key := group + "|" + client
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(rule.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(rule.Burst), b.tokens+now.Sub(b.last).Seconds()*rule.Rate)
+	b.last = now
+
+	res := rateLimitResult{Limit: rule.Burst, Policy: fmt.Sprintf("%d;w=%d", rule.Burst, int(math.Ceil(float64(rule.Burst)/rule.Rate)))}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - b.tokens) / rule.Rate * float64(time.Second))
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = time.Duration((float64(rule.Burst) - b.tokens) / rule.Rate * float64(time.Second))
+	return res
+}
+
+// sweepLocked forgets buckets that have refilled completely
+func (l *RateLimiter) sweepLocked(now time.Time) {
+	for key, b := range l.buckets {
+		group, _, _ := strings.Cut(key, "|")
+		rule, ok := rateLimitRules[group]
+		if !ok || b.tokens+now.Sub(b.last).Seconds()*rule.Rate >= float64(rule.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// trustedProxies are the networks from OCR_TRUSTED_PROXIES, e.g.
+// "10.0.0.0/8,127.0.0.1", whose X-Forwarded-For and X-Real-IP headers are
+// believed
+var trustedProxies []netip.Prefix
+
+func parseTrustedProxies(value string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, entry := range splitList(value, ",") {
+		if p, err := netip.ParsePrefix(entry); err == nil {
+			prefixes = append(prefixes, p.Masked())
+		} else if a, err := netip.ParseAddr(entry); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(a, a.BitLen()))
+		} else {
+			slog.Warn("ignoring OCR_TRUSTED_PROXIES entry", "entry", entry)
+		}
+	}
+	return prefixes
+}
+
+func isTrustedProxy(addr netip.Addr) bool {
+	for _, p := range trustedProxies {
+		if p.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client. Behind a trusted proxy it is
+// the last X-Forwarded-For hop that is not a trusted proxy itself, so
+// clients cannot choose their own address by sending the header; when every
+// hop is trusted it is the left-most one. X-Real-IP is only read when there
+// is no X-Forwarded-For, since a proxy that appends to X-Forwarded-For may
+// pass on an X-Real-IP sent by the client.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !isTrustedProxy(addr) {
+		return host
+	}
+
+	forwarded := r.Header.Values("X-Forwarded-For")
+	if len(forwarded) == 0 {
+		if real, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+			return real.Unmap().String()
+		}
+		return host
+	}
+
+	hops := strings.Split(strings.Join(forwarded, ","), ",")
+	leftmost := host
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		if !isTrustedProxy(hop) {
+			return hop.Unmap().String()
+		}
+		leftmost = hop.Unmap().String()
+	}
+	return leftmost
+}
+
+// rateLimitClient keys buckets by API key, or by address for anonymous
+// requests
+func rateLimitClient(ctx context.Context, ip string) string {
+	if id := apiKeyIDFrom(ctx); id != "" {
+		return "key:" + id
+	}
+	return "ip:" + ip
+}
+
+// withRateLimit limits OCR requests per client with a token bucket per
+// route group and reports the bucket in RateLimit-* headers
+func withRateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		group := rateLimitGroup(r)
+		if _, ok := rateLimitRules[group]; !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		res := rateLimiter.Allow(group, rateLimitClient(r.Context(), clientIP(r)), time.Now())
+		h := w.Header()
+		h.Set("RateLimit-Policy", res.Policy)
+		h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+		h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		h.Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(res.Reset.Seconds()))))
+		if !res.Allowed {
+			apiErr := newAPIError(CodeRateLimited, "Too many requests, retry in %d seconds", int(math.Ceil(res.RetryAfter.Seconds())))
+			apiErr.retryAfter = res.RetryAfter
+			writeError(w, r, apiErr)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// grpcUnaryRateLimit and grpcStreamRateLimit apply the upload group to the
+// OCR methods; the peer address stands in for the client IP
+func grpcUnaryRateLimit(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := grpcRateLimit(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func grpcStreamRateLimit(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := grpcRateLimit(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+func grpcRateLimit(ctx context.Context, method string) error {
+	if _, ok := rateLimitRules["upload"]; !ok || !strings.HasPrefix(method, "/ocr.v1.OCR/") || method == "/ocr.v1.OCR/ListLanguages" {
+		return nil
+	}
+	var ip string
+	if p, ok := peer.FromContext(ctx); ok {
+		ip, _, _ = net.SplitHostPort(p.Addr.String())
+	}
+	res := rateLimiter.Allow("upload", rateLimitClient(ctx, ip), time.Now())
+	if !res.Allowed {
+		apiErr := newAPIError(CodeRateLimited, "Too many requests, retry in %d seconds", int(math.Ceil(res.RetryAfter.Seconds())))
+		apiErr.retryAfter = res.RetryAfter
+		return grpcError(ctx, apiErr)
+	}
+	return nil
+}
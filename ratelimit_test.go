@@ -0,0 +1,211 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// setRateLimitRules replaces the rules for the duration of a test
+func setRateLimitRules(t *testing.T, rules map[string]*rateLimitRule) {
+	t.Helper()
+	old := rateLimitRules
+	rateLimitRules = rules
+	t.Cleanup(func() { rateLimitRules = old })
+}
+
+func TestTokenBucket(t *testing.T) {
+	setRateLimitRules(t, map[string]*rateLimitRule{"upload": {Rate: 0.5, Burst: 3}})
+	l := &RateLimiter{buckets: make(map[string]*tokenBucket)}
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		after     time.Duration
+		client    string
+		allowed   bool
+		remaining int
+	}{
+		{0, "a", true, 2},
+		{0, "a", true, 1},
+		{0, "a", true, 0},
+		{0, "a", false, 0},
+		// Other clients have their own bucket
+		{0, "b", true, 2},
+		// One token every two seconds
+		{time.Second, "a", false, 0},
+		{2 * time.Second, "a", true, 0},
+		// A long pause refills up to the burst, not beyond
+		{time.Hour, "a", true, 2},
+	}
+	now := start
+	for i, s := range steps {
+		now = now.Add(s.after)
+		res := l.Allow("upload", s.client, now)
+		if res.Allowed != s.allowed || res.Remaining != s.remaining {
+			t.Fatalf("step %d: allowed %v with %d remaining, want %v with %d", i, res.Allowed, res.Remaining, s.allowed, s.remaining)
+		}
+		if res.Limit != 3 || res.Policy != "3;w=6" {
+			t.Fatalf("step %d: limit %d, policy %q", i, res.Limit, res.Policy)
+		}
+	}
+}
+
+func TestTokenBucketRetryAfter(t *testing.T) {
+	setRateLimitRules(t, map[string]*rateLimitRule{"upload": {Rate: 0.5, Burst: 1}})
+	l := &RateLimiter{buckets: make(map[string]*tokenBucket)}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	l.Allow("upload", "a", now)
+	res := l.Allow("upload", "a", now.Add(500*time.Millisecond))
+	if res.Allowed || res.RetryAfter != 1500*time.Millisecond || res.Reset != 1500*time.Millisecond {
+		t.Errorf("allowed %v, retry after %v, reset %v", res.Allowed, res.RetryAfter, res.Reset)
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	setRateLimitRules(t, map[string]*rateLimitRule{"upload": {Rate: 1, Burst: 5}, "reprocess": {Rate: 1.0 / 600, Burst: 5}})
+	l := &RateLimiter{buckets: make(map[string]*tokenBucket)}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	l.Allow("upload", "a", now)
+	l.Allow("reprocess", "a", now)
+	l.Allow("upload", "b", now.Add(2*rateLimitSweepInterval))
+	// upload|a refilled long ago, reprocess|a needs ten minutes per token
+	for key, want := range map[string]bool{"upload|a": false, "reprocess|a": true, "upload|b": true} {
+		if _, ok := l.buckets[key]; ok != want {
+			t.Errorf("bucket %s kept = %v, want %v", key, ok, want)
+		}
+	}
+}
+
+func TestParseRateLimits(t *testing.T) {
+	defaults := func() map[string]*rateLimitRule {
+		return map[string]*rateLimitRule{"upload": {Rate: 1, Burst: 10}, "reprocess": {Rate: 1.0 / 6, Burst: 3}}
+	}
+	tests := []struct {
+		value string
+		want  map[string]rateLimitRule
+		err   bool
+	}{
+		{"", map[string]rateLimitRule{"upload": {1, 10}, "reprocess": {1.0 / 6, 3}}, false},
+		{"upload=30/m", map[string]rateLimitRule{"upload": {0.5, 30}, "reprocess": {1.0 / 6, 3}}, false},
+		{"upload=2/s:5; reprocess=off", map[string]rateLimitRule{"upload": {2, 5}}, false},
+		{"upload=90/h:1", map[string]rateLimitRule{"upload": {0.025, 1}, "reprocess": {1.0 / 6, 3}}, false},
+		{"off", map[string]rateLimitRule{}, false},
+		{"download=1/s", nil, true},
+		{"upload", nil, true},
+		{"upload=30/d", nil, true},
+		{"upload=0/m", nil, true},
+		{"upload=x/m", nil, true},
+		{"upload=30/m:0", nil, true},
+	}
+	for _, tt := range tests {
+		setRateLimitRules(t, defaults())
+		err := parseRateLimits(tt.value)
+		if (err != nil) != tt.err {
+			t.Errorf("parseRateLimits(%q) error = %v", tt.value, err)
+			continue
+		}
+		if tt.err {
+			continue
+		}
+		if len(rateLimitRules) != len(tt.want) {
+			t.Errorf("parseRateLimits(%q) = %d groups, want %d", tt.value, len(rateLimitRules), len(tt.want))
+		}
+		for group, want := range tt.want {
+			if got, ok := rateLimitRules[group]; !ok || *got != want {
+				t.Errorf("parseRateLimits(%q) %s = %+v, want %+v", tt.value, group, got, want)
+			}
+		}
+	}
+}
+
+func TestRateLimitGroup(t *testing.T) {
+	tests := []struct {
+		method, path, group string
+	}{
+		{"POST", "/upload", "upload"},
+		{"POST", "/api/v1/recognize", "upload"},
+		{"POST", "/api/v1/jobs", "upload"},
+		{"GET", "/api/v1/jobs", ""},
+		{"POST", "/documents/reprocess", "reprocess"},
+		{"POST", "/documents/42/rerun", "reprocess"},
+		{"POST", "/api/documents/42/versions", "reprocess"},
+		{"GET", "/api/documents/42/versions", ""},
+		{"POST", "/api/search", ""},
+	}
+	for _, tt := range tests {
+		if got := rateLimitGroup(httptest.NewRequest(tt.method, tt.path, nil)); got != tt.group {
+			t.Errorf("%s %s: group %q, want %q", tt.method, tt.path, got, tt.group)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	old := trustedProxies
+	trustedProxies = parseTrustedProxies("10.0.0.0/8, 192.168.1.1, not-an-address")
+	t.Cleanup(func() { trustedProxies = old })
+
+	tests := []struct {
+		name     string
+		remote   string
+		forwards []string
+		realIP   string
+		want     string
+	}{
+		{"direct", "203.0.113.7:5000", nil, "", "203.0.113.7"},
+		{"untrusted peer sends headers", "203.0.113.7:5000", []string{"198.51.100.1"}, "198.51.100.2", "203.0.113.7"},
+		{"trusted proxy", "10.0.0.5:5000", []string{"198.51.100.1"}, "", "198.51.100.1"},
+		{"client prepends a fake hop", "10.0.0.5:5000", []string{"1.2.3.4, 198.51.100.1"}, "", "198.51.100.1"},
+		{"chain of trusted proxies", "10.0.0.5:5000", []string{"198.51.100.1, 192.168.1.1, 10.0.0.9"}, "", "198.51.100.1"},
+		{"header repeated", "10.0.0.5:5000", []string{"198.51.100.1", "10.0.0.9"}, "", "198.51.100.1"},
+		{"all hops trusted", "10.0.0.5:5000", []string{"10.0.0.8, 10.0.0.9"}, "", "10.0.0.8"},
+		{"X-Real-IP ignored with X-Forwarded-For", "10.0.0.5:5000", []string{"10.0.0.9"}, "1.2.3.4", "10.0.0.9"},
+		{"X-Real-IP alone", "10.0.0.5:5000", nil, "198.51.100.1", "198.51.100.1"},
+		{"garbage hop", "10.0.0.5:5000", []string{"evil, 10.0.0.9"}, "1.2.3.4", "10.0.0.9"},
+		{"garbage only", "10.0.0.5:5000", []string{"evil"}, "1.2.3.4", "10.0.0.5"},
+		{"IPv4-mapped hop", "10.0.0.5:5000", []string{"::ffff:198.51.100.1"}, "", "198.51.100.1"},
+		{"IPv6 client", "[::1]:5000", []string{"198.51.100.1"}, "", "::1"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/upload", nil)
+		r.RemoteAddr = tt.remote
+		for _, f := range tt.forwards {
+			r.Header.Add("X-Forwarded-For", f)
+		}
+		if tt.realIP != "" {
+			r.Header.Set("X-Real-IP", tt.realIP)
+		}
+		if got := clientIP(r); got != tt.want {
+			t.Errorf("%s: clientIP = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWithRateLimit(t *testing.T) {
+	setRateLimitRules(t, map[string]*rateLimitRule{"upload": {Rate: 1.0 / 60, Burst: 1}})
+	old := rateLimiter
+	rateLimiter = &RateLimiter{buckets: make(map[string]*tokenBucket)}
+	t.Cleanup(func() { rateLimiter = old })
+
+	handler := withRateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/upload", nil))
+		if w.Code != want {
+			t.Fatalf("request %d: status %d, want %d", i, w.Code, want)
+		}
+		if w.Header().Get("RateLimit-Limit") != "1" || w.Header().Get("RateLimit-Policy") != "1;w=60" {
+			t.Errorf("request %d: headers %v", i, w.Header())
+		}
+		if want == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "60" {
+			t.Errorf("Retry-After = %q, want 60", w.Header().Get("Retry-After"))
+		}
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/upload", nil))
+	if w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "" {
+		t.Errorf("GET was rate limited: %d %v", w.Code, w.Header())
+	}
+}
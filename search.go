@@ -0,0 +1,653 @@
+package main
+
+import (
+	"encoding/json"
+	"html"
+	"html/template"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// BM25 ranking parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Words too common in Indonesian and English to be useful on their own.
+// They are still indexed so phrase queries keep working.
+var stopWords = map[string]bool{
+	"yang": true, "dan": true, "di": true, "ke": true, "dari": true, "ini": true,
+	"itu": true, "untuk": true, "dengan": true, "pada": true, "adalah": true,
+	"atau": true, "juga": true, "dalam": true, "tidak": true, "akan": true,
+	"the": true, "and": true, "of": true, "to": true, "in": true, "a": true,
+	"an": true, "is": true, "for": true, "on": true, "or": true, "with": true,
+	"at": true, "by": true, "be": true, "as": true, "it": true,
+}
+
+// Indonesian particles and possessive clitics stripped from the end of words,
+// e.g. "invoicenya" -> "invoice", "bukankah" -> "bukan"
+var indonesianSuffixes = []string{"nya", "lah", "kah", "tah", "pun"}
+
+// token is a normalised term plus its byte range in the source text
+type token struct {
+	term       string
+	start, end int
+}
+
+// tokenize splits text into normalised terms. Runs of letters and digits form
+// a word; hyphens split reduplicated Indonesian words ("buku-buku") and codes
+// like "INV-2024" into parts so each part can be found and phrase queries
+// still match the whole.
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = appendToken(tokens, text, start, i)
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = appendToken(tokens, text, start, len(text))
+	}
+	return tokens
+}
+
+func appendToken(tokens []token, text string, start, end int) []token {
+	word := text[start:end]
+	// Drop English possessive "'s" left behind by the apostrophe split
+	if word == "s" && start > 0 && (text[start-1] == '\'' || strings.HasSuffix(text[:start], "’")) {
+		return tokens
+	}
+	term := normalizeTerm(word)
+	if term == "" {
+		return tokens
+	}
+	return append(tokens, token{term: term, start: start, end: end})
+}
+
+// normalizeTerm lowercases a word and strips Indonesian clitics
+func normalizeTerm(word string) string {
+	term := strings.ToLower(word)
+	for _, suffix := range indonesianSuffixes {
+		if strings.HasSuffix(term, suffix) && utf8.RuneCountInString(term)-len(suffix) >= 4 {
+			term = strings.TrimSuffix(term, suffix)
+			break
+		}
+	}
+	return term
+}
+
+// SearchIndex is an in-memory inverted index with term positions
+type SearchIndex struct {
+	mu       sync.RWMutex
+	postings map[string]map[string][]int // term -> document ID -> positions
+	docLen   map[string]int
+	totalLen int
+}
+
+func newSearchIndex() *SearchIndex {
+	return &SearchIndex{
+		postings: make(map[string]map[string][]int),
+		docLen:   make(map[string]int),
+	}
+}
+
+// Add indexes text under id, replacing anything previously indexed for it
+func (ix *SearchIndex) Add(id, text string) {
+	tokens := tokenize(text)
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.removeLocked(id)
+	for pos, tok := range tokens {
+		docs := ix.postings[tok.term]
+		if docs == nil {
+			docs = make(map[string][]int)
+			ix.postings[tok.term] = docs
+		}
+		docs[id] = append(docs[id], pos)
+	}
+	ix.docLen[id] = len(tokens)
+	ix.totalLen += len(tokens)
+}
+
+// Remove drops id from the index
+func (ix *SearchIndex) Remove(id string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.removeLocked(id)
+}
+
+func (ix *SearchIndex) removeLocked(id string) {
+	n, ok := ix.docLen[id]
+	if !ok {
+		return
+	}
+	for term, docs := range ix.postings {
+		if _, ok := docs[id]; ok {
+			delete(docs, id)
+			if len(docs) == 0 {
+				delete(ix.postings, term)
+			}
+		}
+	}
+	delete(ix.docLen, id)
+	ix.totalLen -= n
+}
+
+func (ix *SearchIndex) bm25(tf, df, docLen int) float64 {
+	n := float64(len(ix.docLen))
+	idf := math.Log(1 + (n-float64(df)+0.5)/(float64(df)+0.5))
+	avg := float64(ix.totalLen) / math.Max(n, 1)
+	norm := float64(tf) + bm25K1*(1-bm25B+bm25B*float64(docLen)/math.Max(avg, 1))
+	return idf * float64(tf) * (bm25K1 + 1) / norm
+}
+
+// termScores scores every document containing term
+func (ix *SearchIndex) termScores(term string) map[string]float64 {
+	docs := ix.postings[term]
+	scores := make(map[string]float64, len(docs))
+	for id, positions := range docs {
+		scores[id] = ix.bm25(len(positions), len(docs), ix.docLen[id])
+	}
+	return scores
+}
+
+// prefixScores scores every document containing a term starting with prefix
+func (ix *SearchIndex) prefixScores(prefix string) (map[string]float64, []string) {
+	scores := make(map[string]float64)
+	var expanded []string
+	for term := range ix.postings {
+		if !strings.HasPrefix(term, prefix) {
+			continue
+		}
+		expanded = append(expanded, term)
+		for id, score := range ix.termScores(term) {
+			scores[id] += score
+		}
+	}
+	return scores, expanded
+}
+
+// phraseScores scores every document containing the terms consecutively
+func (ix *SearchIndex) phraseScores(phrase []string) map[string]float64 {
+	matches := make(map[string]int)
+	first := ix.postings[phrase[0]]
+	for id, starts := range first {
+		count := 0
+		for _, start := range starts {
+			ok := true
+			for offset, term := range phrase[1:] {
+				if !containsInt(ix.postings[term][id], start+offset+1) {
+					ok = false
+					break
+				}
+			}
+			if ok {
+				count++
+			}
+		}
+		if count > 0 {
+			matches[id] = count
+		}
+	}
+
+	scores := make(map[string]float64, len(matches))
+	for id, tf := range matches {
+		scores[id] = ix.bm25(tf, len(matches), ix.docLen[id]) * float64(len(phrase))
+	}
+	return scores
+}
+
+func containsInt(sorted []int, v int) bool {
+	i := sort.SearchInts(sorted, v)
+	return i < len(sorted) && sorted[i] == v
+}
+
+// SearchQuery is a parsed search box query.
+//
+//	invoice 2024         all words must appear
+//	"nomor faktur"       exact phrase
+//	inv*                 prefix
+//	tag:keuangan         document tag
+//	collection:klien-abc document collection
+//	meta.vendor:maju     custom metadata (also meta.amount>1000, meta.due<2024-06-01)
+//	from:2024-01-01      created on or after the date
+//	to:2024-12-31        created on or before the date
+type SearchQuery struct {
+	Terms      []string
+	Prefixes   []string
+	Phrases    [][]string
+	Tags       []string
+	Collection string
+	Metadata   []metadataFilter
+	From       time.Time
+	To         time.Time
+}
+
+func (q SearchQuery) hasText() bool {
+	return len(q.Terms) > 0 || len(q.Prefixes) > 0 || len(q.Phrases) > 0
+}
+
+func parseSearchQuery(raw string) SearchQuery {
+	var q SearchQuery
+
+	// Pull out quoted phrases first
+	for {
+		open := strings.IndexByte(raw, '"')
+		if open < 0 {
+			break
+		}
+		end := strings.IndexByte(raw[open+1:], '"')
+		if end < 0 {
+			raw = raw[:open] + " " + raw[open+1:]
+			break
+		}
+		var phrase []string
+		for _, tok := range tokenize(raw[open+1 : open+1+end]) {
+			phrase = append(phrase, tok.term)
+		}
+		switch len(phrase) {
+		case 0:
+		case 1:
+			q.Terms = append(q.Terms, phrase[0])
+		default:
+			q.Phrases = append(q.Phrases, phrase)
+		}
+		raw = raw[:open] + " " + raw[open+1+end+1:]
+	}
+
+	for _, field := range strings.Fields(raw) {
+		if filter, ok := parseMetadataFilter(field); ok {
+			q.Metadata = append(q.Metadata, filter)
+			continue
+		}
+		if key, value, ok := strings.Cut(field, ":"); ok && value != "" {
+			switch strings.ToLower(key) {
+			case "tag":
+				q.Tags = append(q.Tags, normalizeTags([]string{value})...)
+				continue
+			case "collection":
+				q.Collection = strings.ToLower(value)
+				continue
+			case "from":
+				// A date that does not parse is dropped rather than searched for as text
+				if t, err := time.Parse("2006-01-02", value); err == nil {
+					q.From = t
+				}
+				continue
+			case "to":
+				if t, err := time.Parse("2006-01-02", value); err == nil {
+					q.To = t
+				}
+				continue
+			}
+		}
+
+		if strings.HasSuffix(field, "*") {
+			if prefix := strings.ToLower(strings.TrimRight(field, "*")); len(tokenize(prefix)) == 1 {
+				q.Prefixes = append(q.Prefixes, tokenize(prefix)[0].term)
+				continue
+			}
+		}
+
+		tokens := tokenize(field)
+		if len(tokens) > 1 {
+			// Codes like INV-2024/001 are searched as a phrase
+			phrase := make([]string, len(tokens))
+			for i, tok := range tokens {
+				phrase[i] = tok.term
+			}
+			q.Phrases = append(q.Phrases, phrase)
+			continue
+		}
+		for _, tok := range tokens {
+			q.Terms = append(q.Terms, tok.term)
+		}
+	}
+
+	// Ignore stop words unless they are all the user typed
+	var terms []string
+	for _, term := range q.Terms {
+		if !stopWords[term] {
+			terms = append(terms, term)
+		}
+	}
+	if len(terms) > 0 || len(q.Prefixes) > 0 || len(q.Phrases) > 0 {
+		q.Terms = terms
+	}
+
+	return q
+}
+
+// match returns the BM25 score of every document matching all text clauses,
+// along with the index terms that should be highlighted
+func (ix *SearchIndex) match(q SearchQuery) (map[string]float64, map[string]bool) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	highlight := make(map[string]bool)
+	var clauses []map[string]float64
+
+	for _, term := range q.Terms {
+		clauses = append(clauses, ix.termScores(term))
+		highlight[term] = true
+	}
+	for _, prefix := range q.Prefixes {
+		scores, expanded := ix.prefixScores(prefix)
+		clauses = append(clauses, scores)
+		for _, term := range expanded {
+			highlight[term] = true
+		}
+	}
+	for _, phrase := range q.Phrases {
+		clauses = append(clauses, ix.phraseScores(phrase))
+		for _, term := range phrase {
+			highlight[term] = true
+		}
+	}
+
+	if len(clauses) == 0 {
+		return nil, highlight
+	}
+
+	// Intersect, starting from the smallest clause
+	sort.Slice(clauses, func(i, j int) bool { return len(clauses[i]) < len(clauses[j]) })
+	result := make(map[string]float64, len(clauses[0]))
+	for id, score := range clauses[0] {
+		result[id] = score
+	}
+	for _, clause := range clauses[1:] {
+		for id := range result {
+			score, ok := clause[id]
+			if !ok {
+				delete(result, id)
+				continue
+			}
+			result[id] += score
+		}
+	}
+	return result, highlight
+}
+
+// SearchResult is a ranked document with a highlighted excerpt
+type SearchResult struct {
+	Document *Document     `json:"document"`
+	Score    float64       `json:"score"`
+	Snippet  template.HTML `json:"snippet"`
+}
+
+// Search runs q against the store and returns at most limit results,
+// best match first
+func (s *DocumentStore) Search(q SearchQuery, limit int) []SearchResult {
+	var scores map[string]float64
+	highlight := map[string]bool{}
+	if q.hasText() {
+		scores, highlight = s.index.match(q)
+	}
+
+	var results []SearchResult
+	for _, doc := range s.List() {
+		score := 0.0
+		if q.hasText() {
+			var ok bool
+			if score, ok = scores[doc.ID]; !ok {
+				continue
+			}
+		}
+		if !matchesFilters(doc, q) {
+			continue
+		}
+		results = append(results, SearchResult{Document: doc, Score: score})
+	}
+
+	// List is already newest first, so a stable sort keeps that order for ties
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	for i := range results {
+		results[i].Snippet = buildSnippet(results[i].Document.Text, highlight, 30)
+	}
+	return results
+}
+
+func matchesFilters(doc *Document, q SearchQuery) bool {
+	for _, tag := range q.Tags {
+		if !hasTag(doc, tag) {
+			return false
+		}
+	}
+	if q.Collection != "" && doc.Collection != q.Collection {
+		return false
+	}
+	for _, filter := range q.Metadata {
+		if !filter.matches(doc) {
+			return false
+		}
+	}
+	if !q.From.IsZero() && doc.CreatedAt.Before(q.From) {
+		return false
+	}
+	// "to" is inclusive of the whole day
+	if !q.To.IsZero() && !doc.CreatedAt.Before(q.To.Add(24*time.Hour)) {
+		return false
+	}
+	return true
+}
+
+// buildSnippet returns an HTML-escaped excerpt of text around the densest
+// group of highlighted terms, with those terms wrapped in <mark>
+func buildSnippet(text string, highlight map[string]bool, window int) template.HTML {
+	tokens := tokenize(text)
+	if len(tokens) == 0 {
+		return ""
+	}
+
+	// Pick the window containing the most highlighted tokens
+	best, bestCount := 0, -1
+	for start := 0; start < len(tokens); start++ {
+		if start > 0 && !highlight[tokens[start].term] {
+			continue
+		}
+		count := 0
+		for i := start; i < len(tokens) && i < start+window; i++ {
+			if highlight[tokens[i].term] {
+				count++
+			}
+		}
+		if count > bestCount {
+			best, bestCount = start, count
+		}
+	}
+	// Leave a little leading context
+	if best > 0 {
+		best = max(0, best-5)
+	}
+	last := min(len(tokens), best+window) - 1
+
+	var b strings.Builder
+	if best > 0 {
+		b.WriteString("… ")
+	}
+	pos := tokens[best].start
+	for _, tok := range tokens[best : last+1] {
+		b.WriteString(html.EscapeString(text[pos:tok.start]))
+		word := html.EscapeString(text[tok.start:tok.end])
+		if highlight[tok.term] {
+			b.WriteString("<mark>" + word + "</mark>")
+		} else {
+			b.WriteString(word)
+		}
+		pos = tok.end
+	}
+	if last < len(tokens)-1 {
+		b.WriteString(" …")
+	} else {
+		b.WriteString(html.EscapeString(strings.TrimRightFunc(text[pos:], unicode.IsSpace)))
+	}
+	return template.HTML(b.String())
+}
+
+// searchRequest builds a SearchQuery from the q, tag, collection, from and
+// to parameters
+func searchRequest(r *http.Request) SearchQuery {
+	q := parseSearchQuery(r.URL.Query().Get("q"))
+	if tags := parseTagList(r.URL.Query().Get("tag")); len(tags) > 0 {
+		q.Tags = append(q.Tags, tags...)
+	}
+	if collection := strings.TrimSpace(r.URL.Query().Get("collection")); collection != "" {
+		q.Collection = strings.ToLower(collection)
+	}
+	if t, err := time.Parse("2006-01-02", r.URL.Query().Get("from")); err == nil {
+		q.From = t
+	}
+	if t, err := time.Parse("2006-01-02", r.URL.Query().Get("to")); err == nil {
+		q.To = t
+	}
+	return q
+}
+
+func searchHandler(w http.ResponseWriter, r *http.Request) {
+	tmpl, exists := cachedTemplate("search")
+
+	if !exists {
+		writeError(w, r, errTemplateNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	params := r.URL.Query()
+	data := struct {
+		Query       string
+		Tag         string
+		Collection  string
+		From        string
+		To          string
+		Collections []*Collection
+		Results     []SearchResult
+		Total       int
+	}{
+		Query:       params.Get("q"),
+		Tag:         params.Get("tag"),
+		Collection:  params.Get("collection"),
+		From:        params.Get("from"),
+		To:          params.Get("to"),
+		Collections: collectionStore.List(),
+	}
+
+	if data.Query != "" || data.Tag != "" || data.Collection != "" || data.From != "" || data.To != "" {
+		data.Results = docStore.Search(searchRequest(r), 50)
+		data.Total = len(data.Results)
+	}
+
+	tmpl.Execute(w, data)
+}
+
+func apiSearchHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	results := docStore.Search(searchRequest(r), limit)
+	if results == nil {
+		results = []SearchResult{}
+	}
+	json.NewEncoder(w).Encode(struct {
+		Results []SearchResult `json:"results"`
+	}{results})
+}
+
+const searchTmpl = `
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>OCR Simple - Cari Dokumen</title>
+    <style>
+        * { box-sizing: border-box; }
+        body { font-family: Arial, sans-serif; padding: 15px; background: #f5f5f5; margin: 0; }
+        .container { max-width: 900px; margin: 0 auto; background: white; padding: 20px; border-radius: 4px; box-shadow: 0 2px 4px rgba(0,0,0,0.1); }
+        .header { display: flex; justify-content: space-between; align-items: center; margin-bottom: 15px; }
+        .header h1 { margin: 0; font-size: 1.5em; color: #333; }
+        .header a { color: #007bff; text-decoration: none; }
+        form { display: flex; flex-wrap: wrap; gap: 8px; margin-bottom: 15px; }
+        input[type="text"], input[type="date"], select { padding: 6px 8px; border: 1px solid #ccc; border-radius: 3px; font-size: 14px; }
+        input[name="q"] { flex: 1 1 100%; font-size: 16px; }
+        .btn { background: #007bff; color: white; border: none; padding: 6px 16px; border-radius: 3px; cursor: pointer; font-size: 14px; }
+        .btn:hover { background: #0056b3; }
+        .hint { color: #666; font-size: 0.8em; margin: -8px 0 15px 0; }
+        .summary { color: #666; font-size: 0.9em; margin-bottom: 10px; }
+        .result { border-bottom: 1px solid #eee; padding: 10px 0; }
+        .result-title { font-weight: bold; color: #333; }
+        .result-title a { color: #333; text-decoration: none; }
+        .result-meta { color: #888; font-size: 0.8em; margin: 2px 0 6px 0; }
+        .tag { background: #e9ecef; color: #495057; padding: 1px 6px; border-radius: 3px; font-size: 0.85em; margin-right: 3px; }
+        .snippet { font-family: 'Courier New', monospace; font-size: 13px; line-height: 1.4; white-space: pre-wrap; color: #333; }
+        mark { background: #fff3a0; padding: 0 1px; }
+        .empty { color: #666; font-style: italic; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>🔍 Cari Dokumen</h1>
+            <a href="/">← Kembali ke OCR</a>
+        </div>
+
+        <form method="GET" action="/search">
+            <input type="text" name="q" value="{{.Query}}" placeholder="Nomor invoice, kata kunci, &quot;frasa tepat&quot;, awalan*" autofocus>
+            <input type="text" name="tag" value="{{.Tag}}" placeholder="Tag (pisahkan dengan koma)">
+            <select name="collection">
+                <option value="">Semua koleksi</option>
+                {{range .Collections}}<option value="{{.ID}}"{{if eq .ID $.Collection}} selected{{end}}>{{.Name}}</option>{{end}}
+            </select>
+            <input type="date" name="from" value="{{.From}}" title="Dari tanggal">
+            <input type="date" name="to" value="{{.To}}" title="Sampai tanggal">
+            <button type="submit" class="btn">Cari</button>
+        </form>
+        <p class="hint">Contoh: <code>"nomor faktur" inv*</code>, <code>tag:keuangan from:2024-01-01</code>, <code>meta.vendor:maju meta.total&gt;1000</code></p>
+
+        {{if .Results}}
+            <div class="summary">{{.Total}} dokumen ditemukan</div>
+            {{range .Results}}
+            <div class="result">
+                <div class="result-title"><a href="/documents/{{.Document.ID}}">{{.Document.Filename}}</a></div>
+                <div class="result-meta">
+                    {{.Document.CreatedAt.Format "2006-01-02 15:04"}}
+                    {{if .Document.Collection}}· 🗂️ {{.Document.Collection}}{{end}}
+                    {{range .Document.Tags}}<span class="tag">{{.}}</span>{{end}}
+                </div>
+                <div class="snippet">{{.Snippet}}</div>
+            </div>
+            {{end}}
+        {{else if or .Query .Tag .Collection .From .To}}
+            <p class="empty">Tidak ada dokumen yang cocok.</p>
+        {{else}}
+            <p class="empty">Masukkan kata kunci untuk mencari teks dari gambar yang pernah diproses.</p>
+        {{end}}
+    </div>
+</body>
+</html>`
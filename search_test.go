@@ -0,0 +1,174 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Invoice 2024", []string{"invoice", "2024"}},
+		{"INV-2024/001", []string{"inv", "2024", "001"}},
+		{"buku-buku", []string{"buku", "buku"}},
+		{"invoicenya bukankah", []string{"invoice", "bukan"}},
+		// Short words keep what looks like a clitic
+		{"punya", []string{"punya"}},
+		{"John's receipt", []string{"john", "receipt"}},
+		{"John’s receipt", []string{"john", "receipt"}},
+		{"Überweisung Ärger", []string{"überweisung", "ärger"}},
+		{"  ...  ", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, tok := range tokenize(tt.text) {
+			got = append(got, tok.term)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTokenizeOffsets(t *testing.T) {
+	text := "Nomor: INV-7"
+	for _, tok := range tokenize(text) {
+		if got := normalizeTerm(text[tok.start:tok.end]); got != tok.term {
+			t.Errorf("token %q covers %q", tok.term, text[tok.start:tok.end])
+		}
+	}
+}
+
+func TestParseSearchQuery(t *testing.T) {
+	day := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+	tests := []struct {
+		raw  string
+		want SearchQuery
+	}{
+		{"invoice 2024", SearchQuery{Terms: []string{"invoice", "2024"}}},
+		{`"nomor faktur" inv*`, SearchQuery{Prefixes: []string{"inv"}, Phrases: [][]string{{"nomor", "faktur"}}}},
+		{`"faktur"`, SearchQuery{Terms: []string{"faktur"}}},
+		{`"unclosed quote`, SearchQuery{Terms: []string{"unclosed", "quote"}}},
+		{"INV-2024/001", SearchQuery{Phrases: [][]string{{"inv", "2024", "001"}}}},
+		{"the invoice", SearchQuery{Terms: []string{"invoice"}}},
+		// Stop words are kept when they are all there is
+		{"the and", SearchQuery{Terms: []string{"the", "and"}}},
+		{"tag:Keuangan TAG:pajak", SearchQuery{Tags: []string{"keuangan", "pajak"}}},
+		{"collection:Klien-ABC", SearchQuery{Collection: "klien-abc"}},
+		{"from:2024-01-01 to:2024-12-31", SearchQuery{From: day("2024-01-01"), To: day("2024-12-31")}},
+		// Invalid dates are dropped, not searched for as text
+		{"to:bad from:2024-13-01 invoice", SearchQuery{Terms: []string{"invoice"}}},
+		{"meta.vendor:maju", SearchQuery{Metadata: []metadataFilter{{Key: "vendor", Op: ':', Value: "maju"}}}},
+		{"meta.total>1000", SearchQuery{Metadata: []metadataFilter{{Key: "total", Op: '>', Value: "1000"}}}},
+		// Unknown keys are ordinary text
+		{"nomor:12", SearchQuery{Phrases: [][]string{{"nomor", "12"}}}},
+		{"", SearchQuery{}},
+	}
+	for _, tt := range tests {
+		if got := parseSearchQuery(tt.raw); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseSearchQuery(%q) = %+v, want %+v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+// rank returns the matching document IDs, best first
+func rank(ix *SearchIndex, raw string) []string {
+	scores, _ := ix.match(parseSearchQuery(raw))
+	var ids []string
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+func TestSearchIndexRanking(t *testing.T) {
+	ix := newSearchIndex()
+	ix.Add("once", "invoice from maju jaya for office supplies and delivery to the branch office")
+	ix.Add("twice", "invoice invoice total")
+	ix.Add("phrase", "nomor faktur 17 dari vendor")
+	ix.Add("split", "faktur dengan nomor 17")
+	ix.Add("other", "receipt for lunch")
+
+	tests := []struct {
+		raw  string
+		want []string
+	}{
+		// Higher term frequency in a shorter document ranks first
+		{"invoice", []string{"twice", "once"}},
+		{"invoice supplies", []string{"once"}},
+		// Without quotes word order does not matter, the shorter document wins
+		{"nomor faktur", []string{"split", "phrase"}},
+		{`"nomor faktur"`, []string{"phrase"}},
+		{"rece*", []string{"other"}},
+		{"missing", nil},
+	}
+	for _, tt := range tests {
+		if got := rank(ix, tt.raw); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("search %q = %v, want %v", tt.raw, got, tt.want)
+		}
+	}
+
+	ix.Remove("twice")
+	if got := rank(ix, "invoice"); !reflect.DeepEqual(got, []string{"once"}) {
+		t.Errorf("after Remove: search invoice = %v", got)
+	}
+}
+
+func TestAddVersionReindexes(t *testing.T) {
+	s, err := newDocumentStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := s.Add("scan.png", []byte("not an image"), OCRResponse{Text: "old invoice"}, DocumentDetails{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddVersion(doc.ID, OCRResponse{Text: "new receipt"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := s.Search(parseSearchQuery("invoice"), 0); len(got) != 0 {
+		t.Errorf("old text still found: %v", got)
+	}
+	if got := s.Search(parseSearchQuery("receipt"), 0); len(got) != 1 {
+		t.Errorf("new text found %d times, want 1", len(got))
+	}
+}
+
+func TestDeleteDocument(t *testing.T) {
+	s, err := newDocumentStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := s.Add("scan.png", []byte("not an image"), OCRResponse{Text: "invoice"}, DocumentDetails{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(doc.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Get(doc.ID); ok {
+		t.Error("document still stored")
+	}
+	if got := s.Search(parseSearchQuery("invoice"), 0); len(got) != 0 {
+		t.Errorf("deleted document still found: %v", got)
+	}
+
+	// Like Get, a missing document is not_found so handlers answer 404
+	if err := s.Delete(doc.ID); err != errDocumentNotFound {
+		t.Errorf("deleting again: %v, want errDocumentNotFound", err)
+	}
+}
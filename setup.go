@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A setup report is reused for this long, so reloading the page does not
+// start Tesseract for every configured path each time
+const setupReportTTL = 10 * time.Second
+
+// Languages most documents in this deployment need; the setup page warns
+// when one of them is missing
+var recommendedLanguages = []string{"eng", "ind"}
+
+// TesseractProbe is the outcome of trying one entry of ocr.tesseract_paths
+type TesseractProbe struct {
+	Path     string `json:"path"`
+	Resolved string `json:"resolved,omitempty"` // absolute path found by exec.LookPath
+	OK       bool   `json:"ok"`
+	Error    string `json:"error,omitempty"`
+}
+
+// probeTesseractPath checks that path resolves to an executable and that
+// `tesseract --version` runs
+func probeTesseractPath(path string) TesseractProbe {
+	p := TesseractProbe{Path: path}
+	resolved, err := exec.LookPath(path)
+	if err != nil {
+		p.Error = "not found"
+		if !errors.Is(err, exec.ErrNotFound) && !errors.Is(err, fs.ErrNotExist) {
+			p.Error = err.Error()
+		}
+		return p
+	}
+	p.Resolved = resolved
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, path, "--version").CombinedOutput()
+	switch {
+	case ctx.Err() != nil:
+		p.Error = "tesseract --version did not answer within 5s"
+	case err != nil:
+		p.Error = fmt.Sprintf("tesseract --version failed: %v", err)
+		if msg := firstLine(string(out)); msg != "" {
+			p.Error += ": " + msg
+		}
+	default:
+		p.OK = true
+	}
+	return p
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(line)
+}
+
+// DirCheck tells whether the server can create files in a directory
+type DirCheck struct {
+	Purpose  string
+	Dir      string
+	Writable bool
+	Error    string
+}
+
+func checkWritable(purpose, dir string) DirCheck {
+	c := DirCheck{Purpose: purpose, Dir: dir}
+	if abs, err := filepath.Abs(dir); err == nil {
+		c.Dir = abs
+	}
+	f, err := os.CreateTemp(dir, ".ocr-write-check-*")
+	if err != nil {
+		c.Error = err.Error()
+		return c
+	}
+	f.Close()
+	os.Remove(f.Name())
+	c.Writable = true
+	return c
+}
+
+// LanguageCheck is a recommended language and whether it is installed
+type LanguageCheck struct {
+	Code      string
+	Installed bool
+	Install   string // command installing it on this platform
+}
+
+// PlatformHelp holds the install commands for the platform the server runs on
+type PlatformHelp struct {
+	Name    string
+	Install []string
+	// Command installing a language pack, %s is the Tesseract code
+	Language string
+	Link     string
+}
+
+// platformHelp picks the commands for goos, and on Linux for the
+// distribution family from /etc/os-release
+func platformHelp(goos string) PlatformHelp {
+	switch goos {
+	case "darwin":
+		return PlatformHelp{Name: "macOS (Homebrew)", Install: []string{"brew install tesseract"}, Language: "brew install tesseract-lang"}
+	case "windows":
+		return PlatformHelp{
+			Name:     "Windows",
+			Install:  []string{"winget install UB-Mannheim.TesseractOCR"},
+			Language: `download %s.traineddata from https://github.com/tesseract-ocr/tessdata_fast into the tessdata folder`,
+			Link:     "https://github.com/UB-Mannheim/tesseract/wiki",
+		}
+	case "linux":
+		switch linuxDistro() {
+		case "fedora", "rhel":
+			return PlatformHelp{Name: "Linux (Fedora/RHEL)", Install: []string{"sudo dnf install tesseract"}, Language: "sudo dnf install tesseract-langpack-%s"}
+		case "alpine":
+			return PlatformHelp{Name: "Linux (Alpine)", Install: []string{"sudo apk add tesseract-ocr"}, Language: "sudo apk add tesseract-ocr-data-%s"}
+		case "arch":
+			return PlatformHelp{Name: "Linux (Arch)", Install: []string{"sudo pacman -S tesseract tesseract-data-eng"}, Language: "sudo pacman -S tesseract-data-%s"}
+		default:
+			return PlatformHelp{Name: "Linux (Debian/Ubuntu)", Install: []string{"sudo apt update", "sudo apt install tesseract-ocr"}, Language: "sudo apt install tesseract-ocr-%s"}
+		}
+	}
+	return PlatformHelp{Name: goos, Link: "https://tesseract-ocr.github.io/tessdoc/Installation.html"}
+}
+
+// linuxDistro returns the distribution family: debian, fedora, rhel,
+// alpine, arch, or "" when unknown
+func linuxDistro() string {
+	f, err := os.Open("/etc/os-release")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	var ids []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if ok && (key == "ID" || key == "ID_LIKE") {
+			ids = append(ids, strings.Fields(strings.Trim(value, `"`))...)
+		}
+	}
+	for _, id := range ids {
+		switch id {
+		case "debian", "ubuntu":
+			return "debian"
+		case "fedora":
+			return "fedora"
+		case "rhel", "centos", "rocky", "almalinux":
+			return "rhel"
+		case "alpine":
+			return "alpine"
+		case "arch":
+			return "arch"
+		}
+	}
+	return ""
+}
+
+// SetupReport describes the environment of the server for the setup page
+type SetupReport struct {
+	Available      bool
+	Path           string
+	Version        string
+	Probes         []TesseractProbe
+	Languages      []string // installed
+	LanguageError  string
+	Recommended    []LanguageCheck
+	Tessdata       string
+	TessdataPrefix string
+	Dirs           []DirCheck
+	Platform       PlatformHelp
+	OS, Arch       string
+}
+
+var (
+	setupReportMu   sync.Mutex
+	lastSetupReport *SetupReport
+	setupReportAt   time.Time
+)
+
+// cachedSetupReport returns a setup report at most setupReportTTL old.
+// Callers wait for a running probe instead of starting their own.
+func cachedSetupReport() SetupReport {
+	setupReportMu.Lock()
+	defer setupReportMu.Unlock()
+	fresh := lastSetupReport != nil && time.Since(setupReportAt) < setupReportTTL
+	recordCacheLookup("setup_report", fresh)
+	if !fresh {
+		r := setupReport()
+		lastSetupReport, setupReportAt = &r, time.Now()
+	}
+	return *lastSetupReport
+}
+
+// forgetSetupReport makes the next setup page probe again
+func forgetSetupReport() {
+	setupReportMu.Lock()
+	lastSetupReport = nil
+	setupReportMu.Unlock()
+}
+
+// setupReport probes every configured Tesseract path, not only up to the
+// first that works, so the page can show why the others failed
+func setupReport() SetupReport {
+	r := SetupReport{
+		TessdataPrefix: os.Getenv("TESSDATA_PREFIX"),
+		Platform:       platformHelp(runtime.GOOS),
+		OS:             runtime.GOOS,
+		Arch:           runtime.GOARCH,
+	}
+	r.Path, r.Version, r.Available = currentEngine()
+	for _, path := range config.TesseractPaths {
+		r.Probes = append(r.Probes, probeTesseractPath(path))
+	}
+
+	if r.Available {
+		langs, dir, err := tesseractLanguageInfo(r.Path)
+		if err != nil {
+			r.LanguageError = err.Error()
+		}
+		r.Languages, r.Tessdata = langs, dir
+	}
+	installed := map[string]bool{}
+	for _, l := range r.Languages {
+		installed[l] = true
+	}
+	for _, code := range recommendedLanguages {
+		c := LanguageCheck{Code: code, Installed: installed[code]}
+		if strings.Contains(r.Platform.Language, "%s") {
+			c.Install = fmt.Sprintf(r.Platform.Language, code)
+		} else {
+			c.Install = r.Platform.Language
+		}
+		r.Recommended = append(r.Recommended, c)
+	}
+
+	r.Dirs = writableDirChecks()
+	return r
+}
+
+// writableDirChecks checks the directories the server writes to. Images
+// are written to the system temp directory before Tesseract reads them.
+func writableDirChecks() []DirCheck {
+	return []DirCheck{
+		checkWritable("Temporary images (system temp)", os.TempDir()),
+		checkWritable("Document history", documentsDir),
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Directory where processed uploads are persisted
+const documentsDir = "data/documents"
+
+// Text returned by processOCRRequest when Tesseract finds nothing
+const noTextMessage = "No text detected in the image."
+
+// Document is a processed upload kept on the server after uploadHandler returns.
+// Text, Words, Confidence and Options mirror the latest entry in Versions.
+type Document struct {
+	ID            string                   `json:"id"`
+	Filename      string                   `json:"filename"`
+	Size          int64                    `json:"size"`
+	Text          string                   `json:"text"`
+	Words         []OCRWord                `json:"words,omitempty"`
+	Confidence    float64                  `json:"confidence"`
+	Options       OCROptions               `json:"options"`
+	Collection    string                   `json:"collection,omitempty"`
+	Tags          []string                 `json:"tags,omitempty"`
+	Metadata      map[string]MetadataValue `json:"metadata,omitempty"`
+	ImageFile     string                   `json:"image_file,omitempty"`
+	ThumbnailFile string                   `json:"thumbnail_file,omitempty"`
+	Versions      []ResultVersion          `json:"versions,omitempty"`
+	CreatedAt     time.Time                `json:"created_at"`
+	UpdatedAt     time.Time                `json:"updated_at"`
+}
+
+// DocumentDetails are the user-supplied fields of a document
+type DocumentDetails struct {
+	Collection string
+	Tags       []string
+	Metadata   map[string]MetadataValue
+}
+
+// normalize validates the details and returns them in canonical form
+func (d DocumentDetails) normalize() (DocumentDetails, error) {
+	d.Collection = strings.TrimSpace(d.Collection)
+	if d.Collection != "" {
+		if _, ok := collectionStore.Get(d.Collection); !ok {
+			return d, invalidField("collection", "koleksi %q tidak ditemukan", d.Collection)
+		}
+	}
+	d.Tags = normalizeTags(d.Tags)
+
+	var err error
+	if d.Metadata, err = normalizeMetadata(d.Metadata); err != nil {
+		return d, asAPIError(err, "metadata")
+	}
+	return d, nil
+}
+
+// DocumentStore keeps documents in memory and mirrors them to disk,
+// one directory per document
+type DocumentStore struct {
+	dir   string
+	mu    sync.RWMutex
+	docs  map[string]*Document
+	index *SearchIndex
+}
+
+var docStore *DocumentStore
+
+// newDocumentStore opens (or creates) the store in dir and indexes every
+// document found there
+func newDocumentStore(dir string) (*DocumentStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("gagal membuat direktori dokumen: %v", err)
+	}
+
+	s := &DocumentStore{
+		dir:   dir,
+		docs:  make(map[string]*Document),
+		index: newSearchIndex(),
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name(), "document.json"))
+		if err != nil {
+			slog.Warn("skipping document", "dir", entry.Name(), "err", err)
+			continue
+		}
+		var doc Document
+		if err := json.Unmarshal(data, &doc); err != nil {
+			slog.Warn("skipping document", "dir", entry.Name(), "err", err)
+			continue
+		}
+		migrateVersions(&doc)
+		s.docs[doc.ID] = &doc
+		s.indexDocument(&doc)
+	}
+
+	return s, nil
+}
+
+func newDocumentID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return time.Now().UTC().Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
+
+// normalizeTags lowercases, trims and de-duplicates a list of tags
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	out := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		out = append(out, tag)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// parseTagList splits a comma separated tag string as sent by the upload form
+func parseTagList(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	return normalizeTags(strings.Split(s, ","))
+}
+
+// Add records the result of an upload, keeping the original image and a
+// thumbnail next to it, and makes it searchable
+func (s *DocumentStore) Add(filename string, imageBytes []byte, result OCRResponse, details DocumentDetails) (*Document, error) {
+	details, err := details.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &Document{
+		ID:         newDocumentID(),
+		Filename:   filepath.Base(filename),
+		Size:       int64(len(imageBytes)),
+		Collection: details.Collection,
+		Tags:       details.Tags,
+		Metadata:   details.Metadata,
+		CreatedAt:  time.Now().UTC(),
+	}
+	doc.appendVersion(result, doc.CreatedAt)
+
+	docDir := filepath.Join(s.dir, doc.ID)
+	if err := os.MkdirAll(docDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	doc.ImageFile = "original" + strings.ToLower(filepath.Ext(doc.Filename))
+	if err := writeImageFileOptimized(filepath.Join(docDir, doc.ImageFile), imageBytes); err != nil {
+		os.RemoveAll(docDir)
+		return nil, err
+	}
+
+	// A missing thumbnail is not fatal, the pages fall back to a placeholder
+	if err := writeThumbnail(filepath.Join(docDir, thumbnailFile), imageBytes); err != nil {
+		slog.Warn("creating thumbnail failed", "filename", doc.Filename, "err", err)
+	} else {
+		doc.ThumbnailFile = thumbnailFile
+	}
+
+	if err := s.write(doc); err != nil {
+		os.RemoveAll(docDir)
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.docs[doc.ID] = doc
+	s.indexDocument(doc)
+	s.mu.Unlock()
+
+	return doc, nil
+}
+
+// write persists doc atomically via a temporary file
+func (s *DocumentStore) write(doc *Document) error {
+	docDir := filepath.Join(s.dir, doc.ID)
+	if err := os.MkdirAll(docDir, 0o755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(docDir, "document.json.tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(docDir, "document.json"))
+}
+
+func (s *DocumentStore) indexDocument(doc *Document) {
+	if doc.Text == noTextMessage {
+		return
+	}
+	s.index.Add(doc.ID, doc.Text)
+}
+
+// update applies fn to a copy of the document and persists the result, so
+// readers holding the old pointer never see a half-updated document. The
+// index is updated under the same lock, so concurrent updates cannot leave
+// it with an older text than the stored document.
+func (s *DocumentStore) update(id string, fn func(doc *Document)) (*Document, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.docs[id]
+	if !ok {
+		return nil, errDocumentNotFound
+	}
+	doc := *current
+	fn(&doc)
+	doc.UpdatedAt = time.Now().UTC()
+	if err := s.write(&doc); err != nil {
+		return nil, err
+	}
+	s.docs[id] = &doc
+	if doc.Text != current.Text {
+		s.index.Remove(id)
+		s.indexDocument(&doc)
+	}
+	return &doc, nil
+}
+
+// AddVersion records a new OCR result for a document, e.g. after re-running
+// it with other options. Earlier versions are kept.
+func (s *DocumentStore) AddVersion(id string, result OCRResponse) (*Document, error) {
+	return s.update(id, func(doc *Document) {
+		// Versions is shared with the previous copy, so never append in place
+		doc.Versions = append([]ResultVersion(nil), doc.Versions...)
+		doc.appendVersion(result, time.Now().UTC())
+	})
+}
+
+// UpdateDetails replaces the collection, tags and metadata of a document
+func (s *DocumentStore) UpdateDetails(id string, details DocumentDetails) (*Document, error) {
+	details, err := details.normalize()
+	if err != nil {
+		return nil, err
+	}
+	return s.update(id, func(doc *Document) {
+		doc.Collection = details.Collection
+		doc.Tags = details.Tags
+		doc.Metadata = details.Metadata
+	})
+}
+
+// Delete removes a document and its files
+func (s *DocumentStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.docs[id]; !ok {
+		return errDocumentNotFound
+	}
+	if err := os.RemoveAll(filepath.Join(s.dir, id)); err != nil {
+		return err
+	}
+	delete(s.docs, id)
+	s.index.Remove(id)
+	return nil
+}
+
+// FilePath returns the on-disk path of one of a document's files
+func (s *DocumentStore) FilePath(doc *Document, name string) string {
+	return filepath.Join(s.dir, doc.ID, name)
+}
+
+// Get returns the document with the given id
+func (s *DocumentStore) Get(id string) (*Document, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	doc, ok := s.docs[id]
+	return doc, ok
+}
+
+// List returns all documents, newest first
+func (s *DocumentStore) List() []*Document {
+	s.mu.RLock()
+	docs := make([]*Document, 0, len(s.docs))
+	for _, doc := range s.docs {
+		docs = append(docs, doc)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(docs, func(i, j int) bool {
+		return docs[i].CreatedAt.After(docs[j].CreatedAt)
+	})
+	return docs
+}
+
+func hasTag(doc *Document, tag string) bool {
+	for _, t := range doc.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// tracer creates the spans of the server; it does nothing until
+// initTracing installs an exporting provider
+var tracer = otel.Tracer("ocr-simple")
+
+// initTracing sets up W3C trace-context propagation and, when an OTLP
+// endpoint is configured, exports spans to it. Everything is configured
+// with the standard OpenTelemetry variables:
+//
+//	OTEL_EXPORTER_OTLP_ENDPOINT         collector, e.g. http://localhost:4318 (enables tracing)
+//	OTEL_EXPORTER_OTLP_TRACES_ENDPOINT  collector for traces only
+//	OTEL_EXPORTER_OTLP_PROTOCOL         http/protobuf (default) or grpc
+//	OTEL_SERVICE_NAME                   default "ocr-simple"
+//	OTEL_TRACES_SAMPLER                 e.g. parentbased_traceidratio with OTEL_TRACES_SAMPLER_ARG=0.1
+//	OTEL_TRACES_EXPORTER=none           turns exporting off
+func initTracing() (bool, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if os.Getenv("OTEL_TRACES_EXPORTER") == "none" ||
+		(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "") {
+		return false, nil
+	}
+
+	ctx := context.Background()
+	protocol := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL")
+	if protocol == "" {
+		protocol = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+	switch protocol {
+	case "", "http/protobuf":
+		exporter, err = otlptracehttp.New(ctx)
+	case "grpc":
+		exporter, err = otlptracegrpc.New(ctx)
+	default:
+		return false, fmt.Errorf("OTEL_EXPORTER_OTLP_PROTOCOL %q is not supported, use http/protobuf or grpc", protocol)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// Later options win, so OTEL_SERVICE_NAME overrides the default name
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName("ocr-simple")),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+	)
+	if err != nil {
+		return false, err
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+
+	// Spans are exported in batches; send the last batch before exiting
+	atExit(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			slog.Warn("exporting the last spans failed", "err", err)
+		}
+	})
+	return true, nil
+}
+
+// spanError marks span as failed with the error code and passes apiErr on
+func spanError(span trace.Span, apiErr *APIError) *APIError {
+	span.SetAttributes(attribute.String("error.type", apiErr.Code))
+	span.SetStatus(codes.Error, apiErr.Message)
+	return apiErr
+}
+
+// withTracing starts a server span for every request, continuing the trace
+// of the caller when it sends a traceparent header
+func withTracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		// Name spans after the route, not the path, so IDs do not make
+		// every span name unique
+		route := "unmatched"
+		if _, pattern := http.DefaultServeMux.Handler(r); pattern != "" {
+			if _, path, ok := strings.Cut(pattern, " "); ok {
+				pattern = path
+			}
+			route = pattern
+		}
+
+		ctx, span := tracer.Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(r.URL.Path),
+				semconv.ClientAddress(clientIP(r)),
+				attribute.String("request.id", requestIDFrom(ctx)),
+				attribute.Int64("http.request.body.size", r.ContentLength),
+			))
+		defer span.End()
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(rec.status))
+		if rec.status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+	})
+}
+
+// metadataCarrier lets the propagator read traceparent from gRPC metadata
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if v := metadata.MD(c).Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) { metadata.MD(c).Set(key, value) }
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// grpcStartSpan starts the server span of a gRPC call
+func grpcStartSpan(ctx context.Context, fullMethod string) (context.Context, trace.Span) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+	}
+	service, method, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	return tracer.Start(ctx, strings.TrimPrefix(fullMethod, "/"),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.RPCSystemGRPC,
+			semconv.RPCService(service),
+			semconv.RPCMethod(method),
+		))
+}
+
+func grpcEndSpan(span trace.Span, err error) {
+	st := status.Convert(err)
+	span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(st.Code())))
+	if err != nil {
+		span.SetStatus(codes.Error, st.Message())
+	}
+	span.End()
+}
+
+func grpcUnaryTracing(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, span := grpcStartSpan(ctx, info.FullMethod)
+	resp, err := handler(ctx, req)
+	grpcEndSpan(span, err)
+	return resp, err
+}
+
+func grpcStreamTracing(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, span := grpcStartSpan(ss.Context(), info.FullMethod)
+	err := handler(srv, requestIDStream{ss, ctx})
+	grpcEndSpan(span, err)
+	return err
+}
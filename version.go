@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+)
+
+// Set by the Makefile with -ldflags "-X main.Version=..."; builds without
+// them fall back to what the Go toolchain recorded, see init
+var (
+	Version   string
+	BuildTime string
+	GitCommit string
+)
+
+func init() {
+	info, ok := debug.ReadBuildInfo()
+	if ok {
+		if Version == "" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			Version = info.Main.Version
+		}
+		fromVCS, modified := false, false
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if GitCommit == "" {
+					GitCommit, fromVCS = s.Value, true
+				}
+			case "vcs.time":
+				if BuildTime == "" {
+					BuildTime = s.Value
+				}
+			case "vcs.modified":
+				modified = s.Value == "true"
+			}
+		}
+		if fromVCS && modified {
+			GitCommit += "-dirty"
+		}
+	}
+	if Version == "" {
+		Version = "dev"
+	}
+	if GitCommit == "" {
+		GitCommit = "unknown"
+	}
+	if BuildTime == "" {
+		BuildTime = "unknown"
+	}
+}
+
+// shortCommit is GitCommit cut to the usual 7 characters
+func shortCommit() string {
+	if len(GitCommit) >= 7 && GitCommit != "unknown" {
+		return GitCommit[:7]
+	}
+	return GitCommit
+}
+
+// VersionInfo is the body of GET /api/version
+type VersionInfo struct {
+	Version          string `json:"version"`
+	GitCommit        string `json:"git_commit"`
+	BuildTime        string `json:"build_time"`
+	GoVersion        string `json:"go_version"`
+	TesseractVersion string `json:"tesseract_version,omitempty"` // "" when Tesseract is not available
+}
+
+func versionInfo() VersionInfo {
+	v := VersionInfo{
+		Version:   Version,
+		GitCommit: GitCommit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+	if _, version, ok := currentEngine(); ok {
+		v.TesseractVersion = version
+	}
+	return v
+}
+
+func apiVersionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-cache")
+	writeJSON(w, http.StatusOK, versionInfo())
+}
+
+// withVersionHeaders tells clients which build, and which Tesseract,
+// answered a request
+func withVersionHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-OCR-Version", Version)
+		if v := versionInfo().TesseractVersion; v != "" {
+			w.Header().Set("X-Tesseract-Version", v)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// printVersion implements --version. It looks for Tesseract in the
+// default paths without the startup logging of checkTesseractInstallation.
+func printVersion() {
+	fmt.Printf("ocr-simple %s (commit %s, built %s, %s)\n", Version, shortCommit(), BuildTime, runtime.Version())
+	for _, path := range config.TesseractPaths {
+		if bin, err := exec.LookPath(path); err == nil {
+			fmt.Printf("Tesseract %s (%s)\n", detectTesseractVersion(bin), bin)
+			return
+		}
+	}
+	fmt.Println("Tesseract not found")
+}
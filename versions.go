@@ -0,0 +1,420 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Beyond this many edits two versions are shown as a full replacement
+// instead of computing a minimal diff
+const maxDiffEdits = 2000
+
+// ResultVersion is one OCR run of a document
+type ResultVersion struct {
+	Number        int        `json:"number"`
+	Text          string     `json:"text"`
+	Words         []OCRWord  `json:"words,omitempty"`
+	Confidence    float64    `json:"confidence"`
+	Options       OCROptions `json:"options"`
+	EngineVersion string     `json:"engine_version,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// appendVersion adds result as the newest version and makes it current
+func (doc *Document) appendVersion(result OCRResponse, at time.Time) {
+	v := ResultVersion{
+		Number:        len(doc.Versions) + 1,
+		Text:          result.Text,
+		Words:         result.Words,
+		Confidence:    result.Confidence,
+		Options:       result.Options,
+		EngineVersion: result.EngineVersion,
+		CreatedAt:     at,
+	}
+	doc.Versions = append(doc.Versions, v)
+	doc.Text, doc.Words, doc.Confidence, doc.Options = v.Text, v.Words, v.Confidence, v.Options
+}
+
+// Version returns the version with the given number
+func (doc *Document) Version(n int) (ResultVersion, bool) {
+	if n < 1 || n > len(doc.Versions) {
+		return ResultVersion{}, false
+	}
+	return doc.Versions[n-1], true
+}
+
+// migrateVersions turns the single result of documents stored before
+// versioning existed into version 1
+func migrateVersions(doc *Document) {
+	if len(doc.Versions) > 0 {
+		return
+	}
+	doc.Versions = []ResultVersion{{
+		Number:     1,
+		Text:       doc.Text,
+		Words:      doc.Words,
+		Confidence: doc.Confidence,
+		Options:    doc.Options,
+		CreatedAt:  doc.CreatedAt,
+	}}
+}
+
+// DiffOp is one run of equal, inserted or deleted words
+type DiffOp struct {
+	Op   string `json:"op"` // "equal", "insert" or "delete"
+	Text string `json:"text"`
+}
+
+// diffWords computes a word-level diff from a to b using Myers' algorithm
+func diffWords(a, b []string) []DiffOp {
+	n, m := len(a), len(b)
+	limit := min(n+m, maxDiffEdits)
+
+	// v[k] holds the furthest x reached on diagonal k; trace keeps a copy of
+	// the diagonals -d..d visited in every round for the backtrack
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+	var trace [][]int
+	found := false
+
+	for d := 0; d <= limit && !found; d++ {
+		snapshot := make([]int, 2*d+1)
+		copy(snapshot, v[offset-d:offset+d+1])
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+
+	if !found {
+		return mergeDiffOps(append(
+			[]DiffOp{{Op: "delete", Text: strings.Join(a, " ")}},
+			DiffOp{Op: "insert", Text: strings.Join(b, " ")},
+		))
+	}
+
+	// Walk back from (n, m) collecting operations in reverse
+	var ops []DiffOp
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		at := func(k int) int { return trace[d][k+d] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := 0
+		if d > 0 {
+			prevX = at(prevK)
+		}
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			ops = append(ops, DiffOp{Op: "equal", Text: a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, DiffOp{Op: "insert", Text: b[y-1]})
+			} else {
+				ops = append(ops, DiffOp{Op: "delete", Text: a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return mergeDiffOps(ops)
+}
+
+// mergeDiffOps joins consecutive operations of the same kind and drops empty ones
+func mergeDiffOps(ops []DiffOp) []DiffOp {
+	merged := make([]DiffOp, 0, len(ops))
+	for _, op := range ops {
+		if op.Text == "" {
+			continue
+		}
+		if last := len(merged) - 1; last >= 0 && merged[last].Op == op.Op {
+			merged[last].Text += " " + op.Text
+			continue
+		}
+		merged = append(merged, op)
+	}
+	return merged
+}
+
+// diffVersions resolves the from and to query parameters (defaulting to the
+// two latest versions) and diffs them
+func diffVersions(doc *Document, r *http.Request) (ResultVersion, ResultVersion, []DiffOp, error) {
+	latest := len(doc.Versions)
+	from, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil {
+		from = max(1, latest-1)
+	}
+	to, err := strconv.Atoi(r.URL.Query().Get("to"))
+	if err != nil {
+		to = latest
+	}
+
+	a, ok := doc.Version(from)
+	if !ok {
+		return a, a, nil, invalidField("from", "versi asal tidak ditemukan")
+	}
+	b, ok := doc.Version(to)
+	if !ok {
+		return a, b, nil, invalidField("to", "versi tujuan tidak ditemukan")
+	}
+	return a, b, diffWords(strings.Fields(a.Text), strings.Fields(b.Text)), nil
+}
+
+// reprocessDocument re-runs OCR on a stored document and records a new version
+func reprocessDocument(ctx context.Context, doc *Document, opts OCROptions) (*Document, error) {
+	ctx, span := tracer.Start(ctx, "ocr.reprocess", trace.WithAttributes(
+		attribute.String("document.id", doc.ID),
+		attribute.String("ocr.language", metricsLanguage(opts)),
+	))
+	defer span.End()
+
+	if doc.ImageFile == "" {
+		return nil, newAPIError(CodeNotFound, "gambar asli tidak tersedia")
+	}
+	imageBytes, err := os.ReadFile(docStore.FilePath(doc, doc.ImageFile))
+	if err != nil {
+		return nil, newAPIError(CodeNotFound, "gambar asli tidak tersedia")
+	}
+
+	result := runOCRWithRetry(ctx, imageBytes, doc.Filename, opts)
+	if result.Err != nil {
+		return nil, ocrError(result.Err)
+	}
+	return docStore.AddVersion(doc.ID, result)
+}
+
+// reprocessInBackground re-runs OCR on every document, one at a time so
+// interactive uploads still get worker slots; ctx only carries the trace
+func reprocessInBackground(ctx context.Context, docs []*Document, opts OCROptions) {
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		failed := 0
+		for _, doc := range docs {
+			if _, err := reprocessDocument(ctx, doc, opts); err != nil {
+				failed++
+				slog.WarnContext(ctx, "reprocessing document failed", "document_id", doc.ID, "err", err)
+			}
+		}
+		slog.InfoContext(ctx, "reprocessing finished", "documents", len(docs), "failed", failed)
+	}()
+}
+
+// optionsFromForm reads lang, psm and preprocess from a submitted form
+func optionsFromForm(r *http.Request) (OCROptions, error) {
+	return parseOCROptions(r.FormValue("lang"), r.FormValue("psm"), r.FormValue("preprocess"))
+}
+
+// documentsReprocessHandler re-runs every document matching the history
+// page filters with the submitted options
+func documentsReprocessHandler(w http.ResponseWriter, r *http.Request) {
+	opts, err := optionsFromForm(r)
+	if err != nil {
+		writeError(w, r, asAPIError(err, "options"))
+		return
+	}
+	if !engineAvailable() {
+		writeError(w, r, errEngineUnavailable)
+		return
+	}
+
+	var docs []*Document
+	for _, result := range docStore.Search(searchRequest(r), 0) {
+		docs = append(docs, result.Document)
+	}
+	reprocessInBackground(r.Context(), docs, opts)
+
+	params := r.URL.Query()
+	params.Del("page")
+	params.Set("msg", fmt.Sprintf("%d dokumen dijadwalkan untuk diproses ulang", len(docs)))
+	http.Redirect(w, r, "/documents?"+params.Encode(), http.StatusSeeOther)
+}
+
+func documentDiffHandler(w http.ResponseWriter, r *http.Request) {
+	doc, ok := documentFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	tmpl, exists := cachedTemplate("diff")
+
+	if !exists {
+		writeError(w, r, errTemplateNotFound)
+		return
+	}
+
+	from, to, ops, err := diffVersions(doc, r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	data := struct {
+		Document *Document
+		From     ResultVersion
+		To       ResultVersion
+		Ops      []DiffOp
+	}{doc, from, to, ops}
+	tmpl.Execute(w, data)
+}
+
+func apiDocumentVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	doc, ok := docStore.Get(r.PathValue("id"))
+	if !ok {
+		writeError(w, r, errDocumentNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"versions": doc.Versions})
+}
+
+// apiReprocessDocumentHandler synchronously re-runs a single document with
+// the options in the JSON body and returns the new version
+func apiReprocessDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	doc, ok := docStore.Get(r.PathValue("id"))
+	if !ok {
+		writeError(w, r, errDocumentNotFound)
+		return
+	}
+	if !engineAvailable() {
+		writeError(w, r, errEngineUnavailable)
+		return
+	}
+
+	var opts OCROptions
+	if err := decodeJSONBody(w, r, 64<<10, &opts); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := opts.Validate(); err != nil {
+		writeError(w, r, asAPIError(err, "options"))
+		return
+	}
+
+	updated, err := reprocessDocument(r.Context(), doc, opts)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, updated.Versions[len(updated.Versions)-1])
+}
+
+// apiReprocessHandler schedules re-processing of every document matching
+// the q, tag, collection, from and to query parameters
+func apiReprocessHandler(w http.ResponseWriter, r *http.Request) {
+	if !engineAvailable() {
+		writeError(w, r, errEngineUnavailable)
+		return
+	}
+
+	var opts OCROptions
+	if err := decodeJSONBody(w, r, 64<<10, &opts); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := opts.Validate(); err != nil {
+		writeError(w, r, asAPIError(err, "options"))
+		return
+	}
+
+	var docs []*Document
+	for _, result := range docStore.Search(searchRequest(r), 0) {
+		docs = append(docs, result.Document)
+	}
+	reprocessInBackground(r.Context(), docs, opts)
+
+	writeJSON(w, http.StatusAccepted, map[string]int{"scheduled": len(docs)})
+}
+
+func apiDocumentDiffHandler(w http.ResponseWriter, r *http.Request) {
+	doc, ok := docStore.Get(r.PathValue("id"))
+	if !ok {
+		writeError(w, r, errDocumentNotFound)
+		return
+	}
+	from, to, ops, err := diffVersions(doc, r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"from": from.Number,
+		"to":   to.Number,
+		"diff": ops,
+	})
+}
+
+const diffTmpl = `
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>OCR Simple - Perbandingan Versi</title>
+    <style>
+        * { box-sizing: border-box; }
+        body { font-family: Arial, sans-serif; padding: 15px; background: #f5f5f5; margin: 0; }
+        .container { max-width: 1000px; margin: 0 auto; background: white; padding: 20px; border-radius: 4px; box-shadow: 0 2px 4px rgba(0,0,0,0.1); }
+        .header { display: flex; justify-content: space-between; align-items: center; margin-bottom: 10px; }
+        .header h1 { margin: 0; font-size: 1.3em; color: #333; }
+        .header a { color: #007bff; text-decoration: none; }
+        .versions { display: flex; gap: 15px; margin-bottom: 12px; font-size: 0.85em; color: #666; }
+        .versions div { flex: 1; background: #f8f9fa; padding: 8px; border-radius: 4px; }
+        .legend { font-size: 0.85em; margin-bottom: 8px; }
+        .diff { font-family: 'Courier New', monospace; font-size: 13px; line-height: 1.6; white-space: pre-wrap; border: 1px solid #ddd; border-radius: 3px; padding: 10px; }
+        del { background: #f8d7da; color: #721c24; }
+        ins { background: #d4edda; color: #155724; text-decoration: none; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>Perbandingan: {{.Document.Filename}}</h1>
+            <a href="/documents/{{.Document.ID}}">← Kembali ke dokumen</a>
+        </div>
+        <div class="versions">
+            <div><strong>Versi {{.From.Number}}</strong><br>{{.From.CreatedAt.Format "2006-01-02 15:04"}} · {{.From.Options.Label}}{{if .From.EngineVersion}} · Tesseract {{.From.EngineVersion}}{{end}}</div>
+            <div><strong>Versi {{.To.Number}}</strong><br>{{.To.CreatedAt.Format "2006-01-02 15:04"}} · {{.To.Options.Label}}{{if .To.EngineVersion}} · Tesseract {{.To.EngineVersion}}{{end}}</div>
+        </div>
+        <div class="legend"><del>dihapus</del> <ins>ditambahkan</ins></div>
+        <div class="diff">{{range .Ops}}{{if eq .Op "insert"}}<ins>{{.Text}}</ins> {{else if eq .Op "delete"}}<del>{{.Text}}</del> {{else}}{{.Text}} {{end}}{{else}}Tidak ada teks.{{end}}</div>
+    </div>
+</body>
+</html>`
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// startTestWorkers runs the OCR workers on the fake Tesseract of
+// fakeTesseract, reported as version 5.3.0, for the duration of a test
+func startTestWorkers(t *testing.T) string {
+	t.Helper()
+	tesseract := fakeTesseract(t)
+
+	ocrMutex.Lock()
+	oldPath, oldFound, oldVersion := tesseractPath, tesseractFound, tesseractVersion
+	tesseractPath, tesseractFound, tesseractVersion = tesseract, true, "5.3.0"
+	ocrMutex.Unlock()
+	oldPool := ocrWorkerPool
+	startOCRWorkers()
+	t.Cleanup(func() {
+		close(ocrWorkerPool)
+		ocrWorkerPool = oldPool
+		ocrMutex.Lock()
+		tesseractPath, tesseractFound, tesseractVersion = oldPath, oldFound, oldVersion
+		ocrMutex.Unlock()
+	})
+	return tesseract
+}
+
+// applyDiff rebuilds both sides of a diff
+func applyDiff(ops []DiffOp) (from, to []string) {
+	for _, op := range ops {
+		words := strings.Fields(op.Text)
+		if op.Op != "insert" {
+			from = append(from, words...)
+		}
+		if op.Op != "delete" {
+			to = append(to, words...)
+		}
+	}
+	return from, to
+}
+
+func TestDiffWords(t *testing.T) {
+	tests := []struct {
+		name, a, b string
+		want       []DiffOp
+	}{
+		{"same", "a b c", "a b c", []DiffOp{{"equal", "a b c"}}},
+		{"insert", "a b c", "a x b c", []DiffOp{{"equal", "a"}, {"insert", "x"}, {"equal", "b c"}}},
+		{"insert at the end", "a b", "a b c d", []DiffOp{{"equal", "a b"}, {"insert", "c d"}}},
+		{"delete", "a b c", "a c", []DiffOp{{"equal", "a"}, {"delete", "b"}, {"equal", "c"}}},
+		{"delete at the start", "a b c", "c", []DiffOp{{"delete", "a b"}, {"equal", "c"}}},
+		{"replace", "total 100 rupiah", "total 700 rupiah", []DiffOp{{"equal", "total"}, {"delete", "100"}, {"insert", "700"}, {"equal", "rupiah"}}},
+		{"replace everything", "a b", "c d", []DiffOp{{"delete", "a b"}, {"insert", "c d"}}},
+		{"empty old side", "", "a b", []DiffOp{{"insert", "a b"}}},
+		{"empty new side", "a b", "", []DiffOp{{"delete", "a b"}}},
+		{"both empty", "", "", []DiffOp{}},
+	}
+	for _, tt := range tests {
+		got := diffWords(strings.Fields(tt.a), strings.Fields(tt.b))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: diffWords(%q, %q) = %v, want %v", tt.name, tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// With repeated words several minimal diffs exist; any of them must
+// rebuild both sides with the fewest edits
+func TestDiffWordsRepeatedWords(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		edits int
+	}{
+		{"a a a", "a a", 1},
+		{"the cat the cat", "the cat the dog the cat", 2},
+		{"a b a b a b", "b a b a", 2},
+		{"x x y x x", "x y x y x", 2},
+	}
+	for _, tt := range tests {
+		a, b := strings.Fields(tt.a), strings.Fields(tt.b)
+		ops := diffWords(a, b)
+		from, to := applyDiff(ops)
+		if !reflect.DeepEqual(from, a) || !reflect.DeepEqual(to, b) {
+			t.Errorf("diffWords(%q, %q) = %v does not rebuild both sides", tt.a, tt.b, ops)
+		}
+		edits := 0
+		for _, op := range ops {
+			if op.Op != "equal" {
+				edits += len(strings.Fields(op.Text))
+			}
+		}
+		if edits != tt.edits {
+			t.Errorf("diffWords(%q, %q) = %v: %d edits, want %d", tt.a, tt.b, ops, edits, tt.edits)
+		}
+	}
+}
+
+func TestDiffWordsGivesUpOnLargeDiffs(t *testing.T) {
+	a := strings.Fields(strings.Repeat("a ", maxDiffEdits))
+	b := strings.Fields(strings.Repeat("b ", maxDiffEdits))
+	ops := diffWords(a, b)
+	if len(ops) != 2 || ops[0].Op != "delete" || ops[1].Op != "insert" {
+		t.Fatalf("diffWords of %d edits = %d operations, want a full replacement", 2*maxDiffEdits, len(ops))
+	}
+	if from, to := applyDiff(ops); len(from) != len(a) || len(to) != len(b) {
+		t.Errorf("replacement has %d and %d words, want %d and %d", len(from), len(to), len(a), len(b))
+	}
+}
+
+func TestReprocessDocumentAddsVersion(t *testing.T) {
+	useTestStores(t)
+	startTestWorkers(t)
+
+	image := append(append([]byte{}, testPNG[:8]...), "\nkwitansi\n"...)
+	doc, err := docStore.Add("kwitansi.png", image, OCRResponse{Text: "kwltansi", Options: OCROptions{Language: "eng"}}, DocumentDetails{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := OCROptions{Language: "ind", PSM: 6}
+	doc, err = reprocessDocument(context.Background(), doc, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Versions) != 2 {
+		t.Fatalf("%d versions, want 2", len(doc.Versions))
+	}
+	first, second := doc.Versions[0], doc.Versions[1]
+	if first.Text != "kwltansi" || first.Options.Language != "eng" {
+		t.Errorf("version 1 changed: %+v", first)
+	}
+	if second.Number != 2 || second.Text != "kwitansi" || second.Options != opts || second.EngineVersion != "5.3.0" {
+		t.Errorf("version 2 = %+v", second)
+	}
+	if doc.Text != "kwitansi" || doc.Options != opts {
+		t.Errorf("document shows %q with %+v, want the new version", doc.Text, doc.Options)
+	}
+	if stored, _ := docStore.Get(doc.ID); len(stored.Versions) != 2 {
+		t.Errorf("stored document has %d versions", len(stored.Versions))
+	}
+
+	// Both versions are kept side by side for the diff page
+	if ops := diffWords(strings.Fields(first.Text), strings.Fields(second.Text)); !reflect.DeepEqual(ops, []DiffOp{{"delete", "kwltansi"}, {"insert", "kwitansi"}}) {
+		t.Errorf("diff = %v", ops)
+	}
+}
+
+func TestReprocessDocumentWithoutImage(t *testing.T) {
+	useTestStores(t)
+	startTestWorkers(t)
+
+	doc, err := docStore.Add("scan.png", testPNG, OCRResponse{Text: "scan"}, DocumentDetails{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bare := *doc
+	bare.ImageFile = ""
+	_, err = reprocessDocument(context.Background(), &bare, OCROptions{})
+	if apiErr, ok := err.(*APIError); !ok || apiErr.Code != CodeNotFound {
+		t.Errorf("error = %v, want %s", err, CodeNotFound)
+	}
+}
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Subdirectories of a hot folder the originals are moved to, and the
+// journal kept next to them
+const (
+	watchProcessedDir = "processed"
+	watchFailedDir    = "failed"
+	watchJournalFile  = ".ocr-journal.jsonl"
+)
+
+// watchEntry is one line of a hot folder's journal. "processed" and
+// "failed" are written once the results are on disk, "moved" once the
+// original has left the folder; a file whose last entry is not "moved" is
+// only moved after a restart, not recognised again.
+type watchEntry struct {
+	File    string    `json:"file"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Status  string    `json:"status"`
+	Outputs []string  `json:"outputs,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+func (e watchEntry) key() string {
+	return fmt.Sprintf("%s|%d|%d", e.File, e.Size, e.ModTime.UnixNano())
+}
+
+// hotFolder is a directory scanners drop images into
+type hotFolder struct {
+	dir    string
+	outDir string // results go next to the file when empty
+	opts   OCROptions
+
+	mu      sync.Mutex
+	pending map[string]watchEntry // key -> recognised but not yet moved
+	journal *os.File
+
+	seen     map[string]watchedFile // name -> last observation, see poll
+	inFlight map[string]bool        // files handed to the workers and not done yet
+	stuck    map[string]bool        // files that could not be moved, logged once
+	waiting  bool                   // for Tesseract, logged once
+
+	queue chan watchEntry // ready files for the workers of the folder
+}
+
+// watchedFile is what a poll saw of a file; it is read once it has not
+// changed for watch.settle
+type watchedFile struct {
+	size    int64
+	modTime time.Time
+	since   time.Time
+}
+
+// startWatching starts polling every directory of watch.dirs
+func startWatching() error {
+	opts, err := parseOCROptions(config.WatchLanguage, "", config.WatchPreprocess)
+	if err != nil {
+		return err
+	}
+	var folders []*hotFolder
+	for _, dir := range config.WatchDirs {
+		h, err := openHotFolder(dir, config.WatchOutputDir, opts)
+		if err != nil {
+			return err
+		}
+		folders = append(folders, h)
+	}
+	for _, h := range folders {
+		slog.Info("watching hot folder", "dir", h.dir, "output_dir", h.outDir, "options", opts.Label(), "pending", len(h.pending))
+		go h.run()
+	}
+	return nil
+}
+
+func openHotFolder(dir, outDir string, opts OCROptions) (*hotFolder, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("watch.dirs: %v", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("watch.dirs: %s is not a directory", dir)
+	}
+	for _, sub := range []string{watchProcessedDir, watchFailedDir} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, err
+		}
+	}
+	if outDir != "" {
+		if err := os.MkdirAll(outDir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	h := &hotFolder{
+		dir:      dir,
+		outDir:   outDir,
+		opts:     opts,
+		pending:  map[string]watchEntry{},
+		seen:     map[string]watchedFile{},
+		inFlight: map[string]bool{},
+		stuck:    map[string]bool{},
+		queue:    make(chan watchEntry, config.Workers),
+	}
+	if err := h.replayJournal(); err != nil {
+		return nil, err
+	}
+	h.journal, err = os.OpenFile(filepath.Join(dir, watchJournalFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// replayJournal collects the files recognised before a restart whose
+// originals were not moved yet
+func (h *hotFolder) replayJournal() error {
+	f, err := os.Open(filepath.Join(h.dir, watchJournalFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e watchEntry
+		// A line cut short by a crash is skipped
+		if json.Unmarshal(scanner.Bytes(), &e) != nil {
+			continue
+		}
+		if e.Status == "moved" {
+			delete(h.pending, e.key())
+		} else {
+			h.pending[e.key()] = e
+		}
+	}
+	return scanner.Err()
+}
+
+func (h *hotFolder) record(e watchEntry) {
+	e.At = time.Now()
+	data, _ := json.Marshal(e)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, err := h.journal.Write(append(data, '\n')); err != nil {
+		slog.Warn("writing hot folder journal failed", "dir", h.dir, "err", err)
+	}
+	if e.Status == "moved" {
+		delete(h.pending, e.key())
+	} else {
+		h.pending[e.key()] = e
+	}
+}
+
+// run starts config.Workers workers and polls the folder until the process
+// exits
+func (h *hotFolder) run() {
+	for i := 0; i < config.Workers; i++ {
+		go h.work()
+	}
+	for {
+		h.poll()
+		time.Sleep(config.WatchInterval)
+	}
+}
+
+// work processes the files poll hands over
+func (h *hotFolder) work() {
+	for file := range h.queue {
+		h.process(file)
+		h.mu.Lock()
+		delete(h.inFlight, file.File)
+		h.mu.Unlock()
+	}
+}
+
+// poll looks at the folder once and hands the files that have stopped
+// changing to the workers. It does not wait for them, so a slow
+// recognition or one backing off between retries does not hold up the
+// files dropped after it; files the workers have no room for are handed
+// over on a later poll.
+func (h *hotFolder) poll() {
+	entries, err := os.ReadDir(h.dir)
+	if err != nil {
+		slog.Warn("reading hot folder failed", "dir", h.dir, "err", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	present := map[string]bool{}
+	var ready []watchEntry
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || !isValidImageType(name) {
+			continue
+		}
+		if h.inFlight[name] {
+			present[name] = true
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		present[name] = true
+
+		// A scanner still writing changes the size or time between polls
+		last, ok := h.seen[name]
+		if !ok || last.size != info.Size() || !last.modTime.Equal(info.ModTime()) {
+			h.seen[name] = watchedFile{size: info.Size(), modTime: info.ModTime(), since: now}
+			continue
+		}
+		if info.Size() == 0 || now.Sub(last.since) < config.WatchSettle {
+			continue
+		}
+		ready = append(ready, watchEntry{File: name, Size: info.Size(), ModTime: info.ModTime()})
+	}
+	for name := range h.seen {
+		if !present[name] {
+			delete(h.seen, name)
+		}
+	}
+	if len(ready) == 0 {
+		return
+	}
+
+	// Without Tesseract the files wait instead of all ending up in failed/
+	if !engineAvailable() {
+		if !h.waiting {
+			slog.Warn("hot folder files are waiting for Tesseract", "dir", h.dir, "files", len(ready))
+		}
+		h.waiting = true
+		return
+	}
+	h.waiting = false
+
+	for _, file := range ready {
+		select {
+		case h.queue <- file:
+			h.inFlight[file.File] = true
+		default:
+			return
+		}
+	}
+}
+
+// process recognises one file, writes the results and moves the original
+func (h *hotFolder) process(file watchEntry) {
+	h.mu.Lock()
+	done, recognised := h.pending[file.key()]
+	h.mu.Unlock()
+	if recognised {
+		// Recognised before a restart, only the move is left
+		h.move(done)
+		return
+	}
+
+	path := filepath.Join(h.dir, file.File)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		slog.Warn("reading hot folder file failed", "file", path, "err", err)
+		return
+	}
+
+	start := time.Now()
+	result := runOCRWithRetry(context.Background(), data, file.File, h.opts)
+	if errors.Is(result.Err, errOCRBusy) || errors.Is(result.Err, errOCRTimeout) || !engineAvailable() {
+		// Not the file's fault; it is tried again on a later poll
+		slog.Warn("hot folder file postponed", "file", path, "err", result.Err)
+		h.mu.Lock()
+		delete(h.seen, file.File)
+		h.mu.Unlock()
+		return
+	}
+
+	if result.Err != nil {
+		file.Status, file.Error = "failed", result.Err.Error()
+		watchFilesTotal.WithLabelValues("failed").Inc()
+		slog.Warn("hot folder file failed", "file", path, "err", result.Err)
+	} else {
+		rec := &Recognition{
+			Filename:      file.File,
+			Text:          result.Text,
+			Words:         result.Words,
+			Confidence:    result.Confidence,
+			Options:       result.Options,
+			EngineVersion: result.EngineVersion,
+		}
+		outDir := h.outDir
+		if outDir == "" {
+			outDir = h.dir
+		}
+		outputs, err := writeSidecars(outDir, strings.TrimSuffix(file.File, filepath.Ext(file.File)), rec)
+		if err != nil {
+			file.Status, file.Error = "failed", fmt.Sprintf("writing results: %v", err)
+			watchFilesTotal.WithLabelValues("failed").Inc()
+			slog.Warn("writing hot folder results failed", "file", path, "err", err)
+		} else {
+			file.Status, file.Outputs = "processed", outputs
+			watchFilesTotal.WithLabelValues("processed").Inc()
+			slog.Info("hot folder file processed", "file", path, "outputs", strings.Join(outputs, ","),
+				"words", len(result.Words), "duration_ms", time.Since(start).Milliseconds())
+		}
+	}
+	h.record(file)
+	h.move(file)
+}
+
+// move puts the original into processed/ or failed/; a failure also gets
+// its error written next to it
+func (h *hotFolder) move(file watchEntry) {
+	sub := watchProcessedDir
+	if file.Status == "failed" {
+		sub = watchFailedDir
+	}
+	src := filepath.Join(h.dir, file.File)
+	dst := uniquePath(filepath.Join(h.dir, sub), file.File)
+	if err := os.Rename(src, dst); err != nil {
+		h.mu.Lock()
+		logged := h.stuck[file.File]
+		h.stuck[file.File] = true
+		h.mu.Unlock()
+		if !logged {
+			slog.Warn("moving hot folder file failed, it will not be recognised again", "file", src, "err", err)
+		}
+		return
+	}
+	h.mu.Lock()
+	delete(h.stuck, file.File)
+	h.mu.Unlock()
+	if file.Status == "failed" {
+		os.WriteFile(dst+".error.txt", []byte(file.Error+"\n"), 0o644)
+	}
+	file.Status, file.Outputs, file.Error = "moved", nil, ""
+	h.record(file)
+}
+
+// writeSidecars writes the .txt and .json results of rec as dir/base.txt
+// and dir/base.json, numbering base when either exists already, and
+// returns the paths written. The .txt file is claimed with O_EXCL so
+// workers, and hot folders sharing an output directory, never pick the
+// same name.
+func writeSidecars(dir, base string, rec *Recognition) ([]string, error) {
+	for n := 0; ; n++ {
+		stem := base
+		if n > 0 {
+			stem = fmt.Sprintf("%s-%d", base, n)
+		}
+		txt := filepath.Join(dir, stem+".txt")
+		jsonPath := filepath.Join(dir, stem+".json")
+		f, err := os.OpenFile(txt, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		f.Close()
+		if _, err := os.Stat(jsonPath); err == nil {
+			os.Remove(txt)
+			continue
+		}
+		if err := writeSidecarFiles(txt, jsonPath, rec); err != nil {
+			os.Remove(txt)
+			os.Remove(jsonPath)
+			return nil, err
+		}
+		return []string{txt, jsonPath}, nil
+	}
+}
+
+// writeSidecarFiles writes the text of rec to txtPath and all of it to
+// jsonPath
+func writeSidecarFiles(txtPath, jsonPath string, rec *Recognition) error {
+	// The web page shows a placeholder for empty results; files stay empty
+	if len(rec.Words) == 0 {
+		rec.Text, rec.Words = "", []OCRWord{}
+	}
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(txtPath, []byte(rec.Text), 0o644); err != nil {
+		return err
+	}
+	return os.WriteFile(jsonPath, append(data, '\n'), 0o644)
+}
+
+// uniquePath returns dir/name, or dir/name-1, dir/name-2, ... (before the
+// extension) when that exists
+func uniquePath(dir, name string) string {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for n := 0; ; n++ {
+		candidate := stem
+		if n > 0 {
+			candidate = fmt.Sprintf("%s-%d", stem, n)
+		}
+		path := filepath.Join(dir, candidate+ext)
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		return path
+	}
+}
+
+// runWatchCommand implements `ocr-simple watch`: the hot folders of
+// watch.dirs without the web and gRPC servers
+func runWatchCommand(args []string) int {
+	c, err := loadConfig("watch", args)
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errConfigUsage):
+		return 2
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "❌ Invalid configuration:\n%v\n", err)
+		return 1
+	}
+	config = c
+	if len(config.WatchDirs) == 0 {
+		fmt.Fprintln(os.Stderr, "❌ Error: no folders to watch, set watch.dirs (env OCR_WATCH_DIRS or -watch-dirs)")
+		return 2
+	}
+
+	if err := setupLogging(config.LogFormat, config.LogLevel); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error:", err)
+		return 1
+	}
+	slog.Info("starting ocr-simple watch", "version", Version, "commit", GitCommit)
+	startOCRWorkers()
+	initOCR()
+	if err := startWatching(); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Error:", err)
+		return 1
+	}
+	select {}
+}
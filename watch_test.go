@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pretendTesseract marks an engine as available for the duration of a test
+func pretendTesseract(t *testing.T) {
+	t.Helper()
+	ocrMutex.Lock()
+	oldPath, oldFound := tesseractPath, tesseractFound
+	tesseractPath, tesseractFound = "tesseract", true
+	ocrMutex.Unlock()
+	t.Cleanup(func() {
+		ocrMutex.Lock()
+		tesseractPath, tesseractFound = oldPath, oldFound
+		ocrMutex.Unlock()
+	})
+}
+
+func TestHotFolderPollDoesNotWaitForWorkers(t *testing.T) {
+	pretendTesseract(t)
+	oldWorkers, oldSettle := config.Workers, config.WatchSettle
+	config.Workers, config.WatchSettle = 1, 0
+	t.Cleanup(func() { config.Workers, config.WatchSettle = oldWorkers, oldSettle })
+
+	dir := t.TempDir()
+	for _, name := range []string{"a.png", "b.png", "c.png"} {
+		os.WriteFile(filepath.Join(dir, name), testPNG, 0o644)
+	}
+	h, err := openHotFolder(dir, "", OCROptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.journal.Close() })
+
+	// No worker takes from the queue, as if every recognition were slow
+	poll := func() {
+		t.Helper()
+		done := make(chan struct{})
+		go func() { h.poll(); close(done) }()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("poll waited for the workers")
+		}
+	}
+	inFlight := func() []string {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		var names []string
+		for name := range h.inFlight {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	// The first poll only notes the files, the second finds them settled
+	poll()
+	poll()
+	if got := inFlight(); len(got) != 1 || got[0] != "a.png" {
+		t.Fatalf("in flight after the files settled: %v, want [a.png]", got)
+	}
+	// The queue is full and a.png is not handed over twice
+	poll()
+	if len(h.queue) != 1 || len(inFlight()) != 1 {
+		t.Fatalf("queue %d, in flight %v", len(h.queue), inFlight())
+	}
+
+	// A worker takes a.png and is still busy with it
+	if file := <-h.queue; file.File != "a.png" {
+		t.Fatalf("worker got %s", file.File)
+	}
+	poll()
+	if got := inFlight(); len(got) != 2 || got[1] != "b.png" {
+		t.Fatalf("in flight: %v, want [a.png b.png]", got)
+	}
+}
+
+// Workers finishing files with the same name at once get distinct sidecars
+func TestWriteSidecarsConcurrently(t *testing.T) {
+	dir := t.TempDir()
+	// A stray .json takes the name as well
+	os.WriteFile(filepath.Join(dir, "scan.json"), []byte("{}"), 0o644)
+
+	const workers = 20
+	var wg sync.WaitGroup
+	paths := make([][]string, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rec := &Recognition{Filename: "scan.png", Text: fmt.Sprint(i), Words: []OCRWord{{Text: fmt.Sprint(i)}}}
+			var err error
+			if paths[i], err = writeSidecars(dir, "scan", rec); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	seen := map[string]bool{}
+	for i, p := range paths {
+		if len(p) != 2 {
+			t.Fatalf("worker %d wrote %v", i, p)
+		}
+		if seen[p[0]] || filepath.Base(p[0]) == "scan.txt" {
+			t.Errorf("worker %d got taken name %s", i, p[0])
+		}
+		seen[p[0]] = true
+		if text, _ := os.ReadFile(p[0]); string(text) != fmt.Sprint(i) {
+			t.Errorf("%s = %q, want %d", p[0], text, i)
+		}
+		if strings.TrimSuffix(p[0], ".txt") != strings.TrimSuffix(p[1], ".json") {
+			t.Errorf("sidecars %v do not share a name", p)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "scan.json")); string(data) != "{}" {
+		t.Errorf("stray scan.json overwritten: %s", data)
+	}
+}
+
+// A file whose results cannot be written ends up in failed/ with the reason
+func TestHotFolderSidecarWriteFailure(t *testing.T) {
+	startTestWorkers(t)
+	dir, out := t.TempDir(), filepath.Join(t.TempDir(), "out")
+	writeBatchImage(t, filepath.Join(dir, "faktur.png"), "faktur")
+	h, err := openHotFolder(dir, out, OCROptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.journal.Close() })
+
+	// The output directory is replaced by a file, so nothing can be written there
+	os.RemoveAll(out)
+	os.WriteFile(out, nil, 0o644)
+
+	info, _ := os.Stat(filepath.Join(dir, "faktur.png"))
+	h.process(watchEntry{File: "faktur.png", Size: info.Size(), ModTime: info.ModTime()})
+
+	if _, err := os.Stat(filepath.Join(dir, watchFailedDir, "faktur.png")); err != nil {
+		t.Fatalf("original not moved to failed/: %v", err)
+	}
+	reason, _ := os.ReadFile(filepath.Join(dir, watchFailedDir, "faktur.png.error.txt"))
+	if !strings.Contains(string(reason), "writing results") {
+		t.Errorf("error.txt = %q", reason)
+	}
+	journal, _ := os.ReadFile(filepath.Join(dir, watchJournalFile))
+	if !strings.Contains(string(journal), `"status":"failed"`) {
+		t.Errorf("failure not in the journal:\n%s", journal)
+	}
+}